@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"api/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Единый аккаунт посетителя и владельца
+type AccountController struct {
+	beego.Controller
+}
+
+type AccountResponse struct {
+	Err  bool `json:"err"`
+	Data any  `json:"data"`
+}
+
+var accountAccess = AccessRules{
+	"Me":   {},
+	"Link": {},
+
+	"Export":         {},
+	"RequestErasure": {},
+	"CancelErasure":  {},
+}
+
+func (a *AccountController) HandlerFunc(action string) bool {
+	auth := AuthController{Controller: a.Controller}
+	return auth.Require(accountAccess, action)
+}
+
+// @Title Login
+// @Description Единый вход по email или имени посетителя. Токен содержит все профили аккаунта (посетитель, владелец), но роли — только тех, чей пароль совпал (остальные с password_required); при включённой 2FA владельца возвращается mfa_token для POST /v1/owner/user/login/mfa
+// @Param	body		body 	models.AccountLoginRequest	true	"Email или имя и пароль"
+// @Success 200 {object} models.OwnerLogin
+// @Failure 401 {object} AccountResponse "Неверный логин или пароль"
+// @Failure 429 {object} types.Problem "Слишком много неудачных попыток"
+// @router /login [post]
+func (a *AccountController) Login() {
+	var req models.AccountLoginRequest
+	if err := json.Unmarshal(a.Ctx.Input.RequestBody, &req); err != nil {
+		a.Ctx.Output.SetStatus(400)
+		a.Data["json"] = AccountResponse{Err: true, Data: "Invalid request"}
+		a.ServeJSON()
+		return
+	}
+
+	result, err := models.GuardAccountLogin(req.Login, ClientIP(a.Ctx), func() (*models.OwnerLogin, error) {
+		return models.LoginAccount(req, sessionClient(a.Ctx))
+	})
+	var cooldown *models.CooldownError
+	if errors.As(err, &cooldown) {
+		abortTooManyRequests(&a.Controller, cooldown)
+		return
+	}
+	if err != nil {
+		a.Ctx.Output.SetStatus(401)
+		a.Data["json"] = AccountResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	a.Data["json"] = AccountResponse{Err: false, Data: result}
+	a.ServeJSON()
+}
+
+// @Title Me
+// @Description Аккаунт текущего токена: профили и роли
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} models.AccountInfo
+// @router /me [get]
+func (a *AccountController) Me() {
+	auth := AuthController{Controller: a.Controller}
+	a.Data["json"] = AccountResponse{Err: false, Data: auth.Principal().Account()}
+	a.ServeJSON()
+}
+
+// @Title Link
+// @Description Присоединение к аккаунту второго профиля (владельца — по email, посетителя — по имени или email) с подтверждением его паролем. Новый профиль появится в токене после обновления токенов
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	body		body 	models.LinkProfileRequest	true	"Логин и пароль присоединяемого профиля"
+// @Success 200 {object} AccountResponse
+// @Failure 401 {object} AccountResponse "Неверный логин или пароль"
+// @Failure 409 {object} AccountResponse "Профиль не привязан к аккаунту или у аккаунта уже есть оба профиля"
+// @router /link [post]
+func (a *AccountController) Link() {
+	var req models.LinkProfileRequest
+	if err := json.Unmarshal(a.Ctx.Input.RequestBody, &req); err != nil {
+		a.Ctx.Output.SetStatus(400)
+		a.Data["json"] = AccountResponse{Err: true, Data: "Invalid request"}
+		a.ServeJSON()
+		return
+	}
+
+	auth := AuthController{Controller: a.Controller}
+	ip := ClientIP(a.Ctx)
+	_, err := models.GuardAccountLogin(req.Login, ip, func() (struct{}, error) {
+		return struct{}{}, models.LinkProfile(auth.Principal(), req, ip)
+	})
+	var cooldown *models.CooldownError
+	if errors.As(err, &cooldown) {
+		abortTooManyRequests(&a.Controller, cooldown)
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoAccount) || errors.Is(err, models.ErrProfileAlreadyLinked):
+			a.Ctx.Output.SetStatus(409)
+		case errors.Is(err, models.ErrInvalidCredentials) || errors.Is(err, models.ErrAccountBlocked):
+			a.Ctx.Output.SetStatus(401)
+		default:
+			a.Ctx.Output.SetStatus(500)
+		}
+		a.Data["json"] = AccountResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	a.Data["json"] = AccountResponse{Err: false, Data: "Профиль присоединён к аккаунту"}
+	a.ServeJSON()
+}
+
+// @Title Export
+// @Description Архив всех персональных данных аккаунта в JSON: профили, компании, привязки входа, API-ключи, сессии, журнал аудита и запланированное удаление
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} models.AccountExport
+// @router /export [get]
+func (a *AccountController) Export() {
+	auth := AuthController{Controller: a.Controller}
+	export, err := models.ExportAccount(auth.Principal())
+	if err != nil {
+		a.Ctx.Output.SetStatus(500)
+		a.Data["json"] = AccountResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	name := fmt.Sprintf("qwerty-town-%s-%d-%s.json", auth.Principal().Role, auth.Principal().ID, export.ExportedAt.Format("20060102"))
+	a.Ctx.Output.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	a.Ctx.Output.Header("Cache-Control", "no-store")
+	a.Data["json"] = export
+	a.ServeJSON()
+}
+
+// @Title RequestErasure
+// @Description Запрос на удаление аккаунта со всеми профилями. Данные удаляются по истечении account_erasure_grace; до этого вход работает и удаление можно отменить
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 202 {object} models.ErasureInfo
+// @Failure 409 {object} AccountResponse "Удаление уже запланировано"
+// @router /erasure [post]
+func (a *AccountController) RequestErasure() {
+	auth := AuthController{Controller: a.Controller}
+	info, err := models.RequestErasure(auth.Principal(), ClientIP(a.Ctx))
+	if err != nil {
+		if errors.Is(err, models.ErrErasurePending) {
+			a.Ctx.Output.SetStatus(409)
+		} else {
+			a.Ctx.Output.SetStatus(500)
+		}
+		a.Data["json"] = AccountResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	a.Ctx.Output.SetStatus(202)
+	a.Data["json"] = AccountResponse{Err: false, Data: info}
+	a.ServeJSON()
+}
+
+// @Title CancelErasure
+// @Description Отмена запланированного удаления аккаунта
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} AccountResponse
+// @Failure 404 {object} AccountResponse "Удаление не запланировано"
+// @router /erasure [delete]
+func (a *AccountController) CancelErasure() {
+	auth := AuthController{Controller: a.Controller}
+	if err := models.CancelErasure(auth.Principal(), ClientIP(a.Ctx)); err != nil {
+		if errors.Is(err, models.ErrNoErasurePending) {
+			a.Ctx.Output.SetStatus(404)
+		} else {
+			a.Ctx.Output.SetStatus(500)
+		}
+		a.Data["json"] = AccountResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	a.Data["json"] = AccountResponse{Err: false, Data: "Удаление аккаунта отменено"}
+	a.ServeJSON()
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"api/models"
+	"errors"
+	"time"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Администрирование аккаунтов и компаний
+type AdminController struct {
+	beego.Controller
+}
+
+type AdminResponse struct {
+	Err  bool `json:"err"`
+	Data any  `json:"data"`
+}
+
+var adminAccess = AccessRules{
+	"ListUsers":           {Permission: models.PermUsersRead},
+	"BlockUser":           {Permission: models.PermUsersManage},
+	"UnblockUser":         {Permission: models.PermUsersManage},
+	"ListOwners":          {Permission: models.PermOwnersRead},
+	"BlockOwner":          {Permission: models.PermOwnersManage},
+	"UnblockOwner":        {Permission: models.PermOwnersManage},
+	"ResetOwnerMFA":       {Permission: models.PermOwnersManage},
+	"ListCompanies":       {Permission: models.PermCompaniesManage},
+	"BlockCompany":        {Permission: models.PermCompaniesManage},
+	"UnblockCompany":      {Permission: models.PermCompaniesManage},
+	"ListGeocodeJobs":     {Permission: models.PermCompaniesManage},
+	"RetryGeocode":        {Permission: models.PermCompaniesManage},
+	"RetryFailedGeocodes": {Permission: models.PermCompaniesManage},
+	"ListAudit":           {Permission: models.PermAuditRead},
+}
+
+func (a *AdminController) HandlerFunc(action string) bool {
+	auth := AuthController{Controller: a.Controller}
+	return auth.Require(adminAccess, action)
+}
+
+// page читает limit/offset из query (limit по умолчанию 50, не больше 200)
+func (a *AdminController) page() (int, int) {
+	limit, _ := a.GetInt("limit", 50)
+	offset, _ := a.GetInt("offset", 0)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+func (a *AdminController) serveList(list any, err error) {
+	if err != nil {
+		a.Ctx.Output.SetStatus(500)
+		a.Data["json"] = AdminResponse{Err: true, Data: err.Error()}
+	} else {
+		a.Data["json"] = AdminResponse{Err: false, Data: list}
+	}
+	a.ServeJSON()
+}
+
+func (a *AdminController) setBlocked(set func(int64, bool, models.Actor) error, blocked bool) {
+	id, err := a.GetInt64(":id")
+	if err != nil {
+		a.Ctx.Output.SetStatus(400)
+		a.Data["json"] = AdminResponse{Err: true, Data: "Invalid ID"}
+		a.ServeJSON()
+		return
+	}
+
+	if err := set(id, blocked, requestActor(a.Ctx)); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			a.Ctx.Output.SetStatus(404)
+		} else {
+			a.Ctx.Output.SetStatus(500)
+		}
+		a.Data["json"] = AdminResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	status := "unblocked"
+	if blocked {
+		status = "blocked"
+	}
+	a.Data["json"] = AdminResponse{Err: false, Data: models.StatusResponse{Status: status}}
+	a.ServeJSON()
+}
+
+// @Title ListUsers
+// @Description Список посетителей, включая заблокированных
+// @Param Authorization header string true "Токен с разрешением users:manage" default(Bearer <Add access token here>)
+// @Param limit query int false "Количество записей (по умолчанию 50, максимум 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} AdminResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @router /users [get]
+func (a *AdminController) ListUsers() {
+	limit, offset := a.page()
+	a.serveList(models.ListUsers(limit, offset))
+}
+
+// @Title BlockUser
+// @Description Заблокировать посетителя и завершить все его сессии
+// @Param Authorization header string true "Токен с разрешением users:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID посетителя"
+// @Success 200 {object} AdminResponse "status: blocked"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "User not found"
+// @router /users/:id/block [post]
+func (a *AdminController) BlockUser() {
+	a.setBlocked(models.SetUserBlocked, true)
+}
+
+// @Title UnblockUser
+// @Description Разблокировать посетителя
+// @Param Authorization header string true "Токен с разрешением users:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID посетителя"
+// @Success 200 {object} AdminResponse "status: unblocked"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "User not found"
+// @router /users/:id/unblock [post]
+func (a *AdminController) UnblockUser() {
+	a.setBlocked(models.SetUserBlocked, false)
+}
+
+// @Title ListOwners
+// @Description Список владельцев, включая заблокированных
+// @Param Authorization header string true "Токен с разрешением owners:manage" default(Bearer <Add access token here>)
+// @Param limit query int false "Количество записей (по умолчанию 50, максимум 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} AdminResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @router /owners [get]
+func (a *AdminController) ListOwners() {
+	limit, offset := a.page()
+	a.serveList(models.ListOwners(limit, offset))
+}
+
+// @Title BlockOwner
+// @Description Заблокировать владельца и завершить все его сессии
+// @Param Authorization header string true "Токен с разрешением owners:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID владельца"
+// @Success 200 {object} AdminResponse "status: blocked"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "Owner not found"
+// @router /owners/:id/block [post]
+func (a *AdminController) BlockOwner() {
+	a.setBlocked(models.SetOwnerBlocked, true)
+}
+
+// @Title UnblockOwner
+// @Description Разблокировать владельца
+// @Param Authorization header string true "Токен с разрешением owners:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID владельца"
+// @Success 200 {object} AdminResponse "status: unblocked"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "Owner not found"
+// @router /owners/:id/unblock [post]
+func (a *AdminController) UnblockOwner() {
+	a.setBlocked(models.SetOwnerBlocked, false)
+}
+
+// @Title ResetOwnerMFA
+// @Description Сбросить 2FA владельца (потерян телефон и коды восстановления); следующий вход — только по паролю
+// @Param Authorization header string true "Токен с разрешением owners:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID владельца"
+// @Success 200 {object} AdminResponse "status: mfa_reset"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "Owner not found"
+// @router /owners/:id/mfa/reset [post]
+func (a *AdminController) ResetOwnerMFA() {
+	id, err := a.GetInt64(":id")
+	if err != nil {
+		a.Ctx.Output.SetStatus(400)
+		a.Data["json"] = AdminResponse{Err: true, Data: "Invalid ID"}
+		a.ServeJSON()
+		return
+	}
+
+	auth := AuthController{Controller: a.Controller}
+	if err := models.ResetOwnerMFA(id, auth.Principal()); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			a.Ctx.Output.SetStatus(404)
+		} else {
+			a.Ctx.Output.SetStatus(500)
+		}
+		a.Data["json"] = AdminResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	a.Data["json"] = AdminResponse{Err: false, Data: models.StatusResponse{Status: "mfa_reset"}}
+	a.ServeJSON()
+}
+
+// @Title ListCompanies
+// @Description Список компаний, включая заблокированные
+// @Param Authorization header string true "Токен с разрешением companies:manage" default(Bearer <Add access token here>)
+// @Param limit query int false "Количество записей (по умолчанию 50, максимум 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} AdminResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @router /companies [get]
+func (a *AdminController) ListCompanies() {
+	limit, offset := a.page()
+	a.serveList(models.ListCompaniesForAdmin(limit, offset))
+}
+
+// @Title BlockCompany
+// @Description Заблокировать компанию: она исчезает из публичных списков
+// @Param Authorization header string true "Токен с разрешением companies:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID компании"
+// @Success 200 {object} AdminResponse "status: blocked"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "Company not found"
+// @router /companies/:id/block [post]
+func (a *AdminController) BlockCompany() {
+	a.setBlocked(models.SetCompanyBlocked, true)
+}
+
+// @Title UnblockCompany
+// @Description Разблокировать компанию
+// @Param Authorization header string true "Токен с разрешением companies:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID компании"
+// @Success 200 {object} AdminResponse "status: unblocked"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "Company not found"
+// @router /companies/:id/unblock [post]
+func (a *AdminController) UnblockCompany() {
+	a.setBlocked(models.SetCompanyBlocked, false)
+}
+
+// @Title ListGeocodeJobs
+// @Description Очередь геокодирования компаний: статус, число попыток, время следующей попытки и последняя ошибка. Сначала недавно изменённые
+// @Param Authorization header string true "Токен с разрешением companies:manage" default(Bearer <Add access token here>)
+// @Param status query string false "pending, running, ok или failed"
+// @Param limit query int false "Количество записей (по умолчанию 50, максимум 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} AdminResponse
+// @Failure 400 {object} AdminResponse "Неверный статус"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @router /geocode/jobs [get]
+func (a *AdminController) ListGeocodeJobs() {
+	limit, offset := a.page()
+	jobs, err := models.ListGeocodeJobs(a.GetString("status"), limit, offset)
+	if errors.Is(err, models.ErrInvalidGeocodeStatus) {
+		a.badFilter(err.Error())
+		return
+	}
+	a.serveList(jobs, err)
+}
+
+// @Title RetryGeocode
+// @Description Геокодировать компанию заново: задача возвращается в очередь с нулевым счётчиком попыток
+// @Param Authorization header string true "Токен с разрешением companies:manage" default(Bearer <Add access token here>)
+// @Param id path int true "ID компании"
+// @Success 200 {object} AdminResponse "status: pending"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @Failure 404 {object} AdminResponse "Company not found"
+// @router /companies/:id/geocode/retry [post]
+func (a *AdminController) RetryGeocode() {
+	id, err := a.GetInt64(":id")
+	if err != nil {
+		a.Ctx.Output.SetStatus(400)
+		a.Data["json"] = AdminResponse{Err: true, Data: "Invalid ID"}
+		a.ServeJSON()
+		return
+	}
+
+	if err := models.RetryGeocode(id, requestActor(a.Ctx)); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			a.Ctx.Output.SetStatus(404)
+		} else {
+			a.Ctx.Output.SetStatus(500)
+		}
+		a.Data["json"] = AdminResponse{Err: true, Data: err.Error()}
+		a.ServeJSON()
+		return
+	}
+
+	a.Data["json"] = AdminResponse{Err: false, Data: models.StatusResponse{Status: models.GeocodePending}}
+	a.ServeJSON()
+}
+
+// @Title RetryFailedGeocodes
+// @Description Вернуть в очередь все задачи геокодирования в статусе failed (например, после сбоя провайдера)
+// @Param Authorization header string true "Токен с разрешением companies:manage" default(Bearer <Add access token here>)
+// @Success 200 {object} AdminResponse "retried: число задач"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @router /geocode/jobs/retry [post]
+func (a *AdminController) RetryFailedGeocodes() {
+	n, err := models.RetryFailedGeocodes(requestActor(a.Ctx))
+	a.serveList(map[string]int64{"retried": n}, err)
+}
+
+// @Title ListAudit
+// @Description Журнал аудита: кто, когда и что изменил, с разницей полей до и после. Новые записи первыми
+// @Param Authorization header string true "Токен с разрешением audit:read" default(Bearer <Add access token here>)
+// @Param actor_type query string false "Тип инициатора: visitor, owner, system"
+// @Param actor_id query int false "ID инициатора"
+// @Param entity_type query string false "Тип сущности: company, owner, visitor, ..."
+// @Param entity_id query string false "ID сущности"
+// @Param action query string false "Действие, например company.update"
+// @Param request_id query string false "Идентификатор запроса (X-Request-ID)"
+// @Param from query string false "Начало периода, RFC 3339"
+// @Param to query string false "Конец периода (не включая), RFC 3339"
+// @Param limit query int false "Количество записей (по умолчанию 50, максимум 200)"
+// @Param offset query int false "Смещение"
+// @Success 200 {object} AdminResponse
+// @Failure 400 {object} AdminResponse "Неверный фильтр"
+// @Failure 403 {object} types.Problem "Missing permission"
+// @router /audit [get]
+func (a *AdminController) ListAudit() {
+	filter := models.AuditFilter{
+		ActorType:  a.GetString("actor_type"),
+		EntityType: a.GetString("entity_type"),
+		EntityId:   a.GetString("entity_id"),
+		Action:     a.GetString("action"),
+		RequestId:  a.GetString("request_id"),
+	}
+
+	var err error
+	if filter.ActorId, err = a.GetInt64("actor_id", 0); err != nil {
+		a.badFilter("actor_id must be an integer")
+		return
+	}
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := a.GetString(param)
+		if value == "" {
+			continue
+		}
+		if *t, err = time.Parse(time.RFC3339, value); err != nil {
+			a.badFilter(param + " must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	limit, offset := a.page()
+	a.serveList(models.ListAudit(filter, limit, offset))
+}
+
+func (a *AdminController) badFilter(msg string) {
+	a.Ctx.Output.SetStatus(400)
+	a.Data["json"] = AdminResponse{Err: true, Data: msg}
+	a.ServeJSON()
+}
@@ -5,44 +5,139 @@ import (
 
 	"api/models"
 	"github.com/beego/beego/v2/server/web"
+	"github.com/beego/beego/v2/server/web/context"
 )
 
 type AuthController struct {
 	web.Controller
 }
 
+// Access описывает требования к действию контроллера
+type Access struct {
+	Role       string // роль токена (аудитория); пусто — подходит любая
+	Permission string // разрешение; пусто — достаточно аутентификации
+	Verified   bool   // действие доступно только аккаунтам с подтверждённой почтой
+	Scope      string // область API-ключа для действия; пусто — только по токену входа
+}
+
+// AccessRules — требования к действиям контроллера по имени метода.
+// Действия, которых нет в списке, доступны анонимно.
+type AccessRules map[string]Access
+
+// AuthFilter проверяет Bearer-токен любой роли или API-ключ владельца и кладёт Principal
+// в контекст запроса. Запрос без токена или с недействительным токеном остаётся анонимным:
+// решение об отказе принимает AuthController.Require.
+func AuthFilter(ctx *context.Context) {
+	authHeader := ctx.Input.Header("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return
+	}
+
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	authenticate := models.Authenticate
+	if models.IsAPIKey(token) {
+		authenticate = models.AuthenticateAPIKey
+	}
+
+	principal, err := authenticate(token)
+	if err != nil {
+		return
+	}
+	if err := models.CheckSession(principal); err != nil {
+		return
+	}
+
+	ctx.Request = ctx.Request.WithContext(models.ContextWithPrincipal(ctx.Request.Context(), principal))
+}
+
+// Principal возвращает субъекта, аутентифицированного AuthFilter, или nil
+func (a *AuthController) Principal() *models.Principal {
+	return models.PrincipalFromContext(a.Ctx.Request.Context())
+}
+
 // CheckAuth проверяет авторизацию пользователя
 func (a *AuthController) CheckAuth() bool {
-	authHeader := a.Ctx.Input.Header("Authorization")
-	if authHeader == "" {
+	return a.requireRole(models.RoleVisitor)
+}
+
+// CheckOwnerAuth проверяет авторизацию владельца
+func (a *AuthController) CheckOwnerAuth() bool {
+	return a.requireRole(models.RoleOwner)
+}
+
+// Require проверяет требования rules к действию action: без нужной роли — 401,
+// без разрешения, подтверждённой почты или области API-ключа — 403 в формате problem+json
+func (a *AuthController) Require(rules AccessRules, action string) bool {
+	access, ok := rules[action]
+	if !ok {
+		return false
+	}
+
+	if access.Role != "" {
+		if a.requireRole(access.Role) {
+			return true
+		}
+	} else if a.Principal() == nil {
 		a.Abort("401")
 		return true
 	}
 
-	accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := models.VerifyToken(accessToken)
-	if err != nil || claims == nil {
-		a.Abort("401")
+	if principal := a.Principal(); principal.APIKeyID != 0 {
+		if access.Scope == "" {
+			abortProblem(&a.Controller, 403, "API keys are not accepted for this action")
+			return true
+		}
+		if !principal.HasScope(access.Scope) {
+			abortProblem(&a.Controller, 403, "API key is missing scope "+access.Scope)
+			return true
+		}
+	}
+
+	if access.Permission != "" && !a.Principal().Can(access.Permission) {
+		abortProblem(&a.Controller, 403, "Missing permission "+access.Permission)
+		return true
+	}
+
+	if access.Verified && !a.Principal().EmailVerified {
+		abortProblem(&a.Controller, 403, "Email address is not verified")
 		return true
 	}
 
 	return false
 }
 
-// CheckOwnerAuth проверяет авторизацию пользователя
-func (a *AuthController) CheckOwnerAuth() bool {
-	authHeader := a.Ctx.Input.Header("Authorization")
-	if authHeader == "" {
+// requireRole требует субъекта роли role. Токен аккаунта с профилем этой роли
+// подходит тоже: дальше запрос обрабатывается от имени профиля.
+func (a *AuthController) requireRole(role string) bool {
+	principal := a.Principal()
+	if principal == nil {
 		a.Abort("401")
 		return true
 	}
 
-	accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := models.VerifyOwnerToken(accessToken)
-	if err != nil || claims == nil {
+	profile, ok := principal.As(role)
+	if !ok {
 		a.Abort("401")
 		return true
 	}
+	if profile != principal {
+		a.Ctx.Request = a.Ctx.Request.WithContext(models.ContextWithPrincipal(a.Ctx.Request.Context(), profile))
+	}
 
 	return false
 }
+
+// editableProfile возвращает ID профиля роли role, который изменяет запрос: requested или, если он
+// не указан, собственный профиль субъекта. Свой профиль субъект меняет всегда, чужой — только
+// с разрешением manage; иначе 403.
+func (a *AuthController) editableProfile(role, manage string, requested int64) int64 {
+	principal := a.Principal()
+	if own, ok := principal.As(role); ok && (requested == 0 || requested == own.ID) {
+		return own.ID
+	}
+	if requested != 0 && principal.Can(manage) {
+		return requested
+	}
+	abortProblem(&a.Controller, 403, "Only the account itself or a holder of "+manage+" can change it")
+	return 0
+}
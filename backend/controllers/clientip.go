@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"api/models"
+	"net"
+	"strings"
+	"sync"
+
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+var (
+	trustedProxies     []*net.IPNet
+	trustedProxiesOnce sync.Once
+)
+
+// loadTrustedProxies разбирает trusted_proxies из app.conf: список IP или CIDR через запятую
+func loadTrustedProxies() {
+	for _, entry := range strings.Split(beego.AppConfig.DefaultString("trusted_proxies", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			trustedProxies = append(trustedProxies, network)
+		}
+	}
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP возвращает адрес клиента. X-Forwarded-For учитывается только от доверенных
+// прокси (trusted_proxies): иначе клиент мог бы подставить любой адрес.
+// Берётся крайний правый адрес цепочки, не принадлежащий доверенным прокси.
+func ClientIP(ctx *context.Context) string {
+	trustedProxiesOnce.Do(loadTrustedProxies)
+
+	remote, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil {
+		remote = ctx.Request.RemoteAddr
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	hops := strings.Split(ctx.Input.Header("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop != "" && !isTrustedProxy(hop) {
+			return hop
+		}
+	}
+	return remote
+}
+
+// sessionClient описывает устройство запроса для записи сессии входа
+func sessionClient(ctx *context.Context) models.SessionClient {
+	return models.SessionClient{
+		UserAgent: ctx.Input.UserAgent(),
+		IP:        ClientIP(ctx),
+	}
+}
+
+// requestActor — инициатор изменения для журнала аудита: субъект запроса (если есть), IP и X-Request-ID
+func requestActor(ctx *context.Context) models.Actor {
+	actor := models.Actor{IP: ClientIP(ctx), RequestID: RequestID(ctx)}
+	if p := models.PrincipalFromContext(ctx.Request.Context()); p != nil {
+		actor.Type, actor.ID, actor.APIKeyID, actor.SessionID = p.Role, p.ID, p.APIKeyID, p.SessionID
+	}
+	return actor
+}
@@ -15,6 +15,27 @@ type CompanyController struct {
 	web.Controller
 }
 
+var companyAccess = AccessRules{
+	"Post":                {Role: models.RoleOwner, Permission: models.PermCompaniesWrite, Verified: true, Scope: models.ScopeCompaniesWrite},
+	"Put":                 {Role: models.RoleOwner, Permission: models.PermCompaniesWrite, Verified: true, Scope: models.ScopeCompaniesWrite},
+	"Delete":              {Role: models.RoleOwner, Permission: models.PermCompaniesWrite, Verified: true, Scope: models.ScopeCompaniesWrite},
+	"GenerateDescription": {Role: models.RoleOwner, Permission: models.PermCompaniesWrite, Verified: true, Scope: models.ScopeCompaniesWrite},
+	"UpdateDescription":   {Role: models.RoleOwner, Permission: models.PermCompaniesWrite, Verified: true, Scope: models.ScopeCompaniesWrite},
+}
+
+func (c *CompanyController) HandlerFunc(action string) bool {
+	auth := AuthController{Controller: c.Controller}
+	return auth.Require(companyAccess, action)
+}
+
+// authorizeMutation прерывает запрос с 403, если компанией владеет не текущий владелец
+func (c *CompanyController) authorizeMutation(company *models.Company) {
+	auth := AuthController{Controller: c.Controller}
+	if err := models.AuthorizeCompanyMutation(auth.Principal(), company); err != nil {
+		abortProblem(&c.Controller, 403, "Company belongs to another owner")
+	}
+}
+
 type DescriptionGenerator interface {
 	GenerateCompanyDescription(name, businessSphere string) (string, error)
 }
@@ -26,9 +47,12 @@ func isValidINN(inn string) bool {
 
 // @Title GenerateCompanyDescription
 // @Description Генерация описания компании по ID компании с автоматическим сохранением
+// @Param Authorization header string true "Токен владельца" default(Bearer <Add access token here>)
 // @Param id path int true "ID компании"
 // @Success 200 {object} models.Company
 // @Failure 400 {string} string "Invalid company ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Company belongs to another owner"
 // @Failure 404 {string} string "Company not found"
 // @Failure 500 {string} string "Generation failed"
 // @router /:id/generate-description [get]
@@ -50,6 +74,7 @@ func (c *CompanyController) GenerateDescription() {
 		}
 		return
 	}
+	c.authorizeMutation(company)
 
 	if company.Name == "" || company.BusinessSphere == "" {
 		c.CustomAbort(400, "Company name or business sphere is empty")
@@ -66,7 +91,7 @@ func (c *CompanyController) GenerateDescription() {
 	}
 
 	company.Description = description
-	if err := models.UpdateCompany(company); err != nil {
+	if err := models.UpdateCompany(company, requestActor(c.Ctx)); err != nil {
 		c.CustomAbort(500, "Failed to save generated description: "+err.Error())
 		return
 	}
@@ -77,10 +102,13 @@ func (c *CompanyController) GenerateDescription() {
 
 // @Title UpdateCompanyDescription
 // @Description Ручное обновление описания компании по ID
+// @Param Authorization header string true "Токен владельца" default(Bearer <Add access token here>)
 // @Param id path int true "ID компании"
 // @Param description body models.ManualDescriptionRequest true "Описание компании"
 // @Success 200 {object} models.Company
 // @Failure 400 {string} string "Invalid company ID or description"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Company belongs to another owner"
 // @Failure 404 {string} string "Company not found"
 // @Failure 500 {string} string "Failed to update company description"
 // @router /:id/update-description [put]
@@ -116,9 +144,10 @@ func (c *CompanyController) UpdateDescription() {
 		}
 		return
 	}
+	c.authorizeMutation(company)
 
 	company.Description = request.Description
-	if err := models.UpdateCompany(company); err != nil {
+	if err := models.UpdateCompany(company, requestActor(c.Ctx)); err != nil {
 		c.CustomAbort(500, "Failed to update company description: "+err.Error())
 		return
 	}
@@ -128,10 +157,12 @@ func (c *CompanyController) UpdateDescription() {
 }
 
 // @Title CreateCompany
-// @Description Создание компании
+// @Description Создание компании от имени владельца из токена
+// @Param Authorization header string true "Токен владельца" default(Bearer <Add access token here>)
 // @Param body body models.PostCompanyRequest true "Данные компании"
 // @Success 200 {object} models.PostCompanyResponse "ID созданной компании"
 // @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unauthorized"
 // @router / [post]
 func (c *CompanyController) Post() {
 	var req models.PostCompanyRequest
@@ -152,8 +183,9 @@ func (c *CompanyController) Post() {
 		}
 	}
 
+	auth := AuthController{Controller: c.Controller}
 	company := models.Company{
-		Owner:            &models.Owner{Id: req.OwnerID},
+		Owner:            &models.Owner{Id: auth.Principal().ID},
 		Name:             req.Name,
 		INN:              req.INN,
 		OrganizationType: req.OrganizationType,
@@ -163,7 +195,7 @@ func (c *CompanyController) Post() {
 		BusinessSphere:   req.BusinessSphere,
 	}
 
-	id, err := models.AddCompany(company)
+	id, err := models.AddCompany(company, requestActor(c.Ctx))
 	if err != nil {
 		c.CustomAbort(400, err.Error())
 		return
@@ -193,6 +225,11 @@ func (c *CompanyController) Get() {
 		c.CustomAbort(404, err.Error())
 		return
 	}
+	auth := AuthController{Controller: c.Controller}
+	if !models.CanViewCompany(auth.Principal(), company) {
+		c.CustomAbort(404, "Company with this id not found")
+		return
+	}
 
 	c.Data["json"] = company
 	c.ServeJSON()
@@ -200,10 +237,13 @@ func (c *CompanyController) Get() {
 
 // @Title UpdateCompany
 // @Description Обновить данные компании
+// @Param Authorization header string true "Токен владельца" default(Bearer <Add access token here>)
 // @Param id path int true "ID компании"
 // @Param body body models.PostCompanyRequest true "Данные для обновления"
 // @Success 200 {object} models.StatusResponse "status: updated"
 // @Failure 400 {string} string "Invalid input or ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Company belongs to another owner"
 // @Failure 404 {string} string "Company not found"
 // @Failure 500 {string} string "Update failed"
 // @router /:id [put]
@@ -226,6 +266,7 @@ func (c *CompanyController) Put() {
 		c.CustomAbort(404, err.Error())
 		return
 	}
+	c.authorizeMutation(company)
 
 	company.Name = req.Name
 	company.City = req.City
@@ -233,7 +274,7 @@ func (c *CompanyController) Put() {
 	company.OrganizationType = req.OrganizationType
 	company.BusinessSphere = req.BusinessSphere
 
-	if err := models.UpdateCompany(company); err != nil {
+	if err := models.UpdateCompany(company, requestActor(c.Ctx)); err != nil {
 		c.CustomAbort(500, err.Error())
 		return
 	}
@@ -244,9 +285,13 @@ func (c *CompanyController) Put() {
 
 // @Title DeleteCompany
 // @Description Удалить компанию по ID
+// @Param Authorization header string true "Токен владельца" default(Bearer <Add access token here>)
 // @Param id path int true "ID компании"
 // @Success 200 {object} models.StatusResponse "status: deleted"
 // @Failure 400 {string} string "Invalid ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Company belongs to another owner"
+// @Failure 404 {string} string "Company not found"
 // @Failure 500 {string} string "Delete failed"
 // @router /:id [delete]
 func (c *CompanyController) Delete() {
@@ -257,52 +302,41 @@ func (c *CompanyController) Delete() {
 		return
 	}
 
-	if err := models.DeleteCompany(id); err != nil {
-		c.CustomAbort(500, err.Error())
+	company, err := models.GetCompany(id)
+	if err != nil {
+		c.CustomAbort(404, err.Error())
 		return
 	}
+	c.authorizeMutation(company)
 
-	c.Data["json"] = models.StatusResponse{Status: "deleted"}
-	c.ServeJSON()
-}
-
-// @Title GetAllCompanies
-// @Description Получить список всех компаний
-// @Success 200 {array} models.Company
-// @Failure 500 {string} string "Internal server error"
-// @router / [get]
-func (c *CompanyController) GetAll() {
-	companies, err := models.GetAllCompanies()
-	if err != nil {
+	if err := models.DeleteCompany(company.Id, requestActor(c.Ctx)); err != nil {
 		c.CustomAbort(500, err.Error())
 		return
 	}
 
-	c.Data["json"] = companies
+	c.Data["json"] = models.StatusResponse{Status: "deleted"}
 	c.ServeJSON()
 }
 
-// @Title GetOwnerCompanies
-// @Description Получить все компании по ID владельца
-// @Param owner_id path int true "ID владельца"
+// @Title GetAllCompanies
+// @Description Список компаний с курсорной пагинацией, фильтрами и сортировкой. Общее число подходящих компаний — в заголовке X-Total-Count, ссылки на первую и следующую страницы — в заголовке Link.
+// @Param city query string false "Город"
+// @Param business_sphere query string false "Сфера деятельности"
+// @Param organization_type query string false "Тип организации"
+// @Param owner query int false "ID владельца"
+// @Param has_coordinates query bool false "Только с координатами (true) или без них (false)"
+// @Param created_from query string false "Созданы не раньше (RFC 3339)"
+// @Param created_to query string false "Созданы раньше (RFC 3339)"
+// @Param sort query string false "id, name или created_at; -поле — по убыванию (по умолчанию -id)"
+// @Param limit query int false "Размер страницы (по умолчанию 50, не больше 200)"
+// @Param cursor query string false "Курсор следующей страницы из заголовка Link"
 // @Success 200 {array} models.Company
-// @Failure 400 {string} string "Invalid owner ID"
+// @Failure 400 {string} string "Invalid filter, sort or cursor"
 // @Failure 500 {string} string "Internal server error"
 // @router / [get]
-func (c *CompanyController) GetOwnerCompanies() {
-	ownerIdStr := c.Ctx.Input.Param(":owner_id")
-	ownerId, err := strconv.ParseInt(ownerIdStr, 10, 64)
-	if err != nil {
-		c.CustomAbort(400, "Invalid owner ID")
-		return
-	}
-
-	companies, err := models.GetOwnerCompanies(ownerId)
-	if err != nil {
-		c.CustomAbort(500, err.Error())
-		return
-	}
+func (c *CompanyController) GetAll() {
+	page := listCompanies(&c.Controller)
 
-	c.Data["json"] = companies
+	c.Data["json"] = page.Items
 	c.ServeJSON()
 }
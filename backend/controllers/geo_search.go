@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"api/models"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// geoPoint читает обязательные lat и lon из строки запроса
+func (c *GeoController) geoPoint() models.GeoPoint {
+	lat, errLat := strconv.ParseFloat(c.GetString("lat"), 64)
+	lon, errLon := strconv.ParseFloat(c.GetString("lon"), 64)
+	if errLat != nil || errLon != nil {
+		c.CustomAbort(400, "lat and lon are required numbers")
+	}
+	return models.GeoPoint{Lat: lat, Lon: lon}
+}
+
+// geoFilters читает фильтры списка компаний, применимые к геопоиску
+func (c *GeoController) geoFilters() models.CompanyListParams {
+	params, err := companyListParams(&c.Controller)
+	if err != nil {
+		c.CustomAbort(400, err.Error())
+	}
+	return params
+}
+
+// abortGeoError отвечает 400 на неверные параметры геопоиска и 500 на прочие ошибки
+func (c *GeoController) abortGeoError(err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidPoint), errors.Is(err, models.ErrInvalidRadius),
+		errors.Is(err, models.ErrInvalidBBox), errors.Is(err, models.ErrInvalidZoom),
+		errors.Is(err, models.ErrGeoTooDense):
+		c.CustomAbort(400, err.Error())
+	case err != nil:
+		c.CustomAbort(500, "Failed to get companies: "+err.Error())
+	}
+}
+
+// @Title Companies Within Radius
+// @Description Компании в радиусе от точки, ближние первыми, с расстоянием в метрах. Общее число компаний в радиусе — в заголовке X-Total-Count. Принимает фильтры city, business_sphere, organization_type, owner, created_from, created_to.
+// @Param lat query number true "Широта центра"
+// @Param lon query number true "Долгота центра"
+// @Param radius query number true "Радиус в метрах (не больше geo_max_radius; при числе компаний в области больше geo_candidates_max — 400)"
+// @Param limit query int false "Число компаний (по умолчанию 50, не больше 500)"
+// @Success 200 {array} models.GeoCompany
+// @Failure 400 {string} string "Invalid point or radius"
+// @Failure 500 {string} string "Failed to get companies"
+// @router /geo/radius [get]
+func (c *GeoController) WithinRadius() {
+	center := c.geoPoint()
+	radius, err := c.GetFloat("radius")
+	if err != nil {
+		c.CustomAbort(400, "radius is a required number of meters")
+	}
+	limit, err := c.GetInt("limit", models.GeoLimitDefault)
+	if err != nil {
+		c.CustomAbort(400, "limit must be an integer")
+	}
+
+	companies, total, err := models.CompaniesWithinRadius(c.geoFilters(), center, radius, limit)
+	c.abortGeoError(err)
+
+	c.Ctx.Output.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+	c.Data["json"] = companies
+	c.ServeJSON()
+}
+
+// @Title Nearest Companies
+// @Description N ближайших к точке компаний с расстоянием в метрах; дальше geo_max_radius не ищутся. Принимает фильтры city, business_sphere, organization_type, owner, created_from, created_to.
+// @Param lat query number true "Широта"
+// @Param lon query number true "Долгота"
+// @Param n query int false "Число компаний (по умолчанию 50, не больше 500)"
+// @Success 200 {array} models.GeoCompany
+// @Failure 400 {string} string "Invalid point"
+// @Failure 500 {string} string "Failed to get companies"
+// @router /geo/nearest [get]
+func (c *GeoController) Nearest() {
+	center := c.geoPoint()
+	n, err := c.GetInt("n", models.GeoLimitDefault)
+	if err != nil {
+		c.CustomAbort(400, "n must be an integer")
+	}
+
+	companies, err := models.NearestCompanies(c.geoFilters(), center, n)
+	c.abortGeoError(err)
+
+	c.Data["json"] = companies
+	c.ServeJSON()
+}
+
+// @Title Companies In Bounding Box
+// @Description Компании в видимой области карты. Общее число компаний в области — в заголовке X-Total-Count. Принимает фильтры city, business_sphere, organization_type, owner, created_from, created_to.
+// @Param bbox query string true "Область: west,south,east,north в градусах (west > east — через 180-й меридиан)"
+// @Param limit query int false "Число компаний (по умолчанию 50, не больше 500)"
+// @Success 200 {array} models.GeoCompany
+// @Failure 400 {string} string "Invalid bbox"
+// @Failure 500 {string} string "Failed to get companies"
+// @router /geo/bbox [get]
+func (c *GeoController) InBBox() {
+	box, err := parseBBox(c.GetString("bbox"))
+	if err != nil {
+		c.CustomAbort(400, err.Error())
+	}
+	limit, err := c.GetInt("limit", models.GeoLimitDefault)
+	if err != nil {
+		c.CustomAbort(400, "limit must be an integer")
+	}
+
+	companies, total, err := models.CompaniesInBBox(c.geoFilters(), box, limit)
+	c.abortGeoError(err)
+
+	c.Ctx.Output.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+	c.Data["json"] = companies
+	c.ServeJSON()
+}
+
+// parseBBox разбирает "west,south,east,north"
+func parseBBox(value string) (models.BBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return models.BBox{}, models.ErrInvalidBBox
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return models.BBox{}, models.ErrInvalidBBox
+		}
+		coords[i] = f
+	}
+	return models.BBox{West: coords[0], South: coords[1], East: coords[2], North: coords[3]}, nil
+}
+
+// @Title Map Clusters
+// @Description Кластеры компаний в видимой области карты на заданном масштабе: число компаний, центр, охватывающий прямоугольник и самые частые сферы деятельности. Одиночные компании и все компании на масштабе от map_cluster_max_zoom возвращаются точками.
+// @Param bbox query string true "Область: west,south,east,north в градусах (west > east — через 180-й меридиан)"
+// @Param zoom query int true "Масштаб карты, 0–22"
+// @Success 200 {object} models.MapClusters
+// @Failure 400 {string} string "Invalid bbox or zoom"
+// @Failure 500 {string} string "Failed to get companies"
+// @router /geo/clusters [get]
+func (c *GeoController) Clusters() {
+	box, err := parseBBox(c.GetString("bbox"))
+	if err != nil {
+		c.CustomAbort(400, err.Error())
+	}
+	zoom, err := c.GetInt("zoom")
+	if err != nil {
+		c.CustomAbort(400, "zoom is a required integer")
+	}
+
+	clusters, err := models.ClusterCompanies(box, zoom)
+	c.abortGeoError(err)
+
+	c.Data["json"] = clusters
+	c.ServeJSON()
+}
+
+// Типы содержимого выгрузок
+const (
+	GeoJSONContentType = "application/geo+json"
+	KMLContentType     = "application/vnd.google-earth.kml+xml"
+)
+
+// exportCompanies возвращает компании для выгрузки по фильтрам запроса
+func (c *GeoController) exportCompanies() []models.Company {
+	companies, err := models.ExportCompanies(c.geoFilters())
+	c.abortGeoError(err)
+	return companies
+}
+
+// @Title Companies GeoJSON
+// @Description Компании с координатами в виде GeoJSON FeatureCollection (RFC 7946): точки [долгота, широта] и свойства компании. Подходит для QGIS и веб-карт. Принимает фильтры city, business_sphere, organization_type, owner, created_from, created_to.
+// @Success 200 {object} models.GeoJSONFeatureCollection
+// @Failure 400 {string} string "Invalid filter"
+// @Failure 500 {string} string "Failed to get companies"
+// @router /geo/companies.geojson [get]
+func (c *GeoController) CompaniesGeoJSON() {
+	body, err := json.Marshal(models.CompaniesGeoJSON(c.exportCompanies()))
+	if err != nil {
+		c.CustomAbort(500, "Failed to encode GeoJSON: "+err.Error())
+	}
+
+	c.Ctx.Output.Header("Content-Type", GeoJSONContentType+"; charset=utf-8")
+	_ = c.Ctx.Output.Body(body)
+}
+
+// @Title Companies KML
+// @Description Компании с координатами в виде документа KML 2.2: метка на каждую компанию, свойства — в ExtendedData. Принимает те же фильтры, что и GeoJSON.
+// @Success 200 {string} string "application/vnd.google-earth.kml+xml"
+// @Failure 400 {string} string "Invalid filter"
+// @Failure 500 {string} string "Failed to get companies"
+// @router /geo/companies.kml [get]
+func (c *GeoController) CompaniesKML() {
+	body, err := models.CompaniesKML(c.exportCompanies())
+	if err != nil {
+		c.CustomAbort(500, err.Error())
+	}
+
+	c.Ctx.Output.Header("Content-Type", KMLContentType+"; charset=utf-8")
+	_ = c.Ctx.Output.Body(body)
+}
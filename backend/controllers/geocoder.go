@@ -26,13 +26,15 @@ type GetCoordinatesResponse struct {
 	Latitude  string `json:"latitude"`
 	Longitude string `json:"longitude"`
 	Address   string `json:"address"`
+	// GeocodeStatus — pending (адрес в очереди геокодирования), ok или failed (адрес не найден)
+	GeocodeStatus string `json:"geocode_status"`
 }
 
 // @Title Get Coordinates by Company ID
 // @Description Возвращает координаты (широту и долготу) и адрес компании по её ID
 // @Param id path int true "ID компании"
 // @Success 200 {object} controllers.GetCoordinatesResponse
-// @Success 202 {object} controllers.GetCoordinatesResponse "Координаты еще не получены, начат процесс геокодирования"
+// @Success 202 {object} controllers.GetCoordinatesResponse "Координаты еще не получены, адрес в очереди геокодирования"
 // @Failure 400 {string} string "Invalid company ID"
 // @Failure 404 {string} string "Company not found"
 // @Failure 500 {string} string "Failed to get coordinates"
@@ -55,27 +57,42 @@ func (c *GeoController) GetCoordinatesByCompanyId() {
 		}
 		return
 	}
+	auth := AuthController{Controller: c.Controller}
+	if !models.CanViewCompany(auth.Principal(), company) {
+		c.CustomAbort(404, "Company not found")
+		return
+	}
 
 	// Если координаты уже есть - возвращаем их
 	if company.Lat != 0 && company.Lon != 0 {
 		fullAddress := fmt.Sprintf("%s, %s", company.City, company.Address)
 		res := GetCoordinatesResponse{
-			Latitude:  strconv.FormatFloat(company.Lat, 'f', 6, 64),
-			Longitude: strconv.FormatFloat(company.Lon, 'f', 6, 64),
-			Address:   fullAddress,
+			Latitude:      strconv.FormatFloat(company.Lat, 'f', 6, 64),
+			Longitude:     strconv.FormatFloat(company.Lon, 'f', 6, 64),
+			Address:       fullAddress,
+			GeocodeStatus: models.GeocodeOK,
 		}
 		c.Data["json"] = res
 		c.ServeJSON()
 		return
 	}
 
-	go func() {
-		models.UpdateCompanyCoordinates(company.Id, company.City, company.Address, company.Name)
-	}()
+	// Координат нет — ставим компанию в очередь, если её там ещё нет, и сообщаем состояние задачи
+	if err := models.RequestGeocode(company.Id); err != nil {
+		c.CustomAbort(500, "Failed to get coordinates: "+err.Error())
+	}
+	status, err := models.GeocodeStatus(company.Id)
+	if err != nil {
+		c.CustomAbort(500, "Failed to get coordinates: "+err.Error())
+	}
 
 	fullAddress := fmt.Sprintf("%s, %s", company.City, company.Address)
 	res := GetCoordinatesResponse{
-		Address: fullAddress,
+		Address:       fullAddress,
+		GeocodeStatus: status,
+	}
+	if status != models.GeocodeFailed {
+		c.Ctx.Output.SetStatus(202)
 	}
 
 	c.Data["json"] = res
@@ -100,19 +117,26 @@ type CompanyAddressResponse struct {
 }
 
 // @Title Get Coordinates for All Companies
-// @Description Возвращает координаты (широту и долготу) и адреса для всех компаний (первые 10)
+// @Description Возвращает координаты (широту и долготу) и адреса компаний. Поддерживает те же фильтры, сортировку и курсорную пагинацию, что и GET /v1/owner/company; общее число — в X-Total-Count, следующая страница — в Link.
+// @Param city query string false "Город"
+// @Param business_sphere query string false "Сфера деятельности"
+// @Param organization_type query string false "Тип организации"
+// @Param owner query int false "ID владельца"
+// @Param has_coordinates query bool false "Только с координатами (true) или без них (false)"
+// @Param created_from query string false "Созданы не раньше (RFC 3339)"
+// @Param created_to query string false "Созданы раньше (RFC 3339)"
+// @Param sort query string false "id, name или created_at; -поле — по убыванию (по умолчанию -id)"
+// @Param limit query int false "Размер страницы (по умолчанию 50, не больше 200)"
+// @Param cursor query string false "Курсор следующей страницы из заголовка Link"
 // @Success 200 {array} GeoController.GetAllCompaniesCoordinatesResponse
 // @Success 206 {array} GeoController.GetAllCompaniesCoordinatesResponse "Часть компаний не имеет координат (начат процесс геокодирования)"
+// @Failure 400 {string} string "Invalid filter, sort or cursor"
 // @Failure 404 {string} string "Companies not found"
 // @Failure 500 {string} string "Failed to get companies"
 // @router /geo/companies [get]
 func (c *GeoController) GetAllCompaniesCoordinates() {
-	// Получаем список компаний из модели
-	companies, err := models.GetAllCompanies()
-	if err != nil {
-		c.CustomAbort(500, "Failed to get companies: "+err.Error())
-		return
-	}
+	// Получаем страницу компаний по фильтрам запроса
+	companies := listCompanies(&c.Controller).Items
 
 	if len(companies) == 0 {
 		c.CustomAbort(404, "Companies not found")
@@ -138,15 +162,13 @@ func (c *GeoController) GetAllCompaniesCoordinates() {
 			item.Latitude = strconv.FormatFloat(company.Lat, 'f', 6, 64)
 			item.Longitude = strconv.FormatFloat(company.Lon, 'f', 6, 64)
 		} else {
-			logFields := map[string]interface{}{
-				"company_id": company.Id,
-				"db_lat":     company.Lat,
-				"db_lon":     company.Lon,
+			// Координат нет — ставим компанию в очередь, если её там ещё нет
+			if err := models.RequestGeocode(company.Id); err != nil {
+				logger.ErrorAny("Failed to enqueue company geocoding", map[string]interface{}{
+					"company_id": company.Id,
+					"error":      err.Error(),
+				})
 			}
-			//go models.UpdateCompanyCoordinates(company.Id, company.City, company.Address, company.Name)
-			logFields["lat"] = company.Lat
-			logFields["lon"] = company.Lon
-			logger.InfoAny("Company coordinates updated successfully", logFields)
 			hasMissingCoordinates = true
 		}
 
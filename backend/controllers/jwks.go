@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"api/models"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// Публикация открытых ключей подписи токенов
+type JWKSController struct {
+	web.Controller
+}
+
+// @Title JWKS
+// @Description Открытые ключи (RS256/EdDSA) для проверки токенов QWERTY.TOWN другими сервисами
+// @Success 200 {object} jwtkeys.JWKSet
+// @Failure 500 {string} string "Signing keys are not configured"
+// @router /.well-known/jwks.json [get]
+func (c *JWKSController) Get() {
+	jwks, err := models.JWKS()
+	if err != nil {
+		c.CustomAbort(500, "Signing keys are not configured")
+		return
+	}
+
+	c.Ctx.Output.Header("Cache-Control", "public, max-age=300")
+	c.Data["json"] = jwks
+	c.ServeJSON()
+}
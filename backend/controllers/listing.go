@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"api/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// TotalCountHeader — заголовок с числом компаний, подходящих под фильтры списка
+const TotalCountHeader = "X-Total-Count"
+
+// companyListParams читает из строки запроса фильтры, сортировку и курсор списка компаний
+func companyListParams(c *web.Controller) (models.CompanyListParams, error) {
+	params := models.CompanyListParams{
+		City:             c.GetString("city"),
+		BusinessSphere:   c.GetString("business_sphere"),
+		OrganizationType: c.GetString("organization_type"),
+		Sort:             c.GetString("sort"),
+		Cursor:           c.GetString("cursor"),
+	}
+
+	var err error
+	if params.OwnerID, err = c.GetInt64("owner", 0); err != nil {
+		return params, errors.New("owner must be an integer")
+	}
+	if params.Limit, err = c.GetInt("limit", models.CompanyPageDefault); err != nil {
+		return params, errors.New("limit must be an integer")
+	}
+	if value := c.GetString("has_coordinates"); value != "" {
+		has, err := strconv.ParseBool(value)
+		if err != nil {
+			return params, errors.New("has_coordinates must be true or false")
+		}
+		params.HasCoordinates = &has
+	}
+	for param, t := range map[string]*time.Time{"created_from": &params.CreatedFrom, "created_to": &params.CreatedTo} {
+		value := c.GetString(param)
+		if value == "" {
+			continue
+		}
+		if *t, err = time.Parse(time.RFC3339, value); err != nil {
+			return params, errors.New(param + " must be an RFC 3339 timestamp")
+		}
+	}
+	return params, nil
+}
+
+// listCompanies отдаёт страницу компаний по параметрам запроса; при ошибке прерывает запрос
+func listCompanies(c *web.Controller) *models.CompanyPage {
+	params, err := companyListParams(c)
+	if err != nil {
+		c.CustomAbort(400, err.Error())
+	}
+
+	page, err := models.ListCompanies(params)
+	switch {
+	case errors.Is(err, models.ErrInvalidCursor), errors.Is(err, models.ErrInvalidSort):
+		c.CustomAbort(400, err.Error())
+	case err != nil:
+		c.CustomAbort(500, "Failed to get companies: "+err.Error())
+	}
+
+	setPageHeaders(c, page)
+	return page
+}
+
+// setPageHeaders выставляет X-Total-Count и Link (RFC 8288) со ссылками на первую и следующую страницы.
+// Ссылки повторяют исходный запрос, меняется только cursor.
+func setPageHeaders(c *web.Controller, page *models.CompanyPage) {
+	c.Ctx.Output.Header(TotalCountHeader, strconv.FormatInt(page.Total, 10))
+
+	link := func(cursor, rel string) string {
+		u := *c.Ctx.Request.URL
+		query := u.Query()
+		query.Del("cursor")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+
+	links := link("", "first")
+	if page.NextCursor != "" {
+		links += ", " + link(page.NextCursor, "next")
+	}
+	c.Ctx.Output.Header("Link", links)
+}
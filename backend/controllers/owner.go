@@ -3,7 +3,9 @@ package controllers
 import (
 	"api/models"
 	"encoding/json"
+	"errors"
 	beego "github.com/beego/beego/v2/server/web"
+	"strconv"
 )
 
 // Operations about Owner
@@ -16,14 +18,29 @@ type OwnerResponse struct {
 	Data any  `json:"data"`
 }
 
-func (o *OwnerController) HandlerFunc(rules string) bool {
-	switch rules {
-	case "GetAll", "Logout":
-		auth := AuthController{Controller: o.Controller}
-		return auth.CheckAuth()
-	default:
-		return false
-	}
+var ownerAccess = AccessRules{
+	"GetAll": {Permission: models.PermOwnersRead},
+	"Put":    {},
+	"Delete": {Permission: models.PermOwnersManage},
+	"Logout": {Role: models.RoleOwner},
+
+	"ResendVerification": {Role: models.RoleOwner},
+	"EnrollMFA":          {Role: models.RoleOwner},
+	"ConfirmMFA":         {Role: models.RoleOwner},
+	"DisableMFA":         {Role: models.RoleOwner},
+
+	"CreateAPIKey": {Role: models.RoleOwner},
+	"ListAPIKeys":  {Role: models.RoleOwner, Scope: models.ScopeRead},
+	"RevokeAPIKey": {Role: models.RoleOwner},
+
+	"ListSessions":        {Role: models.RoleOwner, Scope: models.ScopeRead},
+	"RevokeSession":       {Role: models.RoleOwner},
+	"RevokeOtherSessions": {Role: models.RoleOwner},
+}
+
+func (o *OwnerController) HandlerFunc(action string) bool {
+	auth := AuthController{Controller: o.Controller}
+	return auth.Require(ownerAccess, action)
 }
 
 // @Title CreateOwner
@@ -47,7 +64,7 @@ func (o *OwnerController) Post() {
 		Password: ownerReq.Password,
 	}
 
-	uid, err := models.AddOwner(owner)
+	uid, err := models.AddOwner(owner, requestActor(o.Ctx))
 	if err != nil {
 		o.Data["json"] = OwnerResponse{Err: true, Data: "Failed to create owner: " + err.Error()}
 		o.ServeJSON()
@@ -59,9 +76,10 @@ func (o *OwnerController) Post() {
 }
 
 // @Title GetAll
-// @Description get all Owners
+// @Description Последние владельцы (без паролей); нужно разрешение owners:read
 // @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
-// @Success 200 {object} models.Owner
+// @Success 200 {array} models.AccountSummary
+// @Failure 403 {object} types.Problem "Нет разрешения owners:read"
 // @router / [get]
 func (o *OwnerController) GetAll() {
 	owners := models.GetAllOwners()
@@ -74,7 +92,7 @@ func (o *OwnerController) GetAll() {
 // @Title Get
 // @Description get Owner by uid
 // @Param	uid		path 	string	true		"The key for staticblock"
-// @Success 200 {object} models.Owner
+// @Success 200 {object} models.AccountSummary
 // @Failure 403 {string} string "uid is empty"
 // @router /:uid [get]
 func (o *OwnerController) Get() {
@@ -84,35 +102,43 @@ func (o *OwnerController) Get() {
 		if err != nil {
 			o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
 		} else {
-			o.Data["json"] = OwnerResponse{Err: false, Data: owner}
+			o.Data["json"] = OwnerResponse{Err: false, Data: owner.Summary()}
 		}
 	}
 	o.ServeJSON()
 }
 
 // @Title Update
-// @Description update the owner
+// @Description Изменение данных и пароля владельца: своего профиля или, с разрешением owners:manage, любого (Id в теле)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
 // @Param	body		body 	models.Owner	true		"body for Owner content"
-// @Success 200 {object} models.Owner
-// @Failure 403 body is empty
+// @Success 200 {object} models.AccountSummary
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Чужой профиль без разрешения owners:manage"
 // @router / [put]
 func (o *OwnerController) Put() {
 	var owner models.Owner
 	json.Unmarshal(o.Ctx.Input.RequestBody, &owner)
-	err := models.UpdateOwner(&owner)
+
+	auth := AuthController{Controller: o.Controller}
+	owner.Id = auth.editableProfile(models.RoleOwner, models.PermOwnersManage, owner.Id)
+
+	err := models.UpdateOwner(&owner, requestActor(o.Ctx))
 	if err != nil {
 		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
 	} else {
-		o.Data["json"] = OwnerResponse{Err: false, Data: owner}
+		o.Data["json"] = OwnerResponse{Err: false, Data: owner.Summary()}
 	}
 	o.ServeJSON()
 }
 
 // @Title Delete
-// @Description delete the Owner
+// @Description Немедленное удаление владельца вместе с компаниями и остальными данными (без срока ожидания)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
 // @Param	uid		path 	string	true		"The uid you want to delete"
 // @Success 200 {string} delete success!
-// @Failure 403 uid is empty
+// @Failure 403 {object} types.Problem "Нет разрешения owners:manage"
+// @Failure 404 {object} OwnerResponse "Владелец не найден"
 // @router /:uid [delete]
 func (o *OwnerController) Delete() {
 	uid, err := o.GetInt64(":uid")
@@ -122,7 +148,12 @@ func (o *OwnerController) Delete() {
 		return
 	}
 
-	if err := models.DeleteOwner(uid); err != nil {
+	if err := models.DeleteOwner(uid, requestActor(o.Ctx)); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			o.Ctx.Output.SetStatus(404)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
 		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
 	} else {
 		o.Data["json"] = OwnerResponse{Err: false, Data: "Owner deleted"}
@@ -133,9 +164,10 @@ func (o *OwnerController) Delete() {
 // @Title Login
 // @Description Авторизация пользователя
 // @Param	body		body 	models.OwnerLoginRequest	true	"Данные для входа (логин и пароль)"
-// @Success 200 {object} OwnerResponse "Успешный вход, возвращает токен"
+// @Success 200 {object} OwnerResponse "Успешный вход: access- и refresh-токены, а при включённой 2FA — mfa_token для /login/mfa"
 // @Failure 400 {object} OwnerResponse "Ошибка в теле запроса"
 // @Failure 401 {object} OwnerResponse "Неверные логин или пароль"
+// @Failure 429 {object} types.Problem "Вход временно заблокирован после неудачных попыток, см. Retry-After"
 // @router /login [post]
 func (o *OwnerController) Login() {
 	var loginReq models.OwnerLoginRequest
@@ -147,7 +179,14 @@ func (o *OwnerController) Login() {
 		return
 	}
 
-	token, err := models.LoginOwner(loginReq)
+	tokens, err := models.GuardLogin(models.RoleOwner, loginReq.Email, ClientIP(o.Ctx), func() (*models.OwnerLogin, error) {
+		return models.LoginOwner(loginReq, sessionClient(o.Ctx))
+	})
+	var cooldown *models.CooldownError
+	if errors.As(err, &cooldown) {
+		abortTooManyRequests(&o.Controller, cooldown)
+		return
+	}
 	if err != nil {
 		o.Ctx.Output.SetStatus(401)
 		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
@@ -155,7 +194,35 @@ func (o *OwnerController) Login() {
 		return
 	}
 
-	o.Data["json"] = OwnerResponse{Err: false, Data: token}
+	o.Data["json"] = OwnerResponse{Err: false, Data: tokens}
+	o.ServeJSON()
+}
+
+// @Title RefreshToken
+// @Description Обмен refresh-токена на новую пару токенов (старый refresh-токен погашается)
+// @Param	body		body 	models.RefreshRequest	true	"Refresh-токен"
+// @Success 200 {object} OwnerResponse "Новая пара токенов"
+// @Failure 400 {object} OwnerResponse "Ошибка в теле запроса"
+// @Failure 401 {object} OwnerResponse "Refresh-токен недействителен, истёк или уже использован"
+// @router /login/refresh [post]
+func (o *OwnerController) RefreshToken() {
+	var req models.RefreshRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.RefreshToken == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	tokens, err := models.RefreshOwnerToken(req.RefreshToken, sessionClient(o.Ctx))
+	if err != nil {
+		o.Ctx.Output.SetStatus(401)
+		o.Data["json"] = OwnerResponse{Err: true, Data: models.ErrInvalidRefreshToken.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: tokens}
 	o.ServeJSON()
 }
 
@@ -165,6 +232,407 @@ func (o *OwnerController) Login() {
 // @Success 200 {string} logout success
 // @router /logout [get]
 func (o *OwnerController) Logout() {
+	auth := AuthController{Controller: o.Controller}
+	if err := models.RevokeSession(auth.Principal()); err != nil {
+		o.Ctx.Output.SetStatus(500)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Failed to log out: " + err.Error()}
+		o.ServeJSON()
+		return
+	}
+
 	o.Data["json"] = OwnerResponse{Err: false, Data: "Вышли из сессии"}
 	o.ServeJSON()
 }
+
+// @Title VerifyEmail
+// @Description Подтверждение адреса электронной почты по токену из письма
+// @Param	body		body 	models.VerifyEmailRequest	true	"Токен из ссылки в письме"
+// @Success 200 {object} OwnerResponse "Почта подтверждена"
+// @Failure 400 {object} OwnerResponse "Токен недействителен, истёк или уже использован"
+// @router /verify-email [post]
+func (o *OwnerController) VerifyEmail() {
+	var req models.VerifyEmailRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.Token == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	if err := models.ConfirmEmail(req.Token, models.RoleOwner); err != nil {
+		if errors.Is(err, models.ErrInvalidVerificationToken) {
+			o.Ctx.Output.SetStatus(400)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: "Почта подтверждена"}
+	o.ServeJSON()
+}
+
+// @Title ResendVerification
+// @Description Повторная отправка письма для подтверждения почты (не чаще раза в email_verification_cooldown)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} OwnerResponse "Письмо отправлено"
+// @Failure 409 {object} OwnerResponse "Почта уже подтверждена"
+// @Failure 429 {object} types.Problem "Письмо уже отправлялось недавно, см. Retry-After"
+// @router /verify-email/resend [post]
+func (o *OwnerController) ResendVerification() {
+	auth := AuthController{Controller: o.Controller}
+	err := models.ResendEmailVerification(auth.Principal())
+
+	var cooldown *models.CooldownError
+	switch {
+	case err == nil:
+		o.Data["json"] = OwnerResponse{Err: false, Data: "Письмо отправлено"}
+	case errors.As(err, &cooldown):
+		abortTooManyRequests(&o.Controller, cooldown)
+		return
+	case errors.Is(err, models.ErrEmailAlreadyVerified):
+		o.Ctx.Output.SetStatus(409)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+	default:
+		o.Ctx.Output.SetStatus(500)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+	}
+	o.ServeJSON()
+}
+
+// @Title ForgotPassword
+// @Description Запрос ссылки для сброса пароля. Ответ одинаков независимо от того, зарегистрирован ли адрес
+// @Param	body		body 	models.ForgotPasswordRequest	true	"Адрес электронной почты аккаунта"
+// @Success 200 {object} OwnerResponse "Если аккаунт существует, письмо отправлено"
+// @Failure 400 {object} OwnerResponse "Ошибка в теле запроса"
+// @router /forgot-password [post]
+func (o *OwnerController) ForgotPassword() {
+	var req models.ForgotPasswordRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.Email == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	// Ошибка только логируется: по ответу нельзя понять, есть ли такой адрес
+	_ = models.RequestPasswordReset(models.RoleOwner, req.Email)
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: "Если аккаунт с таким адресом существует, мы отправили на него ссылку для сброса пароля"}
+	o.ServeJSON()
+}
+
+// @Title ResetPassword
+// @Description Установка нового пароля по токену из письма; все сессии аккаунта завершаются
+// @Param	body		body 	models.ResetPasswordRequest	true	"Токен из ссылки в письме и новый пароль"
+// @Success 200 {object} OwnerResponse "Пароль изменён"
+// @Failure 400 {object} OwnerResponse "Токен недействителен, истёк или уже использован, либо пароль слишком короткий"
+// @router /reset-password [post]
+func (o *OwnerController) ResetPassword() {
+	var req models.ResetPasswordRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.Token == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	if err := models.ResetPassword(models.RoleOwner, req.Token, req.Password); err != nil {
+		if errors.Is(err, models.ErrInvalidResetToken) || errors.Is(err, models.ErrWeakPassword) {
+			o.Ctx.Output.SetStatus(400)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: "Пароль изменён, войдите заново"}
+	o.ServeJSON()
+}
+
+// @Title LoginMFA
+// @Description Второй шаг входа при включённой 2FA: mfa_token из /login и код из приложения или код восстановления
+// @Param	body		body 	models.MFALoginRequest	true	"mfa_token и код"
+// @Success 200 {object} OwnerResponse "Успешный вход, возвращает access- и refresh-токены"
+// @Failure 400 {object} OwnerResponse "Ошибка в теле запроса"
+// @Failure 401 {object} OwnerResponse "Неверный код или mfa_token недействителен"
+// @Failure 429 {object} types.Problem "Слишком много неверных кодов, см. Retry-After"
+// @router /login/mfa [post]
+func (o *OwnerController) LoginMFA() {
+	var req models.MFALoginRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.MFAToken == "" || req.Code == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	ownerID, err := models.MFAPendingSubject(req.MFAToken)
+	if err != nil {
+		o.Ctx.Output.SetStatus(401)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	// Неверные коды считаются по владельцу отдельно от паролей
+	identifier := "mfa:" + strconv.FormatInt(ownerID, 10)
+	tokens, err := models.GuardLogin(models.RoleOwner, identifier, ClientIP(o.Ctx), func() (*models.TokenPair, error) {
+		return models.CompleteOwnerMFALogin(req.MFAToken, req.Code, sessionClient(o.Ctx))
+	})
+	var cooldown *models.CooldownError
+	if errors.As(err, &cooldown) {
+		abortTooManyRequests(&o.Controller, cooldown)
+		return
+	}
+	if err != nil {
+		o.Ctx.Output.SetStatus(401)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: tokens}
+	o.ServeJSON()
+}
+
+// @Title EnrollMFA
+// @Description Начало подключения 2FA: новый секрет TOTP и otpauth-ссылка для QR-кода
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} models.MFAEnrollment
+// @Failure 409 {object} OwnerResponse "2FA уже включена"
+// @router /mfa/enroll [post]
+func (o *OwnerController) EnrollMFA() {
+	auth := AuthController{Controller: o.Controller}
+	enrollment, err := models.EnrollOwnerMFA(auth.Principal().ID)
+	if err != nil {
+		if errors.Is(err, models.ErrMFAAlreadyEnabled) {
+			o.Ctx.Output.SetStatus(409)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: enrollment}
+	o.ServeJSON()
+}
+
+// @Title ConfirmMFA
+// @Description Подтверждение подключения 2FA первым кодом из приложения; возвращает коды восстановления (показываются один раз)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	body		body 	models.MFACodeRequest	true	"Код из приложения"
+// @Success 200 {object} OwnerResponse "Коды восстановления"
+// @Failure 400 {object} OwnerResponse "Неверный код или подключение не начато"
+// @router /mfa/confirm [post]
+func (o *OwnerController) ConfirmMFA() {
+	var req models.MFACodeRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.Code == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	auth := AuthController{Controller: o.Controller}
+	codes, err := models.ConfirmOwnerMFA(auth.Principal().ID, req.Code)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidMFACode) || errors.Is(err, models.ErrMFANotPending) {
+			o.Ctx.Output.SetStatus(400)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: map[string][]string{"recovery_codes": codes}}
+	o.ServeJSON()
+}
+
+// @Title DisableMFA
+// @Description Отключение 2FA; подтверждается кодом из приложения или кодом восстановления
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	body		body 	models.MFACodeRequest	true	"Код из приложения или код восстановления"
+// @Success 200 {object} OwnerResponse "2FA отключена"
+// @Failure 400 {object} OwnerResponse "Неверный код или 2FA не включена"
+// @router /mfa/disable [post]
+func (o *OwnerController) DisableMFA() {
+	var req models.MFACodeRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil || req.Code == "" {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	auth := AuthController{Controller: o.Controller}
+	if err := models.DisableOwnerMFA(auth.Principal().ID, req.Code); err != nil {
+		if errors.Is(err, models.ErrInvalidMFACode) || errors.Is(err, models.ErrMFANotEnabled) {
+			o.Ctx.Output.SetStatus(400)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: "Двухфакторная аутентификация отключена"}
+	o.ServeJSON()
+}
+
+// @Title CreateAPIKey
+// @Description Создание API-ключа для интеграций; ключ показывается в ответе один раз
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	body		body 	models.APIKeyRequest	true	"Имя ключа и области действия: read, companies:write"
+// @Success 201 {object} models.CreatedAPIKey
+// @Failure 400 {object} OwnerResponse "Неверное имя или область действия"
+// @router /api-keys [post]
+func (o *OwnerController) CreateAPIKey() {
+	var req models.APIKeyRequest
+	if err := json.Unmarshal(o.Ctx.Input.RequestBody, &req); err != nil {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid request"}
+		o.ServeJSON()
+		return
+	}
+
+	auth := AuthController{Controller: o.Controller}
+	key, err := models.CreateAPIKey(auth.Principal().ID, req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidAPIKeyName) || errors.Is(err, models.ErrInvalidAPIKeyScope) {
+			o.Ctx.Output.SetStatus(400)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Ctx.Output.SetStatus(201)
+	o.Data["json"] = OwnerResponse{Err: false, Data: key}
+	o.ServeJSON()
+}
+
+// @Title ListAPIKeys
+// @Description Список API-ключей владельца с датой последнего использования
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {array} models.APIKeyInfo
+// @router /api-keys [get]
+func (o *OwnerController) ListAPIKeys() {
+	auth := AuthController{Controller: o.Controller}
+	keys, err := models.ListAPIKeys(auth.Principal().ID)
+	if err != nil {
+		o.Ctx.Output.SetStatus(500)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: keys}
+	o.ServeJSON()
+}
+
+// @Title RevokeAPIKey
+// @Description Отзыв API-ключа; отозванный ключ сразу перестаёт приниматься
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	id		path 	int	true		"ID ключа"
+// @Success 200 {object} OwnerResponse
+// @Failure 404 {object} OwnerResponse "Ключ не найден или уже отозван"
+// @router /api-keys/:id [delete]
+func (o *OwnerController) RevokeAPIKey() {
+	keyID, err := strconv.ParseInt(o.Ctx.Input.Param(":id"), 10, 64)
+	if err != nil {
+		o.Ctx.Output.SetStatus(400)
+		o.Data["json"] = OwnerResponse{Err: true, Data: "Invalid key ID"}
+		o.ServeJSON()
+		return
+	}
+
+	auth := AuthController{Controller: o.Controller}
+	if err := models.RevokeAPIKey(auth.Principal().ID, keyID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			o.Ctx.Output.SetStatus(404)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: "API-ключ отозван"}
+	o.ServeJSON()
+}
+
+// @Title ListSessions
+// @Description Список активных сессий (устройств) аккаунта; текущая отмечена current
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {array} models.SessionInfo
+// @router /sessions [get]
+func (o *OwnerController) ListSessions() {
+	auth := AuthController{Controller: o.Controller}
+	sessions, err := models.ListSessions(auth.Principal())
+	if err != nil {
+		o.Ctx.Output.SetStatus(500)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: sessions}
+	o.ServeJSON()
+}
+
+// @Title RevokeSession
+// @Description Завершение одной сессии, например на потерянном устройстве
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	id		path 	string	true		"ID сессии"
+// @Success 200 {object} OwnerResponse
+// @Failure 404 {object} OwnerResponse "Сессия не найдена или уже завершена"
+// @router /sessions/:id [delete]
+func (o *OwnerController) RevokeSession() {
+	auth := AuthController{Controller: o.Controller}
+	err := models.RevokeAccountSession(auth.Principal(), o.Ctx.Input.Param(":id"), ClientIP(o.Ctx))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			o.Ctx.Output.SetStatus(404)
+		} else {
+			o.Ctx.Output.SetStatus(500)
+		}
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: "Сессия завершена"}
+	o.ServeJSON()
+}
+
+// @Title RevokeOtherSessions
+// @Description Завершение всех сессий, кроме текущей
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} OwnerResponse "Число завершённых сессий"
+// @router /sessions/revoke-others [post]
+func (o *OwnerController) RevokeOtherSessions() {
+	auth := AuthController{Controller: o.Controller}
+	n, err := models.RevokeOtherSessions(auth.Principal(), ClientIP(o.Ctx))
+	if err != nil {
+		o.Ctx.Output.SetStatus(500)
+		o.Data["json"] = OwnerResponse{Err: true, Data: err.Error()}
+		o.ServeJSON()
+		return
+	}
+
+	o.Data["json"] = OwnerResponse{Err: false, Data: map[string]int64{"revoked": n}}
+	o.ServeJSON()
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"api/api/http/types"
+	"api/models"
+	"encoding/json"
+	"strconv"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// abortProblem отвечает ошибкой в формате application/problem+json и прерывает обработку запроса
+func abortProblem(c *web.Controller, status int, detail string) {
+	problem := types.NewProblem(status, detail)
+	problem.Instance = c.Ctx.Request.URL.Path
+
+	body, _ := json.Marshal(problem)
+	c.Ctx.Output.Header("Content-Type", "application/problem+json; charset=utf-8")
+	c.Ctx.Output.SetStatus(status)
+	_ = c.Ctx.Output.Body(body)
+	c.StopRun()
+}
+
+// abortTooManyRequests отвечает 429 с заголовком Retry-After
+func abortTooManyRequests(c *web.Controller, err *models.CooldownError) {
+	c.Ctx.Output.Header("Retry-After", strconv.FormatInt(err.RetrySeconds(), 10))
+	abortProblem(c, 429, err.Error())
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса: принимается от прокси и возвращается в ответе
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "request_id"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDFilter присваивает запросу идентификатор для логов и журнала аудита.
+// X-Request-ID от клиента или прокси сохраняется, если он короткий и без лишних символов,
+// иначе генерируется новый.
+func RequestIDFilter(ctx *context.Context) {
+	id := ctx.Input.Header(RequestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	ctx.Input.SetData(requestIDKey, id)
+	ctx.Output.Header(RequestIDHeader, id)
+}
+
+// RequestID возвращает идентификатор текущего запроса
+func RequestID(ctx *context.Context) string {
+	id, _ := ctx.Input.GetData(requestIDKey).(string)
+	return id
+}
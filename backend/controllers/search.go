@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"api/models"
+	"errors"
+	"strconv"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// Поиск по компаниям
+type SearchController struct {
+	web.Controller
+}
+
+// @Title SearchCompanies
+// @Description Полнотекстовый поиск по названию, описанию, сфере деятельности и адресу компаний с учётом русской морфологии. Результаты упорядочены по релевантности (совпадение в названии весит больше, чем в описании); совпадения в name_highlight и snippet обёрнуты в <mark>. Общее число найденных — в заголовке X-Total-Count.
+// @Param q query string true "Запрос: слова, \"фраза\", -исключение, or"
+// @Param limit query int false "Размер страницы (по умолчанию 20, не больше 100)"
+// @Param offset query int false "Смещение"
+// @Success 200 {array} models.CompanySearchHit
+// @Failure 400 {string} string "Search query is empty"
+// @Failure 500 {string} string "Search failed"
+// @router /companies [get]
+func (c *SearchController) Companies() {
+	limit, err := c.GetInt("limit", models.SearchPageDefault)
+	if err != nil {
+		c.CustomAbort(400, "limit must be an integer")
+	}
+	offset, err := c.GetInt("offset", 0)
+	if err != nil {
+		c.CustomAbort(400, "offset must be an integer")
+	}
+
+	hits, total, err := models.SearchCompanies(c.GetString("q"), limit, offset)
+	switch {
+	case errors.Is(err, models.ErrEmptySearchQuery):
+		c.CustomAbort(400, err.Error())
+	case err != nil:
+		c.CustomAbort(500, "Search failed: "+err.Error())
+	}
+
+	c.Ctx.Output.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+	c.Data["json"] = hits
+	c.ServeJSON()
+}
+
+// @Title Suggest
+// @Description Подсказки для строки поиска по мере ввода: названия компаний, города и сферы деятельности. Устойчивы к опечаткам и к вводу в латинской раскладке вместо русской ("rjatqyz" → "кофейня"). Упорядочены по близости к вводу, затем по популярности.
+// @Param q query string true "Начало ввода"
+// @Param limit query int false "Число подсказок (по умолчанию 10, не больше 20)"
+// @Success 200 {array} models.Suggestion
+// @Failure 400 {string} string "limit must be an integer"
+// @Failure 500 {string} string "Suggest failed"
+// @router /suggest [get]
+func (c *SearchController) Suggest() {
+	limit, err := c.GetInt("limit", models.SuggestLimitDefault)
+	if err != nil {
+		c.CustomAbort(400, "limit must be an integer")
+	}
+
+	suggestions, err := models.SuggestCompanies(c.GetString("q"), limit)
+	if err != nil {
+		c.CustomAbort(500, "Suggest failed: "+err.Error())
+	}
+
+	c.Data["json"] = suggestions
+	c.ServeJSON()
+}
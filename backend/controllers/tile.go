@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"api/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// MVTContentType — тип содержимого векторных тайлов
+const MVTContentType = "application/vnd.mapbox-vector-tile"
+
+// Векторные тайлы карты компаний
+type TileController struct {
+	beego.Controller
+}
+
+// tileMaxAge — сколько секунд браузер и CDN могут использовать тайл без перепроверки
+func tileMaxAge() int {
+	return beego.AppConfig.DefaultInt("map_tile_max_age", 60)
+}
+
+// @Title CompanyTile
+// @Description Векторный тайл (MVT) со слоем companies: точки компаний со свойствами id, name, business_sphere. Кешируется на map_tile_max_age секунд, после чего перепроверяется по ETag; пустой тайл — 204.
+// @Param z path int true "Масштаб, 0–22"
+// @Param x path int true "Номер тайла по X"
+// @Param y path int true "Номер тайла по Y"
+// @Success 200 {string} binary "application/vnd.mapbox-vector-tile"
+// @Success 204 {string} string "В тайле нет компаний"
+// @Success 304 {string} string "Тайл не изменился"
+// @Failure 400 {string} string "Invalid tile coordinates"
+// @Failure 500 {string} string "Failed to build tile"
+// @router /tiles/:z/:x/:y.mvt [get]
+func (c *TileController) Get() {
+	var coord models.TileCoord
+	var errs [3]error
+	coord.Z, errs[0] = strconv.Atoi(c.Ctx.Input.Param(":z"))
+	coord.X, errs[1] = strconv.Atoi(c.Ctx.Input.Param(":x"))
+	coord.Y, errs[2] = strconv.Atoi(c.Ctx.Input.Param(":y"))
+	if errors.Join(errs[:]...) != nil {
+		c.CustomAbort(400, "Invalid tile coordinates")
+	}
+
+	tile, err := models.CompanyTile(coord)
+	switch {
+	case errors.Is(err, models.ErrInvalidTile):
+		c.CustomAbort(400, err.Error())
+	case err != nil:
+		c.CustomAbort(500, "Failed to build tile: "+err.Error())
+	}
+
+	sum := sha256.Sum256(tile)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	c.Ctx.Output.Header("ETag", etag)
+	c.Ctx.Output.Header("Cache-Control", "public, max-age="+strconv.Itoa(tileMaxAge()))
+
+	if etagMatches(c.Ctx.Input.Header("If-None-Match"), etag) {
+		c.Ctx.Output.SetStatus(304)
+		return
+	}
+	if len(tile) == 0 {
+		c.Ctx.Output.SetStatus(204)
+		return
+	}
+
+	c.Ctx.Output.Header("Content-Type", MVTContentType)
+	_ = c.Ctx.Output.Body(tile)
+}
+
+// etagMatches проверяет If-None-Match: список тегов через запятую или *
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
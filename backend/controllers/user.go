@@ -3,6 +3,9 @@ package controllers
 import (
 	"api/models"
 	"encoding/json"
+	"errors"
+	"net/http"
+
 	beego "github.com/beego/beego/v2/server/web"
 )
 
@@ -16,14 +19,22 @@ type UserResponse struct {
 	Data any  `json:"data"`
 }
 
-func (u *UserController) HandlerFunc(rules string) bool {
-	switch rules {
-	case "GetAll", "Logout":
-		auth := AuthController{Controller: u.Controller}
-		return auth.CheckAuth()
-	default:
-		return false
-	}
+var userAccess = AccessRules{
+	"GetAll": {Permission: models.PermUsersRead},
+	"Put":    {},
+	"Delete": {Permission: models.PermUsersManage},
+	"Logout": {Role: models.RoleVisitor},
+
+	"ResendVerification": {Role: models.RoleVisitor},
+
+	"ListSessions":        {Role: models.RoleVisitor},
+	"RevokeSession":       {Role: models.RoleVisitor},
+	"RevokeOtherSessions": {Role: models.RoleVisitor},
+}
+
+func (u *UserController) HandlerFunc(action string) bool {
+	auth := AuthController{Controller: u.Controller}
+	return auth.Require(userAccess, action)
 }
 
 // @Title CreateUser
@@ -46,15 +57,16 @@ func (u *UserController) Post() {
 		Password: userReq.Password,
 	}
 
-	uid, _ := models.AddUser(user)
+	uid, _ := models.AddUser(user, requestActor(u.Ctx))
 	u.Data["json"] = UserResponse{Err: false, Data: models.PostUserResponse{Id: uid}}
 	u.ServeJSON()
 }
 
 // @Title GetAll
-// @Description get all Users
+// @Description Последние посетители (без паролей); нужно разрешение users:read
 // @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
-// @Success 200 {object} models.User
+// @Success 200 {array} models.AccountSummary
+// @Failure 403 {object} types.Problem "Нет разрешения users:read"
 // @router / [get]
 func (u *UserController) GetAll() {
 	users := models.GetAllUsers()
@@ -65,7 +77,7 @@ func (u *UserController) GetAll() {
 // @Title Get
 // @Description get user by uid
 // @Param	uid		path 	string	true		"The key for staticblock"
-// @Success 200 {object} models.User
+// @Success 200 {object} models.AccountSummary
 // @Failure 403 {string} string "uid is empty"
 // @router /:uid [get]
 func (u *UserController) Get() {
@@ -75,43 +87,51 @@ func (u *UserController) Get() {
 		if err != nil {
 			u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
 		} else {
-			u.Data["json"] = UserResponse{Err: false, Data: user}
+			u.Data["json"] = UserResponse{Err: false, Data: user.Summary()}
 		}
 	}
 	u.ServeJSON()
 }
 
 // @Title Update
-// @Description update the user
+// @Description Изменение имени и пароля посетителя: своего профиля или, с разрешением users:manage, любого (Id в теле)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
 // @Param	body		body 	models.User	true		"body for user content"
-// @Success 200 {object} models.User
-// @Failure 403 body is empty
+// @Success 200 {object} models.AccountSummary
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} types.Problem "Чужой профиль без разрешения users:manage"
 // @router / [put]
 func (u *UserController) Put() {
 	var user models.User
 	json.Unmarshal(u.Ctx.Input.RequestBody, &user)
-	err := models.UpdateUser(&user)
+
+	auth := AuthController{Controller: u.Controller}
+	user.Id = auth.editableProfile(models.RoleVisitor, models.PermUsersManage, user.Id)
+
+	err := models.UpdateUser(&user, requestActor(u.Ctx))
 	if err != nil {
 		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
 	} else {
-		u.Data["json"] = UserResponse{Err: false, Data: user}
+		u.Data["json"] = UserResponse{Err: false, Data: user.Summary()}
 	}
 	u.ServeJSON()
 }
 
 // @Title Delete
-// @Description delete the user
+// @Description Немедленное удаление посетителя и его данных (без срока ожидания, самостоятельное удаление — POST /v1/account/erasure)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
 // @Param	uid		path 	string	true		"The uid you want to delete"
 // @Success 200 {string} delete success!
-// @Failure 403 uid is empty
+// @Failure 403 {object} types.Problem "Нет разрешения users:manage"
 // @router /:uid [delete]
 func (u *UserController) Delete() {
 	uid, err := u.GetInt64(":uid")
 	if err == nil {
-		del := models.DeleteUser(uid)
+		del := models.DeleteUser(uid, requestActor(u.Ctx))
 		if del {
 			u.Data["json"] = UserResponse{Err: false, Data: "Пользователь удален"}
 		} else {
+			u.Ctx.Output.SetStatus(404)
 			u.Data["json"] = UserResponse{Err: true, Data: "Пользователь не найден"}
 		}
 	}
@@ -121,9 +141,10 @@ func (u *UserController) Delete() {
 // @Title Login
 // @Description Авторизация пользователя
 // @Param	body		body 	models.LoginRequest	true	"Данные для входа (логин и пароль)"
-// @Success 200 {object} UserResponse "Успешный вход, возвращает токен"
+// @Success 200 {object} UserResponse "Успешный вход, возвращает access- и refresh-токены"
 // @Failure 400 {object} UserResponse "Ошибка в теле запроса"
 // @Failure 401 {object} UserResponse "Неверные логин или пароль"
+// @Failure 429 {object} types.Problem "Вход временно заблокирован после неудачных попыток, см. Retry-After"
 // @router /login [post]
 func (u *UserController) Login() {
 	var loginReq models.LoginRequest
@@ -135,14 +156,49 @@ func (u *UserController) Login() {
 		return
 	}
 
-	token, err := models.Login(loginReq)
+	tokens, err := models.GuardLogin(models.RoleVisitor, loginReq.Username, ClientIP(u.Ctx), func() (*models.TokenPair, error) {
+		return models.Login(loginReq, sessionClient(u.Ctx))
+	})
+	var cooldown *models.CooldownError
+	if errors.As(err, &cooldown) {
+		abortTooManyRequests(&u.Controller, cooldown)
+		return
+	}
 	if err != nil {
 		u.Ctx.Output.SetStatus(401)
 		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
 		u.ServeJSON()
 		return
 	}
-	u.Data["json"] = UserResponse{Err: false, Data: token}
+	u.Data["json"] = UserResponse{Err: false, Data: tokens}
+	u.ServeJSON()
+}
+
+// @Title RefreshToken
+// @Description Обмен refresh-токена на новую пару токенов (старый refresh-токен погашается)
+// @Param	body		body 	models.RefreshRequest	true	"Refresh-токен"
+// @Success 200 {object} UserResponse "Новая пара токенов"
+// @Failure 400 {object} UserResponse "Ошибка в теле запроса"
+// @Failure 401 {object} UserResponse "Refresh-токен недействителен, истёк или уже использован"
+// @router /login/refresh [post]
+func (u *UserController) RefreshToken() {
+	var req models.RefreshRequest
+	if err := json.Unmarshal(u.Ctx.Input.RequestBody, &req); err != nil || req.RefreshToken == "" {
+		u.Ctx.Output.SetStatus(400)
+		u.Data["json"] = UserResponse{Err: true, Data: "Invalid request"}
+		u.ServeJSON()
+		return
+	}
+
+	tokens, err := models.RefreshUserToken(req.RefreshToken, sessionClient(u.Ctx))
+	if err != nil {
+		u.Ctx.Output.SetStatus(401)
+		u.Data["json"] = UserResponse{Err: true, Data: models.ErrInvalidRefreshToken.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: tokens}
 	u.ServeJSON()
 }
 
@@ -152,5 +208,276 @@ func (u *UserController) Login() {
 // @Success 200 {string} logout success
 // @router /logout [get]
 func (u *UserController) Logout() {
+	auth := AuthController{Controller: u.Controller}
+	if err := models.RevokeSession(auth.Principal()); err != nil {
+		u.Ctx.Output.SetStatus(500)
+		u.Data["json"] = UserResponse{Err: true, Data: "Failed to log out: " + err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: "Вышли из сессии"}
+	u.ServeJSON()
+}
+
+// @Title VerifyEmail
+// @Description Подтверждение адреса электронной почты по токену из письма
+// @Param	body		body 	models.VerifyEmailRequest	true	"Токен из ссылки в письме"
+// @Success 200 {object} UserResponse "Почта подтверждена"
+// @Failure 400 {object} UserResponse "Токен недействителен, истёк или уже использован"
+// @router /verify-email [post]
+func (u *UserController) VerifyEmail() {
+	var req models.VerifyEmailRequest
+	if err := json.Unmarshal(u.Ctx.Input.RequestBody, &req); err != nil || req.Token == "" {
+		u.Ctx.Output.SetStatus(400)
+		u.Data["json"] = UserResponse{Err: true, Data: "Invalid request"}
+		u.ServeJSON()
+		return
+	}
+
+	if err := models.ConfirmEmail(req.Token, models.RoleVisitor); err != nil {
+		if errors.Is(err, models.ErrInvalidVerificationToken) {
+			u.Ctx.Output.SetStatus(400)
+		} else {
+			u.Ctx.Output.SetStatus(500)
+		}
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: "Почта подтверждена"}
+	u.ServeJSON()
+}
+
+// @Title ResendVerification
+// @Description Повторная отправка письма для подтверждения почты (не чаще раза в email_verification_cooldown)
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} UserResponse "Письмо отправлено"
+// @Failure 409 {object} UserResponse "Почта уже подтверждена"
+// @Failure 429 {object} types.Problem "Письмо уже отправлялось недавно, см. Retry-After"
+// @router /verify-email/resend [post]
+func (u *UserController) ResendVerification() {
+	auth := AuthController{Controller: u.Controller}
+	err := models.ResendEmailVerification(auth.Principal())
+
+	var cooldown *models.CooldownError
+	switch {
+	case err == nil:
+		u.Data["json"] = UserResponse{Err: false, Data: "Письмо отправлено"}
+	case errors.As(err, &cooldown):
+		abortTooManyRequests(&u.Controller, cooldown)
+		return
+	case errors.Is(err, models.ErrEmailAlreadyVerified):
+		u.Ctx.Output.SetStatus(409)
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+	default:
+		u.Ctx.Output.SetStatus(500)
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+	}
+	u.ServeJSON()
+}
+
+// @Title ForgotPassword
+// @Description Запрос ссылки для сброса пароля. Ответ одинаков независимо от того, зарегистрирован ли адрес
+// @Param	body		body 	models.ForgotPasswordRequest	true	"Адрес электронной почты аккаунта"
+// @Success 200 {object} UserResponse "Если аккаунт существует, письмо отправлено"
+// @Failure 400 {object} UserResponse "Ошибка в теле запроса"
+// @router /forgot-password [post]
+func (u *UserController) ForgotPassword() {
+	var req models.ForgotPasswordRequest
+	if err := json.Unmarshal(u.Ctx.Input.RequestBody, &req); err != nil || req.Email == "" {
+		u.Ctx.Output.SetStatus(400)
+		u.Data["json"] = UserResponse{Err: true, Data: "Invalid request"}
+		u.ServeJSON()
+		return
+	}
+
+	// Ошибка только логируется: по ответу нельзя понять, есть ли такой адрес
+	_ = models.RequestPasswordReset(models.RoleVisitor, req.Email)
+
+	u.Data["json"] = UserResponse{Err: false, Data: "Если аккаунт с таким адресом существует, мы отправили на него ссылку для сброса пароля"}
+	u.ServeJSON()
+}
+
+// @Title ResetPassword
+// @Description Установка нового пароля по токену из письма; все сессии аккаунта завершаются
+// @Param	body		body 	models.ResetPasswordRequest	true	"Токен из ссылки в письме и новый пароль"
+// @Success 200 {object} UserResponse "Пароль изменён"
+// @Failure 400 {object} UserResponse "Токен недействителен, истёк или уже использован, либо пароль слишком короткий"
+// @router /reset-password [post]
+func (u *UserController) ResetPassword() {
+	var req models.ResetPasswordRequest
+	if err := json.Unmarshal(u.Ctx.Input.RequestBody, &req); err != nil || req.Token == "" {
+		u.Ctx.Output.SetStatus(400)
+		u.Data["json"] = UserResponse{Err: true, Data: "Invalid request"}
+		u.ServeJSON()
+		return
+	}
+
+	if err := models.ResetPassword(models.RoleVisitor, req.Token, req.Password); err != nil {
+		if errors.Is(err, models.ErrInvalidResetToken) || errors.Is(err, models.ErrWeakPassword) {
+			u.Ctx.Output.SetStatus(400)
+		} else {
+			u.Ctx.Output.SetStatus(500)
+		}
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: "Пароль изменён, войдите заново"}
+	u.ServeJSON()
+}
+
+// @Title OIDCProviders
+// @Description Список внешних провайдеров входа (OpenID Connect)
+// @Success 200 {object} UserResponse "Имена провайдеров"
+// @router /oidc/providers [get]
+func (u *UserController) OIDCProviders() {
+	u.Data["json"] = UserResponse{Err: false, Data: models.OIDCProviderNames()}
+	u.ServeJSON()
+}
+
+// oidcStateCookie хранит state незавершённого входа через провайдера в браузере, который его начал
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie выставляет (или при maxAge < 0 удаляет) cookie со state
+func setOIDCStateCookie(u *UserController, value string, maxAge int) {
+	http.SetCookie(u.Ctx.ResponseWriter, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/v1/visitor/user/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   u.Ctx.Input.IsSecure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// @Title OIDCLogin
+// @Description Перенаправление на страницу входа провайдера (state, nonce и PKCE создаются на сервере; state также сохраняется в cookie oidc_state)
+// @Param	provider	path 	string	true	"Имя провайдера из oidc_providers"
+// @Success 302 {string} string "Redirect на authorization_endpoint провайдера"
+// @Failure 404 {object} UserResponse "Провайдер не настроен"
+// @router /oidc/:provider/login [get]
+func (u *UserController) OIDCLogin() {
+	authURL, state, err := models.StartOIDCLogin(u.Ctx.Request.Context(), u.Ctx.Input.Param(":provider"))
+	if err != nil {
+		if errors.Is(err, models.ErrUnknownOIDCProvider) {
+			u.Ctx.Output.SetStatus(404)
+		} else {
+			u.Ctx.Output.SetStatus(502)
+		}
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	setOIDCStateCookie(u, state, int(models.OIDCStateTTL().Seconds()))
+	u.Redirect(authURL, 302)
+}
+
+// @Title OIDCCallback
+// @Description Завершение входа через провайдера: code и state, с которыми провайдер вернул пользователя на redirect_url. Запрос должен прийти из того же браузера, с cookie oidc_state (fetch с credentials: include)
+// @Param	provider	path 	string	true	"Имя провайдера из oidc_providers"
+// @Param	body		body 	models.OIDCCallbackRequest	true	"code и state из redirect_url"
+// @Success 200 {object} UserResponse "Успешный вход, возвращает access- и refresh-токены"
+// @Failure 400 {object} UserResponse "state недействителен, истёк или не совпадает с cookie oidc_state"
+// @Failure 401 {object} UserResponse "Провайдер не подтвердил вход"
+// @Failure 409 {object} UserResponse "Аккаунт с этим email уже есть, но адрес не подтверждён"
+// @router /oidc/:provider/callback [post]
+func (u *UserController) OIDCCallback() {
+	var req models.OIDCCallbackRequest
+	if err := json.Unmarshal(u.Ctx.Input.RequestBody, &req); err != nil || req.Code == "" || req.State == "" {
+		u.Ctx.Output.SetStatus(400)
+		u.Data["json"] = UserResponse{Err: true, Data: "Invalid request"}
+		u.ServeJSON()
+		return
+	}
+
+	tokens, err := models.FinishOIDCLogin(u.Ctx.Request.Context(), u.Ctx.Input.Param(":provider"),
+		req.Code, req.State, u.Ctx.GetCookie(oidcStateCookie), sessionClient(u.Ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownOIDCProvider):
+			u.Ctx.Output.SetStatus(404)
+		case errors.Is(err, models.ErrInvalidOIDCState):
+			u.Ctx.Output.SetStatus(400)
+		case errors.Is(err, models.ErrOIDCAccountConflict):
+			u.Ctx.Output.SetStatus(409)
+		default:
+			u.Ctx.Output.SetStatus(401)
+		}
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	setOIDCStateCookie(u, "", -1)
+	u.Data["json"] = UserResponse{Err: false, Data: tokens}
+	u.ServeJSON()
+}
+
+// @Title ListSessions
+// @Description Список активных сессий (устройств) аккаунта; текущая отмечена current
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {array} models.SessionInfo
+// @router /sessions [get]
+func (u *UserController) ListSessions() {
+	auth := AuthController{Controller: u.Controller}
+	sessions, err := models.ListSessions(auth.Principal())
+	if err != nil {
+		u.Ctx.Output.SetStatus(500)
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: sessions}
+	u.ServeJSON()
+}
+
+// @Title RevokeSession
+// @Description Завершение одной сессии, например на потерянном устройстве
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param	id		path 	string	true		"ID сессии"
+// @Success 200 {object} UserResponse
+// @Failure 404 {object} UserResponse "Сессия не найдена или уже завершена"
+// @router /sessions/:id [delete]
+func (u *UserController) RevokeSession() {
+	auth := AuthController{Controller: u.Controller}
+	err := models.RevokeAccountSession(auth.Principal(), u.Ctx.Input.Param(":id"), ClientIP(u.Ctx))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			u.Ctx.Output.SetStatus(404)
+		} else {
+			u.Ctx.Output.SetStatus(500)
+		}
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: "Сессия завершена"}
+	u.ServeJSON()
+}
+
+// @Title RevokeOtherSessions
+// @Description Завершение всех сессий, кроме текущей
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} UserResponse "Число завершённых сессий"
+// @router /sessions/revoke-others [post]
+func (u *UserController) RevokeOtherSessions() {
+	auth := AuthController{Controller: u.Controller}
+	n, err := models.RevokeOtherSessions(auth.Principal(), ClientIP(u.Ctx))
+	if err != nil {
+		u.Ctx.Output.SetStatus(500)
+		u.Data["json"] = UserResponse{Err: true, Data: err.Error()}
+		u.ServeJSON()
+		return
+	}
+
+	u.Data["json"] = UserResponse{Err: false, Data: map[string]int64{"revoked": n}}
 	u.ServeJSON()
 }
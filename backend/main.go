@@ -2,19 +2,64 @@ package main
 
 import (
 	_ "api/controllers"
+	"api/models"
 	_ "api/routers"
 	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
 	beego "github.com/beego/beego/v2/server/web"
 	"github.com/beego/beego/v2/server/web/filter/cors"
 	_ "github.com/gorilla/websocket"
 	_ "github.com/lib/pq"
 	_ "net/http"
+	"os"
 )
 
 func main() {
+	if err := models.LoadSigningKeys(); err != nil {
+		logs.Critical("failed to load JWT signing keys: %v", err)
+		os.Exit(1)
+	}
+
+	if err := models.LoadMailSender(); err != nil {
+		logs.Critical("failed to configure mail sender: %v", err)
+		os.Exit(1)
+	}
+	if err := models.LoadGeocoder(); err != nil {
+		logs.Critical("failed to configure geocoder: %v", err)
+		os.Exit(1)
+	}
 
 	sqlconn, _ := beego.AppConfig.String("sqlconn")
 	orm.RegisterDataBase("mydatabase", "postgres", sqlconn)
+	// Создаёт недостающие таблицы и колонки (refresh_token, revoked_token, ...), существующие не трогает
+	if err := orm.RunSyncdb("mydatabase", false, false); err != nil {
+		logs.Error("syncdb failed: %v", err)
+	}
+	// Колонка и индекс полнотекстового поиска по компаниям (RunSyncdb их не создаёт)
+	if err := models.EnsureCompanySearch(); err != nil {
+		logs.Error("failed to prepare company search: %v", err)
+	}
+	if err := models.EnsureCompanyGeoIndex(); err != nil {
+		logs.Error("failed to prepare company geo index: %v", err)
+	}
+	if err := models.SeedRoles(); err != nil {
+		logs.Error("failed to seed roles: %v", err)
+	}
+	// Привязывает профили посетителей и владельцев, созданные до появления аккаунтов
+	if beego.AppConfig.DefaultBool("account_migrate_on_start", true) {
+		if _, err := models.MigrateAccounts(); err != nil {
+			logs.Error("account migration failed: %v", err)
+		}
+	}
+	if username, _ := beego.AppConfig.String("admin_username"); username != "" {
+		if err := models.GrantAdminToUser(username); err != nil {
+			logs.Error("failed to grant admin role to %s: %v", username, err)
+		}
+	}
+	// Окончательно удаляет аккаунты, срок ожидания удаления которых истёк
+	models.StartErasureWorker()
+	// Геокодирует адреса компаний из очереди geocode_job
+	models.StartGeocodeWorkers()
 	if beego.BConfig.RunMode == "dev" {
 		beego.BConfig.WebConfig.DirectoryIndex = true
 		beego.BConfig.WebConfig.StaticDir["/swagger"] = "swagger"
@@ -23,7 +68,7 @@ func main() {
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"PUT", "PATCH", "GET", "POST", "OPTIONS", "DELETE"},
 		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Sec-WebSocket-Key", "Sec-WebSocket-Version", "Connection", "Upgrade"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID"},
 		AllowCredentials: true,
 	}))
 	beego.BConfig.WebConfig.StaticDir["/static"] = "static"
@@ -0,0 +1,628 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(Account))
+}
+
+// AccountLoginType — тип субъекта единого входа: в журнале блокировок и в счётчике login,
+// который не ведёт ни к одному профилю
+const AccountLoginType = "account"
+
+var (
+	ErrNoAccount            = errors.New("profile is not linked to an account")
+	ErrProfileAlreadyLinked = errors.New("account already has visitor and owner profiles")
+)
+
+// Account — человек, которому принадлежат профили посетителя (user) и владельца (owner).
+// Профиль ссылается на аккаунт через account_id; вход и пароль остаются в профилях,
+// поэтому старые эндпоинты входа продолжают работать.
+type Account struct {
+	Id        int64     `orm:"auto;column(id)"`
+	Email     string    `orm:"unique;size(255);column(email)"`
+	CreatedAt time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+}
+
+// AccountLoginRequest — единый вход: login — email или имя посетителя
+type AccountLoginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// LinkProfileRequest — данные входа профиля, который присоединяется к аккаунту
+type LinkProfileRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// ProfileClaim — профиль аккаунта в access-токене. PasswordRequired — при входе в сессию токена
+// пароль профиля не проверялся; MFARequired — у профиля включена 2FA, а сессия токена второй
+// фактор не проходила. В обоих случаях действовать от имени профиля нельзя: нужен вход
+// в этот профиль (POST /v1/account/login с его паролем).
+type ProfileClaim struct {
+	ID               int64 `json:"id"`
+	EmailVerified    bool  `json:"email_verified"`
+	PasswordRequired bool  `json:"password_required,omitempty"`
+	MFARequired      bool  `json:"mfa_required,omitempty"`
+}
+
+// locked — действовать от имени профиля токеном нельзя
+func (p ProfileClaim) locked() bool {
+	return p.PasswordRequired || p.MFARequired
+}
+
+// AccountInfo — аккаунт текущего субъекта в ответах API
+type AccountInfo struct {
+	AccountID int64                   `json:"account_id"`
+	Profiles  map[string]ProfileClaim `json:"profiles"`
+	Roles     []string                `json:"roles"`
+}
+
+// AccountMigration — итог привязки существующих профилей к аккаунтам
+type AccountMigration struct {
+	Created   int `json:"created"`
+	Linked    int `json:"linked"`
+	Conflicts int `json:"conflicts"`
+}
+
+// accountProfiles — профили одного аккаунта (или одиночный профиль без аккаунта)
+type accountProfiles struct {
+	accountID int64
+	user      *User
+	owner     *Owner
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loadAccountProfiles(o orm.Ormer, accountID int64) (*accountProfiles, error) {
+	profiles := &accountProfiles{accountID: accountID}
+
+	var user User
+	err := o.QueryTable("user").Filter("account_id", accountID).One(&user)
+	if err == nil {
+		profiles.user = &user
+	} else if !errors.Is(err, orm.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load visitor profile: %v", err)
+	}
+
+	var owner Owner
+	err = o.QueryTable("owner").Filter("account_id", accountID).One(&owner)
+	if err == nil {
+		profiles.owner = &owner
+	} else if !errors.Is(err, orm.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load owner profile: %v", err)
+	}
+	return profiles, nil
+}
+
+// claims возвращает незаблокированные профили для access-токена
+func (a *accountProfiles) claims() map[string]ProfileClaim {
+	profiles := make(map[string]ProfileClaim)
+	if a.user != nil && !a.user.Blocked {
+		profiles[RoleVisitor] = ProfileClaim{ID: a.user.Id, EmailVerified: a.user.EmailVerified}
+	}
+	if a.owner != nil && !a.owner.Blocked {
+		profiles[RoleOwner] = ProfileClaim{ID: a.owner.Id, EmailVerified: a.owner.EmailVerified}
+	}
+	return profiles
+}
+
+// attachAccount добавляет в claims профили аккаунта и их роли, чтобы один токен
+// открывал действия и посетителя, и владельца. Ошибка только логируется:
+// токен остаётся действительным для своего профиля.
+// Роли другого профиля попадают в токен, только если его пароль проверен при входе в сессию
+// токена (LoginAccount) и сессии профиля с тех пор не отзывались (блокировка, сброс пароля).
+// Владелец с 2FA попадает в токен посетителя без ролей и с MFARequired: сессии посетителя
+// (вход по паролю, OIDC, обновление токенов) второй фактор владельца не проходили.
+func (c *Claims) attachAccount(accountID int64) {
+	if accountID == 0 {
+		return
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	profiles, err := loadAccountProfiles(o, accountID)
+	if err != nil {
+		logger.WarnAny("Failed to load account profiles", map[string]interface{}{
+			"account_id": accountID,
+			"error":      err.Error(),
+		})
+		return
+	}
+
+	c.AccountID = accountID
+	c.Profiles = profiles.claims()
+
+	verified := c.verifiedProfiles()
+	for role, profile := range c.Profiles {
+		if role != c.Role && !verified[role] {
+			profile.PasswordRequired = true
+			c.Profiles[role] = profile
+		}
+	}
+
+	if owner, ok := c.Profiles[RoleOwner]; ok && c.Role != RoleOwner {
+		mfaEnabled, err := ownerMFAEnabled(o, owner.ID)
+		if err != nil {
+			logger.WarnAny("Failed to check owner two-factor settings", map[string]interface{}{
+				"account_id": accountID,
+				"error":      err.Error(),
+			})
+		}
+		// Если настройки не прочитались, профиль закрыт, как при включённой 2FA
+		owner.MFARequired = mfaEnabled || err != nil
+		c.Profiles[RoleOwner] = owner
+	}
+
+	seen := make(map[string]bool)
+	for _, role := range c.Roles {
+		seen[role] = true
+	}
+	for role, profile := range c.Profiles {
+		if role == c.Role || profile.locked() {
+			continue
+		}
+		for _, r := range SubjectRoles(role, profile.ID) {
+			if !seen[r] {
+				seen[r] = true
+				c.Roles = append(c.Roles, r)
+			}
+		}
+	}
+}
+
+// verifiedProfiles возвращает профили аккаунта, пароль которых проверен при входе в сессию
+// токена. Проверка теряет силу, если сессии профиля отозвали после входа.
+func (c *Claims) verifiedProfiles() map[string]bool {
+	verified := make(map[string]bool)
+	if c.SessionID == "" {
+		return verified
+	}
+	s, err := Sessions.Get(c.SessionID)
+	if err != nil || s == nil {
+		if err != nil {
+			logger.WarnAny("Failed to load session profiles", map[string]interface{}{
+				"session_id": c.SessionID,
+				"error":      err.Error(),
+			})
+		}
+		return verified
+	}
+
+	for _, role := range strings.Split(s.Profiles, ",") {
+		profile, ok := c.Profiles[role]
+		if !ok {
+			continue
+		}
+		before, err := AccessTokenRevocations.SubjectRevokedBefore(role, profile.ID)
+		if err != nil || (!before.IsZero() && s.CreatedAt.Before(before)) {
+			continue
+		}
+		verified[role] = true
+	}
+	return verified
+}
+
+// As возвращает субъекта в роли role: сам субъект, если роль совпадает,
+// или его профиль из того же аккаунта, если тот открыт в токене.
+// Сессия остаётся сессией исходного токена.
+func (p *Principal) As(role string) (*Principal, bool) {
+	if p.Role == role {
+		return p, true
+	}
+	profile, ok := p.Profiles[role]
+	if !ok || profile.locked() || p.APIKeyID != 0 {
+		return nil, false
+	}
+
+	q := *p
+	q.sessionRole, q.sessionSubjectID = p.sessionSubject()
+	q.ID = profile.ID
+	q.Role = role
+	q.EmailVerified = profile.EmailVerified
+	return &q, true
+}
+
+// sessionSubject возвращает аккаунт, на который записана сессия токена
+func (p *Principal) sessionSubject() (string, int64) {
+	if p.sessionRole != "" {
+		return p.sessionRole, p.sessionSubjectID
+	}
+	return p.Role, p.ID
+}
+
+// Account возвращает аккаунт субъекта с его профилями
+func (p *Principal) Account() AccountInfo {
+	info := AccountInfo{AccountID: p.AccountID, Profiles: p.Profiles, Roles: p.Roles}
+	if info.Profiles == nil {
+		info.Profiles = map[string]ProfileClaim{p.Role: {ID: p.ID, EmailVerified: p.EmailVerified}}
+	}
+	return info
+}
+
+func profileTable(role string) string {
+	if role == RoleOwner {
+		return "owner"
+	}
+	return "user"
+}
+
+// attachNewAccount создаёт аккаунт для только что зарегистрированного профиля.
+// Если адрес уже занят другим аккаунтом, профиль остаётся отдельным: присоединить его
+// можно через LinkProfile, подтвердив владение обоими профилями.
+func attachNewAccount(role string, profileID int64, email string) {
+	logFields := map[string]interface{}{
+		"subject_type": role,
+		"subject_id":   profileID,
+	}
+
+	email = normalizeEmail(email)
+	if email == "" {
+		return
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	account := Account{Email: email}
+	id, err := o.Insert(&account)
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.WarnAny("Profile left without account", logFields)
+		return
+	}
+	if _, err := o.QueryTable(profileTable(role)).Filter("id", profileID).Update(orm.Params{"account_id": id}); err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to link profile to account", logFields)
+	}
+}
+
+// MigrateAccounts привязывает к аккаунтам профили, созданные до появления аккаунтов.
+// Каждый посетитель получает аккаунт со своим адресом. Владелец присоединяется к аккаунту
+// посетителя с тем же адресом, только если адрес подтверждён в обоих профилях — иначе
+// это может быть чужой человек. Профили, адрес которых уже занят, остаются без аккаунта
+// (Conflicts) и присоединяются вручную через LinkProfile.
+// Повторный запуск безопасен: обрабатываются только профили с account_id = 0.
+func MigrateAccounts() (*AccountMigration, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	result := &AccountMigration{}
+	const batch = 500
+
+	var lastID int64
+	for {
+		var users []User
+		_, err := o.QueryTable("user").Filter("account_id", 0).Filter("id__gt", lastID).
+			OrderBy("id").Limit(batch).All(&users)
+		if err != nil {
+			return result, fmt.Errorf("failed to load users: %v", err)
+		}
+		for _, user := range users {
+			lastID = user.Id
+			id, err := migrateProfile(o, "user", user.Id, user.Email)
+			if err != nil {
+				return result, err
+			}
+			if id == 0 {
+				result.Conflicts++
+			} else {
+				result.Created++
+			}
+		}
+		if len(users) < batch {
+			break
+		}
+	}
+
+	lastID = 0
+	for {
+		var owners []Owner
+		_, err := o.QueryTable("owner").Filter("account_id", 0).Filter("id__gt", lastID).
+			OrderBy("id").Limit(batch).All(&owners)
+		if err != nil {
+			return result, fmt.Errorf("failed to load owners: %v", err)
+		}
+		for _, owner := range owners {
+			lastID = owner.Id
+
+			var account Account
+			err := o.QueryTable("account").Filter("email", normalizeEmail(owner.Email)).One(&account)
+			if errors.Is(err, orm.ErrNoRows) {
+				id, err := migrateProfile(o, "owner", owner.Id, owner.Email)
+				if err != nil {
+					return result, err
+				}
+				if id == 0 {
+					result.Conflicts++
+				} else {
+					result.Created++
+				}
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("failed to look up account: %v", err)
+			}
+
+			profiles, err := loadAccountProfiles(o, account.Id)
+			if err != nil {
+				return result, err
+			}
+			if profiles.owner != nil || profiles.user == nil || !profiles.user.EmailVerified || !owner.EmailVerified {
+				result.Conflicts++
+				continue
+			}
+			if _, err := o.QueryTable("owner").Filter("id", owner.Id).Update(orm.Params{"account_id": account.Id}); err != nil {
+				return result, fmt.Errorf("failed to link owner %d: %v", owner.Id, err)
+			}
+			result.Linked++
+		}
+		if len(owners) < batch {
+			break
+		}
+	}
+
+	logger.InfoAny("Account migration finished", map[string]interface{}{
+		"created":   result.Created,
+		"linked":    result.Linked,
+		"conflicts": result.Conflicts,
+	})
+	return result, nil
+}
+
+// migrateProfile создаёт аккаунт для профиля; 0 — адрес пустой или уже занят
+func migrateProfile(o orm.Ormer, table string, profileID int64, email string) (int64, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return 0, nil
+	}
+	exists := o.QueryTable("account").Filter("email", email).Exist()
+	if exists {
+		return 0, nil
+	}
+
+	id, err := o.Insert(&Account{Email: email})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create account for %s %d: %v", table, profileID, err)
+	}
+	if _, err := o.QueryTable(table).Filter("id", profileID).Update(orm.Params{"account_id": id}); err != nil {
+		return 0, fmt.Errorf("failed to link %s %d: %v", table, profileID, err)
+	}
+	return id, nil
+}
+
+// loginCandidates находит профили по login: email аккаунта или имя посетителя.
+// Профили без аккаунта (адрес занят) ищутся по своим адресам.
+func loginCandidates(o orm.Ormer, login string) ([]*accountProfiles, error) {
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return nil, nil
+	}
+
+	if !strings.Contains(login, "@") {
+		var user User
+		err := o.QueryTable("user").Filter("username", login).One(&user)
+		if errors.Is(err, orm.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.AccountId == 0 {
+			return []*accountProfiles{{user: &user}}, nil
+		}
+		profiles, err := loadAccountProfiles(o, user.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		return []*accountProfiles{profiles}, nil
+	}
+
+	var candidates []*accountProfiles
+	var account Account
+	err := o.QueryTable("account").Filter("email", normalizeEmail(login)).One(&account)
+	if err == nil {
+		profiles, err := loadAccountProfiles(o, account.Id)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, profiles)
+	} else if !errors.Is(err, orm.ErrNoRows) {
+		return nil, err
+	}
+
+	var owner Owner
+	if err := o.QueryTable("owner").Filter("contact_email", login).Filter("account_id", 0).One(&owner); err == nil {
+		candidates = append(candidates, &accountProfiles{owner: &owner})
+	}
+	var user User
+	if err := o.QueryTable("user").Filter("email", login).Filter("account_id", 0).One(&user); err == nil {
+		candidates = append(candidates, &accountProfiles{user: &user})
+	}
+	return candidates, nil
+}
+
+// LoginAccount — единый вход для посетителей и владельцев. Пароль проверяется по профилям
+// аккаунта; токен выдаётся для профиля посетителя (или владельца, если пароль посетителя
+// не подошёл) и открывает только профили, чей пароль совпал: пароль посетителя не даёт
+// действовать от имени владельца. Остальные профили аккаунта попадают в токен
+// с PasswordRequired. Если пароль подошёл к владельцу с 2FA, возвращается MFAChallenge,
+// как в LoginOwner.
+func LoginAccount(req AccountLoginRequest, client SessionClient) (*OwnerLogin, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	candidates, err := loginCandidates(o, req.Login)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *User
+	var owner *Owner
+	for _, candidate := range candidates {
+		if candidate.user != nil {
+			if ok, upgrade := CheckPassword(req.Password, candidate.user.Password); ok {
+				if upgrade {
+					upgradeUserPassword(o, candidate.user, req.Password)
+				}
+				user = candidate.user
+			}
+		}
+		if candidate.owner != nil {
+			if ok, upgrade := CheckPassword(req.Password, candidate.owner.Password); ok {
+				if upgrade {
+					upgradeOwnerPassword(o, candidate.owner, req.Password)
+				}
+				owner = candidate.owner
+			}
+		}
+		if user != nil || owner != nil {
+			break
+		}
+	}
+	if user == nil && owner == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if user != nil && user.Blocked {
+		user = nil
+	}
+	if owner != nil && owner.Blocked {
+		owner = nil
+	}
+	if owner != nil {
+		mfaEnabled, err := ownerMFAEnabled(o, owner.Id)
+		if err != nil {
+			return nil, err
+		}
+		if mfaEnabled {
+			challenge, err := newMFAChallenge(owner.Id)
+			if err != nil {
+				return nil, err
+			}
+			return &OwnerLogin{MFAChallenge: challenge}, nil
+		}
+	}
+
+	var tokens *TokenPair
+	switch {
+	case user != nil:
+		var verified []string
+		if owner != nil {
+			verified = []string{RoleOwner}
+		}
+		tokens, err = issueTokenPair(RoleVisitor, user.Id, "", client, verified, func(sessionID string) (string, error) {
+			return CreateToken(*user, sessionID)
+		})
+	case owner != nil:
+		tokens, err = issueOwnerTokens(*owner, "", client)
+	default:
+		return nil, ErrAccountBlocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &OwnerLogin{TokenPair: tokens}, nil
+}
+
+// LinkProfile присоединяет к аккаунту субъекта недостающий профиль (посетителя или владельца),
+// владение которым подтверждается его логином и паролем. Прежний аккаунт присоединённого
+// профиля удаляется, если в нём не осталось профилей. Новые профили появятся в токене
+// после обновления токенов или нового входа.
+func LinkProfile(p *Principal, req LinkProfileRequest, ip string) error {
+	if p.AccountID == 0 {
+		return ErrNoAccount
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	profiles, err := loadAccountProfiles(o, p.AccountID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		role        string
+		profileID   int64
+		prevAccount int64
+	)
+	switch {
+	case profiles.owner == nil:
+		var owner Owner
+		if err := o.QueryTable("owner").Filter("contact_email", strings.TrimSpace(req.Login)).One(&owner); err != nil {
+			return ErrInvalidCredentials
+		}
+		if ok, _ := CheckPassword(req.Password, owner.Password); !ok {
+			return ErrInvalidCredentials
+		}
+		if owner.Blocked {
+			return ErrAccountBlocked
+		}
+		role, profileID, prevAccount = RoleOwner, owner.Id, owner.AccountId
+	case profiles.user == nil:
+		field := "username"
+		if strings.Contains(req.Login, "@") {
+			field = "email"
+		}
+		var user User
+		if err := o.QueryTable("user").Filter(field, strings.TrimSpace(req.Login)).One(&user); err != nil {
+			return ErrInvalidCredentials
+		}
+		if ok, _ := CheckPassword(req.Password, user.Password); !ok {
+			return ErrInvalidCredentials
+		}
+		if user.Blocked {
+			return ErrAccountBlocked
+		}
+		role, profileID, prevAccount = RoleVisitor, user.Id, user.AccountId
+	default:
+		return ErrProfileAlreadyLinked
+	}
+
+	_, err = o.QueryTable(profileTable(role)).Filter("id", profileID).Update(orm.Params{"account_id": p.AccountID})
+	if err != nil {
+		return fmt.Errorf("failed to link profile: %v", err)
+	}
+	if prevAccount != 0 && prevAccount != p.AccountID {
+		removeEmptyAccount(o, prevAccount)
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "account.link",
+		ActorType:  p.Role,
+		ActorId:    p.ID,
+		EntityType: "account",
+		EntityId:   strconv.FormatInt(p.AccountID, 10),
+		IP:         ip,
+	}, map[string]interface{}{
+		"profile_type":   role,
+		"profile_id":     profileID,
+		"merged_account": prevAccount,
+	})
+	return nil
+}
+
+// removeEmptyAccount удаляет аккаунт, если в нём не осталось профилей
+func removeEmptyAccount(o orm.Ormer, accountID int64) {
+	logFields := map[string]interface{}{
+		"account_id": accountID,
+	}
+
+	profiles, err := loadAccountProfiles(o, accountID)
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.WarnAny("Failed to check merged account", logFields)
+		return
+	}
+	if profiles.user != nil || profiles.owner != nil {
+		return
+	}
+	if _, err := o.Delete(&Account{Id: accountID}); err != nil {
+		logFields["error"] = err.Error()
+		logger.WarnAny("Failed to delete merged account", logFields)
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"errors"
+	"fmt"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// AccountSummary — данные аккаунта для административного списка (без пароля)
+type AccountSummary struct {
+	Id      int64  `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Blocked bool   `json:"blocked"`
+}
+
+// Summary — посетитель в ответах API, без хеша пароля
+func (u User) Summary() AccountSummary {
+	return AccountSummary{Id: u.Id, Name: u.Username, Email: u.Email, Blocked: u.Blocked}
+}
+
+// Summary — владелец в ответах API, без хеша пароля
+func (ow Owner) Summary() AccountSummary {
+	return AccountSummary{Id: ow.Id, Name: ow.Fullname, Email: ow.Email, Blocked: ow.Blocked}
+}
+
+// ListUsers возвращает посетителей, включая заблокированных
+func ListUsers(limit, offset int) ([]AccountSummary, error) {
+	var users []User
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("user").OrderBy("id").Limit(limit, offset).All(&users, "Id", "Username", "Email", "Blocked")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	result := make([]AccountSummary, 0, len(users))
+	for _, u := range users {
+		result = append(result, u.Summary())
+	}
+	return result, nil
+}
+
+// ListOwners возвращает владельцев, включая заблокированных
+func ListOwners(limit, offset int) ([]AccountSummary, error) {
+	var owners []Owner
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("owner").OrderBy("id").Limit(limit, offset).All(&owners, "Id", "Fullname", "Email", "Blocked")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch owners: %v", err)
+	}
+
+	result := make([]AccountSummary, 0, len(owners))
+	for _, ow := range owners {
+		result = append(result, ow.Summary())
+	}
+	return result, nil
+}
+
+// ListCompaniesForAdmin возвращает компании, включая заблокированные
+func ListCompaniesForAdmin(limit, offset int) ([]Company, error) {
+	var companies []Company
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("company").OrderBy("id").Limit(limit, offset).All(&companies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	return companies, nil
+}
+
+// SetUserBlocked блокирует или разблокирует посетителя; при блокировке завершаются все его сессии
+func SetUserBlocked(id int64, blocked bool, actor Actor) error {
+	return setBlocked("user", RoleVisitor, id, blocked, actor)
+}
+
+// SetOwnerBlocked блокирует или разблокирует владельца; при блокировке завершаются все его сессии
+func SetOwnerBlocked(id int64, blocked bool, actor Actor) error {
+	return setBlocked("owner", RoleOwner, id, blocked, actor)
+}
+
+// SetCompanyBlocked скрывает компанию из публичных списков или возвращает её
+func SetCompanyBlocked(id int64, blocked bool, actor Actor) error {
+	return setBlocked("company", "", id, blocked, actor)
+}
+
+func setBlocked(table, subjectType string, id int64, blocked bool, actor Actor) error {
+	logFields := map[string]interface{}{
+		"entity":  table,
+		"id":      id,
+		"blocked": blocked,
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	wasBlocked := o.QueryTable(table).Filter("id", id).Filter("blocked", true).Exist()
+	n, err := o.QueryTable(table).Filter("id", id).Update(orm.Params{"blocked": blocked})
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to change blocked flag", logFields)
+		return fmt.Errorf("failed to update %s: %v", table, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	if table == "company" {
+		invalidateMapCache()
+	}
+	if blocked && subjectType != "" {
+		if err := RevokeAllSessions(subjectType, id); err != nil {
+			return err
+		}
+	}
+
+	entityType := subjectType
+	if entityType == "" {
+		entityType = table
+	}
+	action := entityType + ".block"
+	if !blocked {
+		action = entityType + ".unblock"
+	}
+	RecordChange(actor, action, entityType, id, map[string]bool{"Blocked": wasBlocked}, map[string]bool{"Blocked": blocked})
+
+	logger.InfoAny("Blocked flag changed", logFields)
+	return nil
+}
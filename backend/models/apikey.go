@@ -0,0 +1,266 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(APIKey))
+}
+
+// Области действия API-ключей: read — списки ключей и сессий владельца,
+// companies:write — изменение компаний. companies:write включает чтение.
+const (
+	ScopeRead           = "read"
+	ScopeCompaniesWrite = "companies:write"
+)
+
+var apiKeyScopes = map[string]bool{ScopeRead: true, ScopeCompaniesWrite: true}
+
+// Формат ключа: qt_<8 hex — видимый префикс>_<секрет>
+const (
+	APIKeyPrefix     = "qt_"
+	apiKeyIDLength   = 8
+	apiKeyNameMaxLen = 64
+
+	// apiKeyTouchInterval — как часто обновляется last_used_at, чтобы не писать в БД на каждый запрос
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid or revoked API key")
+	ErrInvalidAPIKeyScope = errors.New("unknown API key scope")
+	ErrInvalidAPIKeyName  = fmt.Errorf("API key name must be 1-%d characters", apiKeyNameMaxLen)
+)
+
+// APIKey — ключ владельца для интеграций. Хранится только sha256 от ключа;
+// префикс хранится открыто, чтобы владелец мог узнать ключ в списке.
+type APIKey struct {
+	Id         int64     `orm:"auto;column(id)"`
+	OwnerId    int64     `orm:"index;column(owner_id)"`
+	Name       string    `orm:"size(64);column(name)"`
+	Prefix     string    `orm:"unique;size(16);column(prefix)"`
+	KeyHash    string    `orm:"size(64);column(key_hash)"`
+	Scopes     string    `orm:"size(255);column(scopes)"`
+	CreatedAt  time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+	LastUsedAt time.Time `orm:"type(timestamp);null;column(last_used_at)"`
+	RevokedAt  time.Time `orm:"type(timestamp);null;column(revoked_at)"`
+}
+
+func (k *APIKey) TableName() string {
+	return "api_key"
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyInfo — ключ в ответах API, без хеша
+type APIKeyInfo struct {
+	Id         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreatedAPIKey — только что созданный ключ; сам ключ показывается один раз
+type CreatedAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+func (k *APIKey) Info() APIKeyInfo {
+	info := APIKeyInfo{
+		Id:        k.Id,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    splitScopes(k.Scopes),
+		CreatedAt: k.CreatedAt,
+	}
+	if !k.LastUsedAt.IsZero() {
+		t := k.LastUsedAt
+		info.LastUsedAt = &t
+	}
+	if !k.RevokedAt.IsZero() {
+		t := k.RevokedAt
+		info.RevokedAt = &t
+	}
+	return info
+}
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// HasScope сообщает, разрешает ли ключ, которым аутентифицирован субъект, действие со scope.
+// Для токенов входа ограничений нет.
+func (p *Principal) HasScope(scope string) bool {
+	if p.APIKeyID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope || (scope == ScopeRead && s == ScopeCompaniesWrite) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey сообщает, что Bearer-значение похоже на API-ключ, а не на JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// CreateAPIKey создаёт ключ владельца с указанными именем и областями действия
+func CreateAPIKey(ownerID int64, name string, scopes []string) (*CreatedAPIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > apiKeyNameMaxLen {
+		return nil, ErrInvalidAPIKeyName
+	}
+	if len(scopes) == 0 {
+		return nil, ErrInvalidAPIKeyScope
+	}
+	seen := make(map[string]bool)
+	var unique []string
+	for _, scope := range scopes {
+		if !apiKeyScopes[scope] {
+			return nil, ErrInvalidAPIKeyScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+
+	prefix := APIKeyPrefix + newTokenID()[:apiKeyIDLength]
+	raw := prefix + "_" + randomToken(32)
+
+	key := APIKey{
+		OwnerId: ownerID,
+		Name:    name,
+		Prefix:  prefix,
+		KeyHash: hashToken(raw),
+		Scopes:  strings.Join(unique, ","),
+	}
+	o := orm.NewOrmUsingDB("mydatabase")
+	id, err := o.Insert(&key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %v", err)
+	}
+	key.Id = id
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "api_key.create",
+		ActorType:  RoleOwner,
+		ActorId:    ownerID,
+		EntityType: "api_key",
+		EntityId:   strconv.FormatInt(id, 10),
+	}, map[string]interface{}{
+		"name":   key.Name,
+		"prefix": key.Prefix,
+		"scopes": unique,
+	})
+	return &CreatedAPIKey{APIKeyInfo: key.Info(), Key: raw}, nil
+}
+
+// ListAPIKeys возвращает ключи владельца, включая отозванные
+func ListAPIKeys(ownerID int64) ([]APIKeyInfo, error) {
+	var keys []APIKey
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.QueryTable("api_key").Filter("owner_id", ownerID).OrderBy("-created_at").All(&keys); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+
+	infos := make([]APIKeyInfo, 0, len(keys))
+	for i := range keys {
+		infos = append(infos, keys[i].Info())
+	}
+	return infos, nil
+}
+
+// RevokeAPIKey отзывает ключ владельца. Чужой или уже отозванный ключ — ErrNotFound.
+func RevokeAPIKey(ownerID, keyID int64) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	n, err := o.QueryTable("api_key").
+		Filter("id", keyID).
+		Filter("owner_id", ownerID).
+		Filter("revoked_at__isnull", true).
+		Update(orm.Params{"revoked_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "api_key.revoke",
+		ActorType:  RoleOwner,
+		ActorId:    ownerID,
+		EntityType: "api_key",
+		EntityId:   strconv.FormatInt(keyID, 10),
+	}, nil)
+	return nil
+}
+
+// AuthenticateAPIKey проверяет API-ключ и возвращает владельца как субъекта запроса
+// с областями действия ключа. Ключи заблокированных владельцев не принимаются.
+func AuthenticateAPIKey(raw string) (*Principal, error) {
+	prefixLen := len(APIKeyPrefix) + apiKeyIDLength
+	if !IsAPIKey(raw) || len(raw) <= prefixLen+1 || raw[prefixLen] != '_' {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key APIKey
+	o := orm.NewOrmUsingDB("mydatabase")
+	if err := o.QueryTable("api_key").Filter("prefix", raw[:prefixLen]).One(&key); err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(raw)), []byte(key.KeyHash)) != 1 || !key.RevokedAt.IsZero() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	owner := Owner{Id: key.OwnerId}
+	if err := o.Read(&owner); err != nil || owner.Blocked {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if now.Sub(key.LastUsedAt) >= apiKeyTouchInterval {
+		_, err := o.QueryTable("api_key").Filter("id", key.Id).Update(orm.Params{"last_used_at": now})
+		if err != nil {
+			logger.WarnAny("Failed to update API key last use", map[string]interface{}{
+				"api_key_id": key.Id,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	return &Principal{
+		ID:       owner.Id,
+		Role:     RoleOwner,
+		Roles:    SubjectRoles(RoleOwner, owner.Id),
+		APIKeyID: key.Id,
+		Scopes:   splitScopes(key.Scopes),
+
+		EmailVerified: owner.EmailVerified,
+	}, nil
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(AuditLog))
+}
+
+// AuditLog — запись журнала аудита о событии безопасности или изменении данных
+type AuditLog struct {
+	Id         int64     `orm:"auto;column(id)" json:"id"`
+	Action     string    `orm:"size(64);index;column(action)" json:"action"`
+	ActorType  string    `orm:"size(16);null;column(actor_type)" json:"actor_type,omitempty"`
+	ActorId    int64     `orm:"null;column(actor_id)" json:"actor_id,omitempty"`
+	EntityType string    `orm:"size(32);null;column(entity_type)" json:"entity_type,omitempty"`
+	EntityId   string    `orm:"size(191);null;column(entity_id)" json:"entity_id,omitempty"`
+	IP         string    `orm:"size(64);null;column(ip)" json:"ip,omitempty"`
+	RequestId  string    `orm:"size(64);null;index;column(request_id)" json:"request_id,omitempty"`
+	Details    string    `orm:"type(text);null;column(details)" json:"details,omitempty"`
+	Changes    string    `orm:"type(text);null;column(changes)" json:"changes,omitempty"`
+	CreatedAt  time.Time `orm:"auto_now_add;type(timestamp);index;column(created_at)" json:"created_at"`
+}
+
+// ActorSystem — тип инициатора для фоновых изменений (геокодирование, удаление аккаунтов)
+const ActorSystem = "system"
+
+// Actor — инициатор изменения: субъект запроса и его сессия, IP и идентификатор запроса.
+// Пустой Type — анонимный запрос.
+type Actor struct {
+	Type      string
+	ID        int64
+	APIKeyID  int64
+	SessionID string
+	IP        string
+	RequestID string
+}
+
+// SystemActor — инициатор фоновых изменений
+var SystemActor = Actor{Type: ActorSystem}
+
+// FieldChange — значение поля до и после изменения
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// auditRedacted — поля, значения которых не пишутся в журнал: видно только, что они изменились
+var auditRedacted = map[string]bool{
+	"Password": true,
+	"KeyHash":  true,
+	"Secret":   true,
+}
+
+const auditRedactedValue = "[redacted]"
+
+// auditSnapshot превращает модель в плоский набор полей. Связанные модели заменяются их Id,
+// чтобы в журнал не попадали чужие данные (например, владелец компании целиком).
+func auditSnapshot(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+	for name, value := range fields {
+		if nested, ok := value.(map[string]interface{}); ok {
+			fields[name] = nested["Id"]
+		}
+		if auditRedacted[name] {
+			fields[name] = auditRedactedValue
+		}
+	}
+	return fields
+}
+
+// diffSnapshots возвращает изменившиеся поля. Скрытые поля сравниваются по исходным значениям.
+func diffSnapshots(before, after interface{}) map[string]FieldChange {
+	from, to := auditSnapshot(before), auditSnapshot(after)
+	changes := make(map[string]FieldChange)
+	for name, value := range from {
+		if next, ok := to[name]; !ok || !reflect.DeepEqual(value, next) {
+			changes[name] = FieldChange{From: value, To: to[name]}
+		}
+	}
+	for name, value := range to {
+		if _, ok := from[name]; !ok {
+			changes[name] = FieldChange{From: nil, To: value}
+		}
+	}
+
+	for name := range auditRedacted {
+		if _, ok := changes[name]; ok {
+			continue
+		}
+		if redactedFieldChanged(before, after, name) {
+			changes[name] = FieldChange{From: auditRedactedValue, To: auditRedactedValue}
+		}
+	}
+	return changes
+}
+
+func redactedFieldChanged(before, after interface{}, name string) bool {
+	field := func(v interface{}) (reflect.Value, bool) {
+		rv := reflect.ValueOf(v)
+		if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+			return reflect.Value{}, false
+		}
+		rv = reflect.Indirect(rv)
+		if rv.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		f := rv.FieldByName(name)
+		return f, f.IsValid()
+	}
+	a, okA := field(before)
+	b, okB := field(after)
+	return okA && okB && !reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// RecordChange пишет в журнал изменение сущности entityType/entityID: before и after —
+// состояние до и после (nil при создании и удалении), в changes попадают только изменившиеся поля
+func RecordChange(actor Actor, action, entityType string, entityID int64, before, after interface{}) {
+	entry := AuditLog{
+		Action:     action,
+		ActorType:  actor.Type,
+		ActorId:    actor.ID,
+		EntityType: entityType,
+		EntityId:   strconv.FormatInt(entityID, 10),
+		IP:         actor.IP,
+		RequestId:  actor.RequestID,
+	}
+	if changes := diffSnapshots(before, after); len(changes) > 0 {
+		if b, err := json.Marshal(changes); err == nil {
+			entry.Changes = string(b)
+		}
+	}
+
+	var details map[string]interface{}
+	if actor.APIKeyID != 0 {
+		details = map[string]interface{}{"api_key_id": actor.APIKeyID}
+	}
+	WriteAudit(entry, details)
+}
+
+// WriteAudit сохраняет запись аудита; details сериализуется в JSON.
+// Ошибка записи только логируется, чтобы аудит не срывал основную операцию.
+func WriteAudit(entry AuditLog, details map[string]interface{}) {
+	logFields := map[string]interface{}{
+		"action":      entry.Action,
+		"entity_type": entry.EntityType,
+		"entity_id":   entry.EntityId,
+		"ip":          entry.IP,
+		"request_id":  entry.RequestId,
+	}
+
+	if len(details) > 0 {
+		if b, err := json.Marshal(details); err == nil {
+			entry.Details = string(b)
+		}
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.Insert(&entry); err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to write audit log entry", logFields)
+		return
+	}
+
+	logger.InfoAny("Audit: "+entry.Action, logFields)
+}
+
+// AuditFilter — условия выборки журнала аудита; пустые поля не ограничивают выборку
+type AuditFilter struct {
+	ActorType  string
+	ActorId    int64
+	EntityType string
+	EntityId   string
+	Action     string
+	RequestId  string
+	From       time.Time
+	To         time.Time
+}
+
+// AuditEntry — запись журнала в ответах API; details и changes отдаются как JSON
+type AuditEntry struct {
+	Id         int64                  `json:"id"`
+	Action     string                 `json:"action"`
+	ActorType  string                 `json:"actor_type,omitempty"`
+	ActorId    int64                  `json:"actor_id,omitempty"`
+	EntityType string                 `json:"entity_type,omitempty"`
+	EntityId   string                 `json:"entity_id,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+	RequestId  string                 `json:"request_id,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Changes    map[string]FieldChange `json:"changes,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// ListAudit возвращает записи журнала по фильтру, начиная с новых
+func ListAudit(filter AuditFilter, limit, offset int) ([]AuditEntry, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	qs := o.QueryTable("audit_log")
+	if filter.ActorType != "" {
+		qs = qs.Filter("actor_type", filter.ActorType)
+	}
+	if filter.ActorId != 0 {
+		qs = qs.Filter("actor_id", filter.ActorId)
+	}
+	if filter.EntityType != "" {
+		qs = qs.Filter("entity_type", filter.EntityType)
+	}
+	if filter.EntityId != "" {
+		qs = qs.Filter("entity_id", filter.EntityId)
+	}
+	if filter.Action != "" {
+		qs = qs.Filter("action", filter.Action)
+	}
+	if filter.RequestId != "" {
+		qs = qs.Filter("request_id", filter.RequestId)
+	}
+	if !filter.From.IsZero() {
+		qs = qs.Filter("created_at__gte", filter.From)
+	}
+	if !filter.To.IsZero() {
+		qs = qs.Filter("created_at__lt", filter.To)
+	}
+
+	var logs []AuditLog
+	if _, err := qs.OrderBy("-created_at", "-id").Limit(limit, offset).All(&logs); err != nil {
+		return nil, fmt.Errorf("failed to fetch audit log: %v", err)
+	}
+
+	entries := make([]AuditEntry, 0, len(logs))
+	for _, l := range logs {
+		entry := AuditEntry{
+			Id:         l.Id,
+			Action:     l.Action,
+			ActorType:  l.ActorType,
+			ActorId:    l.ActorId,
+			EntityType: l.EntityType,
+			EntityId:   l.EntityId,
+			IP:         l.IP,
+			RequestId:  l.RequestId,
+			CreatedAt:  l.CreatedAt,
+		}
+		if l.Details != "" {
+			_ = json.Unmarshal([]byte(l.Details), &entry.Details)
+		}
+		if l.Changes != "" {
+			_ = json.Unmarshal([]byte(l.Changes), &entry.Changes)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Роли субъектов, которым выдаются токены
+const (
+	RoleVisitor = "visitor"
+	RoleOwner   = "owner"
+)
+
+// TokenIssuer — значение iss во всех токенах QWERTY.TOWN
+const TokenIssuer = "qwerty.town"
+
+var ErrUnknownRole = errors.New("token has unknown role")
+
+// Claims — общий набор claims для токенов посетителей и владельцев.
+// sub — id пользователя или владельца, aud — qwerty.town/<role>.
+type Claims struct {
+	Role      string   `json:"role"`
+	Roles     []string `json:"roles,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	// EmailVerified — подтверждена ли почта на момент выдачи токена
+	EmailVerified bool `json:"email_verified"`
+	// AccountID и Profiles — аккаунт и все его профили, если профиль токена привязан к аккаунту
+	AccountID int64                   `json:"acc,omitempty"`
+	Profiles  map[string]ProfileClaim `json:"profiles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Principal — аутентифицированный субъект запроса
+type Principal struct {
+	ID        int64
+	Role      string
+	Roles     []string
+	SessionID string
+	TokenID   string
+	ExpiresAt time.Time
+
+	// APIKeyID и Scopes заполнены, если запрос аутентифицирован API-ключом, а не токеном входа
+	APIKeyID int64
+	Scopes   []string
+
+	AccountID int64
+	Profiles  map[string]ProfileClaim
+
+	EmailVerified bool
+
+	// сессия токена, если субъект получен через As для другого профиля аккаунта
+	sessionRole      string
+	sessionSubjectID int64
+}
+
+// Audience возвращает aud для токенов данной роли
+func Audience(role string) string {
+	return TokenIssuer + "/" + role
+}
+
+func newClaims(role string, subjectID int64, sessionID string) *Claims {
+	now := time.Now()
+	return &Claims{
+		Role:      role,
+		Roles:     SubjectRoles(role, subjectID),
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(subjectID, 10),
+			Audience:  jwt.ClaimStrings{Audience(role)},
+			Issuer:    TokenIssuer,
+			ID:        newTokenID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+		},
+	}
+}
+
+// verifyClaims проверяет подпись, срок, издателя, аудиторию и роль токена,
+// а также отсутствие jti в чёрном списке
+func verifyClaims(tokenString, role string) (*Claims, error) {
+	keyring, err := keyringFor(role)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyring.Keyfunc,
+		jwt.WithValidMethods(keyring.Algorithms()),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(Audience(role)),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Role != role {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if err := checkRevoked(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// purposeClaims — claims служебных токенов (подтверждение почты, второй шаг входа).
+// У каждого назначения своя аудитория, поэтому такие токены не подменяют access-токен и друг друга.
+type purposeClaims struct {
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func newPurposeClaims(role, audience string, subjectID int64, ttl time.Duration) *purposeClaims {
+	now := time.Now()
+	return &purposeClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(subjectID, 10),
+			Audience:  jwt.ClaimStrings{audience},
+			Issuer:    TokenIssuer,
+			ID:        newTokenID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// signPurposeClaims подписывает служебный токен ключом роли
+func signPurposeClaims(claims *purposeClaims) (string, error) {
+	keyring, err := keyringFor(claims.Role)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Sign(claims)
+}
+
+// verifyPurposeClaims проверяет подпись, срок, издателя и аудиторию служебного токена
+// и возвращает его claims вместе с id субъекта
+func verifyPurposeClaims(tokenString, role, audience string) (*purposeClaims, int64, error) {
+	keyring, err := keyringFor(role)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	claims := &purposeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyring.Keyfunc,
+		jwt.WithValidMethods(keyring.Algorithms()),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !token.Valid || claims.Role != role {
+		return nil, 0, fmt.Errorf("invalid token")
+	}
+
+	subjectID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid token subject: %v", err)
+	}
+	return claims, subjectID, nil
+}
+
+// Principal возвращает субъекта, описанного claims
+func (c *Claims) Principal() (*Principal, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token subject: %v", err)
+	}
+
+	p := &Principal{
+		ID:        id,
+		Role:      c.Role,
+		Roles:     c.Roles,
+		SessionID: c.SessionID,
+		TokenID:   c.ID,
+
+		AccountID: c.AccountID,
+		Profiles:  c.Profiles,
+
+		EmailVerified: c.EmailVerified,
+	}
+	if len(p.Roles) == 0 {
+		p.Roles = []string{c.Role}
+	}
+	if c.ExpiresAt != nil {
+		p.ExpiresAt = c.ExpiresAt.Time
+	}
+	return p, nil
+}
+
+// Authenticate проверяет токен любой роли и возвращает его субъекта.
+// Роль из непроверенного токена используется только для выбора ключа и аудитории.
+func Authenticate(tokenString string) (*Principal, error) {
+	var unverified Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &unverified); err != nil {
+		return nil, err
+	}
+
+	var (
+		claims *Claims
+		err    error
+	)
+	switch unverified.Role {
+	case RoleVisitor:
+		claims, err = VerifyToken(tokenString)
+	case RoleOwner:
+		claims, err = VerifyOwnerToken(tokenString)
+	default:
+		return nil, ErrUnknownRole
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claims.Principal()
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal кладёт субъекта в контекст запроса
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext возвращает субъекта запроса или nil, если запрос анонимный
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
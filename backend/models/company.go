@@ -2,11 +2,12 @@ package models
 
 import (
 	"api/pkg/geocoder"
+	"api/pkg/geohash"
 	"api/pkg/logger"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/beego/beego/v2/client/orm"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -16,7 +17,6 @@ func init() {
 }
 
 type PostCompanyRequest struct {
-	OwnerID          int64  `json:"owner_id"`
 	Name             string `json:"name"`
 	INN              string `json:"inn"`
 	OrganizationType string `json:"organization_type"`
@@ -37,16 +37,18 @@ type CompanyAddressResponse struct {
 type Company struct {
 	Id               int64     `orm:"auto;column(id)"`
 	Owner            *Owner    `orm:"rel(fk);column(owner_id)"`
-	Name             string    `orm:"column(name)"`
+	Name             string    `orm:"index;column(name)"`
 	INN              string    `orm:"column(inn)"`
-	OrganizationType string    `orm:"column(organization_type)"`
-	City             string    `orm:"column(city)"`
+	OrganizationType string    `orm:"index;column(organization_type)"`
+	City             string    `orm:"index;column(city)"`
 	Address          string    `orm:"column(address)"`
-	BusinessSphere   string    `orm:"column(business_sphere)"`
+	BusinessSphere   string    `orm:"index;column(business_sphere)"`
 	Description      string    `orm:"column(description);null"`
 	Lat              float64   `orm:"column(lat);null"`
 	Lon              float64   `orm:"column(lon);null"`
-	CreatedAt        time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+	Geohash          string    `orm:"size(12);column(geohash);null" json:"-"`
+	Blocked          bool      `orm:"default(false);column(blocked)"`
+	CreatedAt        time.Time `orm:"auto_now_add;type(timestamp);index;column(created_at)"`
 	UpdatedAt        time.Time `orm:"auto_now;type(timestamp);column(updated_at)"`
 }
 
@@ -74,67 +76,67 @@ func GetCompanyAddressById(id int64) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	fullAddress := fmt.Sprintf("%s, %s", company.City, company.Address, company.Lat, company.Lon)
+	fullAddress := fmt.Sprintf("%s, %s", company.City, company.Address)
 	return fullAddress, nil
 }
 
-func UpdateCompanyCoordinates(companyID int64, city, address, name string) {
-	logFields := map[string]interface{}{
-		"company_id": companyID,
-		"city":       city,
-		"address":    address,
-		"name":       name,
+// geocodeCompany геокодирует адрес компании и сохраняет координаты от имени системы.
+// Удалённая компания — ErrNotFound, адрес изменился во время запроса — errAddressChanged.
+func geocodeCompany(ctx context.Context, companyID int64) (geocoder.Result, error) {
+	if Geocoder == nil {
+		return geocoder.Result{}, errors.New("geocoder is not configured")
 	}
 
-	fullAddress := fmt.Sprintf("%s, %s, %s", city, address, name)
-	latStr, lonStr, err := geocoder.GetCoordinates(fullAddress)
-	if err != nil {
-		logger.ErrorAny("Failed to get coordinates", logFields)
-		return
-	}
-
-	lat, err := strconv.ParseFloat(latStr, 64)
-	if err != nil {
-		logFields["error"] = err.Error()
-		logFields["lat_str"] = latStr
-		logger.ErrorAny("Failed to parse latitude", logFields)
-		return
+	ormer := orm.NewOrmUsingDB("mydatabase")
+	before := Company{Id: companyID}
+	if err := ormer.Read(&before); err != nil {
+		if errors.Is(err, orm.ErrNoRows) {
+			return geocoder.Result{}, ErrNotFound
+		}
+		return geocoder.Result{}, fmt.Errorf("failed to load company: %v", err)
 	}
 
-	lon, err := strconv.ParseFloat(lonStr, 64)
+	// Название компании в запрос не входит: по нему провайдеры адрес не находят
+	result, err := Geocoder.Geocode(ctx, fmt.Sprintf("%s, %s", before.City, before.Address))
 	if err != nil {
-		logFields["error"] = err.Error()
-		logFields["lon_str"] = lonStr
-		logger.ErrorAny("Failed to parse longitude", logFields)
-		return
+		return geocoder.Result{}, err
 	}
 
-	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
-		logFields["lat"] = lat
-		logFields["lon"] = lon
-		logger.ErrorAny("Invalid coordinates", logFields)
-		return
-	}
-
-	ormer := orm.NewOrmUsingDB("mydatabase")
-	_, err = ormer.QueryTable("company").
+	// Если адрес успели изменить, координаты старого не записываются: новый адрес
+	// геокодирует задача, которую поставил UpdateCompany
+	n, err := ormer.QueryTable("company").
 		Filter("id", companyID).
+		Filter("city", before.City).
+		Filter("address", before.Address).
 		Update(orm.Params{
-			"lat": lat,
-			"lon": lon,
+			"lat":     result.Lat,
+			"lon":     result.Lon,
+			"geohash": geohash.Encode(result.Lat, result.Lon, geohash.MaxPrecision),
 		})
 	if err != nil {
-		logFields["error"] = err.Error()
-		logger.ErrorAny("Failed to update company coordinates", logFields)
-		return
+		return geocoder.Result{}, fmt.Errorf("failed to update company coordinates: %v", err)
 	}
-
-	logFields["lat"] = lat
-	logFields["lon"] = lon
-	logger.InfoAny("Company coordinates updated successfully", logFields)
+	if n == 0 {
+		return geocoder.Result{}, errAddressChanged
+	}
+	invalidateMapCache()
+	after := before
+	after.Lat, after.Lon = result.Lat, result.Lon
+	after.Geohash = geohash.Encode(result.Lat, result.Lon, geohash.MaxPrecision)
+	RecordChange(SystemActor, "company.geocode", "company", companyID, before, after)
+
+	logger.InfoAny("Company coordinates updated successfully", map[string]interface{}{
+		"company_id":         companyID,
+		"lat":                result.Lat,
+		"lon":                result.Lon,
+		"provider":           result.Provider,
+		"precision":          result.Precision,
+		"normalized_address": result.Address,
+	})
+	return result, nil
 }
 
-func AddCompany(c Company) (int64, error) {
+func AddCompany(c Company, actor Actor) (int64, error) {
 	logFields := map[string]interface{}{
 		"Id":   c.Id,
 		"Name": c.Name,
@@ -171,7 +173,14 @@ func AddCompany(c Company) (int64, error) {
 	logFields["company_id"] = id
 	logger.InfoAny("Company created successfully", logFields)
 
-	go UpdateCompanyCoordinates(id, c.City, c.Address, c.Name)
+	c.Id = id
+	refreshCompanySearch(ormer, id)
+	RecordChange(actor, "company.create", "company", id, nil, c)
+
+	if err := EnqueueGeocode(id); err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to enqueue company geocoding", logFields)
+	}
 
 	return id, nil
 }
@@ -183,20 +192,55 @@ func GetCompany(cid int64) (c *Company, err error) {
 	if err == orm.ErrNoRows {
 		return nil, errors.New("Company with this id not found")
 	}
+	if err != nil {
+		return nil, err
+	}
 	return &company, nil
 }
 
-func UpdateCompany(c *Company) error {
+// UpdateCompany сохраняет изменяемые поля компании и пишет в журнал аудита разницу с прежними.
+// Если изменились город или адрес, компания заново ставится в очередь геокодирования.
+func UpdateCompany(c *Company, actor Actor) error {
 	o := orm.NewOrmUsingDB("mydatabase")
-	_, err := o.Update(c, "name", "city", "address", "organization_type", "business_sphere", "description")
-	return err
+	before := Company{Id: c.Id}
+	if err := o.Read(&before); err != nil {
+		return fmt.Errorf("failed to load company: %v", err)
+	}
+
+	if _, err := o.Update(c, "name", "city", "address", "organization_type", "business_sphere", "description"); err != nil {
+		return err
+	}
+	refreshCompanySearch(o, c.Id)
+	invalidateMapCache()
+
+	after := before
+	after.Name, after.City, after.Address = c.Name, c.City, c.Address
+	after.OrganizationType, after.BusinessSphere, after.Description = c.OrganizationType, c.BusinessSphere, c.Description
+	RecordChange(actor, "company.update", "company", c.Id, before, after)
+
+	if before.City != c.City || before.Address != c.Address {
+		if err := EnqueueGeocode(c.Id); err != nil {
+			logger.ErrorAny("Failed to enqueue company geocoding", map[string]interface{}{
+				"company_id": c.Id,
+				"error":      err.Error(),
+			})
+		}
+	}
+	return nil
 }
 
-func DeleteCompany(uid int64) error {
+func DeleteCompany(uid int64, actor Actor) error {
 	o := orm.NewOrmUsingDB("mydatabase")
+	before := Company{Id: uid}
+	if err := o.Read(&before); err != nil {
+		return fmt.Errorf("failed to load company: %v", err)
+	}
 	if _, err := o.Delete(&Company{Id: uid}); err != nil {
 		return fmt.Errorf("failed to delete company: %v", err)
 	}
+	invalidateMapCache()
+
+	RecordChange(actor, "company.delete", "company", uid, before, nil)
 	return nil
 }
 
@@ -215,15 +259,3 @@ func GetOwnerCompanies(ownerId int64) ([]Company, error) {
 
 	return companies, nil
 }
-
-func GetAllCompanies() ([]Company, error) {
-	var companies []Company
-	o := orm.NewOrmUsingDB("mydatabase")
-	qb, _ := orm.NewQueryBuilder("postgres")
-	qb.Select("id", "name", "city", "address", "lat", "lon").From("company").Where("id > ?").OrderBy("id").Desc().Limit(10)
-	_, err := o.Raw(qb.String(), 0).QueryRows(&companies)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch companies: %v", err)
-	}
-	return companies, nil
-}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// Размер страницы списков компаний
+const (
+	CompanyPageDefault = 50
+	CompanyPageMax     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid or expired cursor")
+	ErrInvalidSort   = errors.New("unknown sort: use id, name or created_at, with - for descending")
+)
+
+// companySortColumns — допустимые поля сортировки и их колонки
+var companySortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+}
+
+// CompanyListParams — фильтры, сортировка и курсор списка компаний. Пустые поля не ограничивают выборку.
+type CompanyListParams struct {
+	City             string
+	BusinessSphere   string
+	OrganizationType string
+	OwnerID          int64
+	HasCoordinates   *bool
+	CreatedFrom      time.Time
+	CreatedTo        time.Time
+
+	// Sort — id, name или created_at; с префиксом "-" — по убыванию. По умолчанию -id.
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// CompanyPage — страница списка: компании, общее число подходящих под фильтры и курсор следующей страницы
+type CompanyPage struct {
+	Items      []Company
+	Total      int64
+	NextCursor string
+}
+
+// companyCursor — позиция последней компании страницы: значение поля сортировки и id
+// для однозначного порядка при совпадающих значениях
+type companyCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+func encodeCompanyCursor(c companyCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCompanyCursor(raw, sort string) (*companyCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c companyCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		// Курсор другой сортировки указывает не на ту позицию
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalize проверяет сортировку и размер страницы, подставляя значения по умолчанию;
+// страница больше CompanyPageMax урезается до него
+func (p *CompanyListParams) normalize() (field string, desc bool, err error) {
+	if p.Sort == "" {
+		p.Sort = "-id"
+	}
+	field = strings.TrimPrefix(p.Sort, "-")
+	desc = strings.HasPrefix(p.Sort, "-")
+	if _, ok := companySortColumns[field]; !ok {
+		return "", false, ErrInvalidSort
+	}
+	switch {
+	case p.Limit <= 0:
+		p.Limit = CompanyPageDefault
+	case p.Limit > CompanyPageMax:
+		p.Limit = CompanyPageMax
+	}
+	return field, desc, nil
+}
+
+// filter — условие по фильтрам списка; заблокированные компании в списки не попадают
+func (p *CompanyListParams) filter() *orm.Condition {
+	cond := orm.NewCondition().And("blocked", false)
+	if p.City != "" {
+		cond = cond.And("city__iexact", p.City)
+	}
+	if p.BusinessSphere != "" {
+		cond = cond.And("business_sphere__iexact", p.BusinessSphere)
+	}
+	if p.OrganizationType != "" {
+		cond = cond.And("organization_type__iexact", p.OrganizationType)
+	}
+	if p.OwnerID != 0 {
+		cond = cond.And("owner_id", p.OwnerID)
+	}
+	if p.HasCoordinates != nil {
+		// Координаты 0, 0 означают, что геокодирование ещё не выполнено
+		missing := orm.NewCondition().
+			Or("lat__isnull", true).Or("lon__isnull", true).
+			Or("lat", 0).Or("lon", 0)
+		if *p.HasCoordinates {
+			cond = cond.AndNotCond(missing)
+		} else {
+			cond = cond.AndCond(missing)
+		}
+	}
+	if !p.CreatedFrom.IsZero() {
+		cond = cond.And("created_at__gte", p.CreatedFrom)
+	}
+	if !p.CreatedTo.IsZero() {
+		cond = cond.And("created_at__lt", p.CreatedTo)
+	}
+	return cond
+}
+
+// after — условие «после курсора» для сортировки по field
+func (c *companyCursor) after(field string, desc bool) (*orm.Condition, error) {
+	op := "__gt"
+	if desc {
+		op = "__lt"
+	}
+	if field == "id" {
+		return orm.NewCondition().And("id"+op, c.ID), nil
+	}
+
+	var value interface{} = c.Value
+	if field == "created_at" {
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		value = t
+	}
+	column := companySortColumns[field]
+	tie := orm.NewCondition().And(column, value).And("id"+op, c.ID)
+	return orm.NewCondition().And(column+op, value).OrCond(tie), nil
+}
+
+func cursorValue(c Company, field string) string {
+	switch field {
+	case "name":
+		return c.Name
+	case "created_at":
+		return c.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+// ListCompanies возвращает страницу компаний по фильтрам. Пагинация курсорная: страница
+// продолжается после последней компании предыдущей, поэтому новые компании не сдвигают страницы.
+func ListCompanies(params CompanyListParams) (*CompanyPage, error) {
+	field, desc, err := params.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var after *orm.Condition
+	if params.Cursor != "" {
+		cursor, err := decodeCompanyCursor(params.Cursor, params.Sort)
+		if err != nil {
+			return nil, err
+		}
+		if after, err = cursor.after(field, desc); err != nil {
+			return nil, err
+		}
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	cond := params.filter()
+	total, err := o.QueryTable("company").SetCond(cond).Count()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count companies: %v", err)
+	}
+	if after != nil {
+		cond = cond.AndCond(after)
+	}
+
+	order := []string{params.Sort}
+	if field != "id" {
+		if desc {
+			order = append(order, "-id")
+		} else {
+			order = append(order, "id")
+		}
+	}
+
+	var companies []Company
+	_, err = o.QueryTable("company").SetCond(cond).OrderBy(order...).Limit(params.Limit + 1).All(&companies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+
+	page := &CompanyPage{Items: companies, Total: total}
+	if len(companies) > params.Limit {
+		page.Items = companies[:params.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeCompanyCursor(companyCursor{Sort: params.Sort, Value: cursorValue(last, field), ID: last.Id})
+	}
+	if page.Items == nil {
+		page.Items = []Company{}
+	}
+	return page, nil
+}
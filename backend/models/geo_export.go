@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// Выгрузка компаний в стандартных геоформатах: GeoJSON (RFC 7946) и KML 2.2.
+// Координаты — числа в порядке долгота, широта, как требуют оба формата.
+
+// GeoJSONFeatureCollection — набор точек компаний
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature — компания-точка
+type GeoJSONFeature struct {
+	Type       string            `json:"type"`
+	ID         int64             `json:"id"`
+	Geometry   GeoJSONPoint      `json:"geometry"`
+	Properties CompanyProperties `json:"properties"`
+}
+
+// GeoJSONPoint — геометрия Point; Coordinates — [долгота, широта]
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// CompanyProperties — свойства компании в выгрузке
+type CompanyProperties struct {
+	ID               int64  `json:"id"`
+	Name             string `json:"name"`
+	City             string `json:"city"`
+	Address          string `json:"address"`
+	BusinessSphere   string `json:"business_sphere"`
+	OrganizationType string `json:"organization_type"`
+	Description      string `json:"description,omitempty"`
+}
+
+func companyProperties(c Company) CompanyProperties {
+	return CompanyProperties{
+		ID:               c.Id,
+		Name:             c.Name,
+		City:             c.City,
+		Address:          c.Address,
+		BusinessSphere:   c.BusinessSphere,
+		OrganizationType: c.OrganizationType,
+		Description:      c.Description,
+	}
+}
+
+// ExportCompanies возвращает все незаблокированные компании с координатами, подходящие под фильтры.
+// Сортировка и курсор из params не используются.
+func ExportCompanies(params CompanyListParams) ([]Company, error) {
+	var companies []Company
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.QueryTable("company").SetCond(geoFilter(params)).OrderBy("id").Limit(-1).All(&companies); err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	return companies, nil
+}
+
+// CompaniesGeoJSON собирает FeatureCollection из компаний
+func CompaniesGeoJSON(companies []Company) GeoJSONFeatureCollection {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]GeoJSONFeature, 0, len(companies))}
+	for _, c := range companies {
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type:       "Feature",
+			ID:         c.Id,
+			Geometry:   GeoJSONPoint{Type: "Point", Coordinates: [2]float64{c.Lon, c.Lat}},
+			Properties: companyProperties(c),
+		})
+	}
+	return collection
+}
+
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	ID          string    `xml:"id,attr"`
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	Coordinates string    `xml:"Point>coordinates"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// CompaniesKML собирает документ KML с меткой на каждую компанию; свойства — в ExtendedData
+func CompaniesKML(companies []Company) ([]byte, error) {
+	doc := kmlDocument{Name: "Companies", Placemarks: make([]kmlPlacemark, 0, len(companies))}
+	for _, c := range companies {
+		p := companyProperties(c)
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			ID:          "company-" + strconv.FormatInt(c.Id, 10),
+			Name:        p.Name,
+			Description: p.Description,
+			Data: []kmlData{
+				{Name: "id", Value: strconv.FormatInt(p.ID, 10)},
+				{Name: "city", Value: p.City},
+				{Name: "address", Value: p.Address},
+				{Name: "business_sphere", Value: p.BusinessSphere},
+				{Name: "organization_type", Value: p.OrganizationType},
+			},
+			Coordinates: strconv.FormatFloat(c.Lon, 'f', -1, 64) + "," + strconv.FormatFloat(c.Lat, 'f', -1, 64),
+		})
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode KML: %v", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
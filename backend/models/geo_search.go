@@ -0,0 +1,311 @@
+package models
+
+import (
+	"api/pkg/geohash"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Геопоиск по компаниям. Пространственный индекс — геохеш координат компании (колонка geohash
+// с btree-индексом, см. EnsureCompanyGeoIndex): прямоугольник поиска покрывается несколькими
+// ячейками геохеша, и кандидаты выбираются по их префиксам, а затем по точным диапазонам lat/lon.
+// Кандидатов выбирается не больше geo_candidates_max; точное расстояние по формуле гаверсинусов
+// считается в приложении. Фильтры списка (город, сфера, тип организации, владелец, дата создания)
+// применяются так же, как в ListCompanies.
+
+const earthRadiusMeters = 6371008.8
+
+// Размер выборки геопоиска
+const (
+	GeoLimitDefault = 50
+	GeoLimitMax     = 500
+)
+
+// geoCoverCells — сколько ячеек геохеша покрывают прямоугольник поиска
+const geoCoverCells = 16
+
+var (
+	ErrInvalidPoint  = errors.New("lat must be within [-90, 90] and lon within [-180, 180]")
+	ErrInvalidRadius = errors.New("radius must be positive and not exceed the maximum search radius")
+	ErrInvalidBBox   = errors.New("bbox must be west,south,east,north with south <= north")
+	ErrGeoTooDense   = errors.New("too many companies in the search area, narrow the radius or add filters")
+)
+
+// GeoPoint — точка в градусах WGS 84
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// Valid проверяет диапазоны широты и долготы
+func (p GeoPoint) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// BBox — прямоугольник видимой области карты. West > East — область пересекает 180-й меридиан.
+type BBox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+// Valid проверяет, что углы — допустимые точки, а юг не севернее севера
+func (b BBox) Valid() bool {
+	return GeoPoint{Lat: b.South, Lon: b.West}.Valid() && GeoPoint{Lat: b.North, Lon: b.East}.Valid() && b.South <= b.North
+}
+
+// GeoCompany — компания в ответах геопоиска: координаты числами, Distance — расстояние
+// до точки запроса в метрах (для поиска по области не заполняется)
+type GeoCompany struct {
+	Id               int64    `json:"id"`
+	Name             string   `json:"name"`
+	City             string   `json:"city"`
+	Address          string   `json:"address"`
+	BusinessSphere   string   `json:"business_sphere"`
+	OrganizationType string   `json:"organization_type"`
+	Lat              float64  `json:"lat"`
+	Lon              float64  `json:"lon"`
+	Distance         *float64 `json:"distance_m,omitempty"`
+}
+
+func newGeoCompany(c Company) GeoCompany {
+	return GeoCompany{
+		Id:               c.Id,
+		Name:             c.Name,
+		City:             c.City,
+		Address:          c.Address,
+		BusinessSphere:   c.BusinessSphere,
+		OrganizationType: c.OrganizationType,
+		Lat:              c.Lat,
+		Lon:              c.Lon,
+	}
+}
+
+// GeoMaxRadius — наибольший радиус поиска в метрах; им же ограничен поиск ближайших
+func GeoMaxRadius() float64 {
+	return beego.AppConfig.DefaultFloat("geo_max_radius", 50000)
+}
+
+// GeoCandidatesMax — наибольшее число кандидатов, которое поиск по радиусу проверяет в приложении
+func GeoCandidatesMax() int {
+	return beego.AppConfig.DefaultInt("geo_candidates_max", 5000)
+}
+
+// EnsureCompanyGeoIndex создаёт индекс геохешей компаний (RunSyncdb не задаёт класс операторов,
+// нужный для поиска по префиксу) и заполняет геохеш компаний, геокодированных до его появления
+func EnsureCompanyGeoIndex() error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.Raw(`CREATE INDEX IF NOT EXISTS company_geohash_idx ON company (geohash varchar_pattern_ops)`).Exec(); err != nil {
+		return fmt.Errorf("failed to create company geohash index: %v", err)
+	}
+
+	const batch = 500
+	for {
+		var companies []Company
+		// Заблокированные компании тоже: после разблокировки они снова попадают в поиск
+		if _, err := o.QueryTable("company").
+			Filter("geohash__isnull", true).
+			Exclude("lat", 0).
+			Exclude("lon", 0).
+			Limit(batch).
+			All(&companies, "Id", "Lat", "Lon"); err != nil {
+			return fmt.Errorf("failed to load companies without geohash: %v", err)
+		}
+		for _, c := range companies {
+			hash := geohash.Encode(c.Lat, c.Lon, geohash.MaxPrecision)
+			if _, err := o.QueryTable("company").Filter("id", c.Id).Update(orm.Params{"geohash": hash}); err != nil {
+				return fmt.Errorf("failed to set geohash of company %d: %v", c.Id, err)
+			}
+		}
+		if len(companies) < batch {
+			return nil
+		}
+	}
+}
+
+// DistanceMeters — расстояние по большому кругу между точками
+func DistanceMeters(a, b GeoPoint) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// boundingBox — прямоугольник, описанный вокруг круга радиусом radius метров
+func boundingBox(center GeoPoint, radius float64) BBox {
+	dLat := radius / earthRadiusMeters * 180 / math.Pi
+	south, north := center.Lat-dLat, center.Lat+dLat
+	if south <= -90 || north >= 90 {
+		// Круг накрывает полюс — подходят все долготы
+		return BBox{West: -180, South: math.Max(south, -90), East: 180, North: math.Min(north, 90)}
+	}
+
+	dLon := dLat / math.Cos(center.Lat*math.Pi/180)
+	if dLon >= 180 {
+		return BBox{West: -180, South: south, East: 180, North: north}
+	}
+	west, east := center.Lon-dLon, center.Lon+dLon
+	if west < -180 {
+		west += 360
+	}
+	if east > 180 {
+		east -= 360
+	}
+	return BBox{West: west, South: south, East: east, North: north}
+}
+
+// cond — условие попадания координат компании в прямоугольник: префиксы покрывающих его
+// ячеек геохеша (по ним работает индекс) и точные диапазоны координат
+func (b BBox) cond() *orm.Condition {
+	cond := orm.NewCondition().And("lat__gte", b.South).And("lat__lte", b.North)
+	if b.West <= b.East {
+		cond = cond.And("lon__gte", b.West).And("lon__lte", b.East)
+	} else {
+		cond = cond.AndCond(orm.NewCondition().Or("lon__gte", b.West).Or("lon__lte", b.East))
+	}
+
+	if cells := geohash.Cover(b.South, b.West, b.North, b.East, geoCoverCells); cells != nil {
+		prefixes := orm.NewCondition()
+		for _, cell := range cells {
+			prefixes = prefixes.Or("geohash__startswith", cell)
+		}
+		cond = cond.AndCond(prefixes)
+	}
+	return cond
+}
+
+// geoFilter — фильтры списка плюс обязательное наличие координат
+func geoFilter(params CompanyListParams) *orm.Condition {
+	hasCoordinates := true
+	params.HasCoordinates = &hasCoordinates
+	return params.filter()
+}
+
+// geoLimit — число компаний в ответе; больше GeoLimitMax урезается до него
+func geoLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return GeoLimitDefault
+	case limit > GeoLimitMax:
+		return GeoLimitMax
+	}
+	return limit
+}
+
+// companiesByDistance возвращает компании не дальше radius от center, ближние первыми.
+// Если в описанном прямоугольнике больше GeoCandidatesMax компаний — ErrGeoTooDense.
+func companiesByDistance(params CompanyListParams, center GeoPoint, radius float64) ([]GeoCompany, error) {
+	var companies []Company
+	o := orm.NewOrmUsingDB("mydatabase")
+	cond := geoFilter(params).AndCond(boundingBox(center, radius).cond())
+	candidatesMax := GeoCandidatesMax()
+	if _, err := o.QueryTable("company").SetCond(cond).Limit(candidatesMax + 1).All(&companies); err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+	if len(companies) > candidatesMax {
+		return nil, ErrGeoTooDense
+	}
+
+	result := make([]GeoCompany, 0, len(companies))
+	for _, c := range companies {
+		distance := DistanceMeters(center, GeoPoint{Lat: c.Lat, Lon: c.Lon})
+		if distance > radius {
+			continue
+		}
+		item := newGeoCompany(c)
+		item.Distance = &distance
+		result = append(result, item)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if *result[i].Distance != *result[j].Distance {
+			return *result[i].Distance < *result[j].Distance
+		}
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
+
+// CompaniesWithinRadius возвращает до limit ближайших компаний в радиусе radius метров от center
+// и общее число компаний в радиусе
+func CompaniesWithinRadius(params CompanyListParams, center GeoPoint, radius float64, limit int) ([]GeoCompany, int64, error) {
+	if !center.Valid() {
+		return nil, 0, ErrInvalidPoint
+	}
+	if radius <= 0 || radius > GeoMaxRadius() {
+		return nil, 0, ErrInvalidRadius
+	}
+
+	companies, err := companiesByDistance(params, center, radius)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := int64(len(companies))
+	if limit = geoLimit(limit); len(companies) > limit {
+		companies = companies[:limit]
+	}
+	return companies, total, nil
+}
+
+// NearestCompanies возвращает n ближайших к center компаний. Радиус поиска удваивается, начиная
+// с километра, пока не найдётся n компаний; дальше GeoMaxRadius компании не ищутся. Если
+// в очередном радиусе слишком много кандидатов, радиус уменьшается вдвое до прежнего.
+func NearestCompanies(params CompanyListParams, center GeoPoint, n int) ([]GeoCompany, error) {
+	if !center.Valid() {
+		return nil, ErrInvalidPoint
+	}
+	n = geoLimit(n)
+	maxRadius := GeoMaxRadius()
+
+	// searched — радиус, в котором компаний меньше n
+	searched := 0.0
+	for radius := math.Min(1000, maxRadius); ; {
+		companies, err := companiesByDistance(params, center, radius)
+		if errors.Is(err, ErrGeoTooDense) && radius-searched > 1 {
+			radius = (searched + radius) / 2
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Все компании ближе radius уже найдены, поэтому первые n из них — ближайшие вообще
+		if len(companies) >= n || radius >= maxRadius {
+			if len(companies) > n {
+				companies = companies[:n]
+			}
+			return companies, nil
+		}
+		searched, radius = radius, math.Min(radius*2, maxRadius)
+	}
+}
+
+// CompaniesInBBox возвращает до limit компаний в видимой области карты и общее число компаний в ней
+func CompaniesInBBox(params CompanyListParams, box BBox, limit int) ([]GeoCompany, int64, error) {
+	if !box.Valid() {
+		return nil, 0, ErrInvalidBBox
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	cond := geoFilter(params).AndCond(box.cond())
+	total, err := o.QueryTable("company").SetCond(cond).Count()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count companies: %v", err)
+	}
+
+	var companies []Company
+	if _, err := o.QueryTable("company").SetCond(cond).OrderBy("-id").Limit(geoLimit(limit)).All(&companies); err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+
+	result := make([]GeoCompany, 0, len(companies))
+	for _, c := range companies {
+		result = append(result, newGeoCompany(c))
+	}
+	return result, total, nil
+}
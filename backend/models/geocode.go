@@ -0,0 +1,61 @@
+package models
+
+import (
+	"api/pkg/geocoder"
+	"api/pkg/logger"
+	"fmt"
+	"strings"
+	"time"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Geocoder находит координаты адресов компаний. Заполняется LoadGeocoder при старте;
+// тесты подставляют geocoder.Static.
+var Geocoder geocoder.Geocoder
+
+// LoadGeocoder собирает цепочку провайдеров из geocoder_providers в app.conf (yandex, nominatim,
+// static через запятую, в порядке опроса). Провайдер без обязательной настройки пропускается
+// с предупреждением, неизвестное имя — ошибка.
+func LoadGeocoder() error {
+	timeout := configDuration("geocoder_timeout", 10*time.Second)
+
+	var chain geocoder.Chain
+	for _, name := range strings.Split(beego.AppConfig.DefaultString("geocoder_providers", "yandex,nominatim"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "yandex":
+			key := beego.AppConfig.DefaultString("geocoder_yandex_api_key", "")
+			if key == "" {
+				logger.WarnAny("Yandex geocoder has no API key, skipping")
+				continue
+			}
+			chain = append(chain, geocoder.NewYandex(key, timeout))
+		case "nominatim":
+			nominatim := geocoder.NewNominatim(
+				beego.AppConfig.DefaultString("geocoder_nominatim_url", geocoder.NominatimURL),
+				beego.AppConfig.DefaultString("geocoder_nominatim_email", ""),
+				timeout,
+			)
+			nominatim.Interval = configDuration("geocoder_nominatim_interval", geocoder.NominatimInterval)
+			chain = append(chain, nominatim)
+		case "static":
+			static, err := geocoder.LoadStatic(beego.AppConfig.DefaultString("geocoder_static_file", "geocoder.json"))
+			if err != nil {
+				return fmt.Errorf("static geocoder: %v", err)
+			}
+			chain = append(chain, static)
+		default:
+			return fmt.Errorf("unknown geocoder provider %q", name)
+		}
+	}
+
+	if len(chain) == 0 {
+		logger.WarnAny("No geocoder providers configured, company coordinates will not be resolved")
+		Geocoder = nil
+		return nil
+	}
+	Geocoder = chain
+	logger.InfoAny("Geocoder configured", map[string]interface{}{"providers": chain.Name()})
+	return nil
+}
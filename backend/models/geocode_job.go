@@ -0,0 +1,322 @@
+package models
+
+import (
+	"api/pkg/geocoder"
+	"api/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(GeocodeJob))
+}
+
+// Очередь геокодирования компаний.
+//
+// На каждую компанию — одна задача в таблице geocode_job, поэтому очередь переживает перезапуск.
+// Задачи разбирают geocode_workers обработчиков (на всех экземплярах приложения): задача
+// захватывается на geocode_job_lease и, если обработчик не успел её завершить (упал, перезапустился),
+// снова становится доступной. Временные ошибки (сеть, лимиты провайдера) повторяются с
+// экспоненциальной задержкой до geocode_max_attempts попыток; после этого, а также если адрес
+// не нашёл ни один провайдер, задача остаётся в статусе failed, пока администратор её не перезапустит.
+
+// Статусы задачи геокодирования
+const (
+	GeocodePending = "pending"
+	GeocodeRunning = "running"
+	GeocodeOK      = "ok"
+	GeocodeFailed  = "failed"
+)
+
+var (
+	ErrInvalidGeocodeStatus = errors.New("status must be pending, running, ok or failed")
+
+	errAddressChanged = errors.New("company address changed during geocoding")
+)
+
+// GeocodeJob — задача геокодирования компании
+type GeocodeJob struct {
+	Id          int64     `orm:"auto;column(id)" json:"id"`
+	CompanyId   int64     `orm:"unique;column(company_id)" json:"company_id"`
+	Status      string    `orm:"size(16);index;column(status)" json:"status"`
+	Attempts    int       `orm:"default(0);column(attempts)" json:"attempts"`
+	NextRunAt   time.Time `orm:"type(timestamp);index;column(next_run_at)" json:"next_run_at"`
+	LockedUntil time.Time `orm:"type(timestamp);null;column(locked_until)" json:"-"`
+	LeaseId     string    `orm:"size(32);null;column(lease_id)" json:"-"`
+	LastError   string    `orm:"type(text);null;column(last_error)" json:"last_error,omitempty"`
+	Provider    string    `orm:"size(32);null;column(provider)" json:"provider,omitempty"`
+	Precision   string    `orm:"size(16);null;column(precision)" json:"precision,omitempty"`
+	CreatedAt   time.Time `orm:"auto_now_add;type(timestamp);column(created_at)" json:"created_at"`
+	UpdatedAt   time.Time `orm:"auto_now;type(timestamp);column(updated_at)" json:"updated_at"`
+}
+
+func geocodeMaxAttempts() int {
+	return beego.AppConfig.DefaultInt("geocode_max_attempts", 5)
+}
+
+// GeocodeBackoff — задержка перед следующей попыткой после attempts неудачных:
+// geocode_retry_base, удваивается с каждой попыткой, но не больше geocode_retry_max
+func GeocodeBackoff(attempts int) time.Duration {
+	base := configDuration("geocode_retry_base", 30*time.Second)
+	limit := configDuration("geocode_retry_max", time.Hour)
+	delay := base
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// geocodeWake будит ждущего обработчика, когда в очереди появляется задача
+var geocodeWake = make(chan struct{}, 1)
+
+func wakeGeocodeWorkers() {
+	select {
+	case geocodeWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueGeocodeSQL создаёт задачу компании; reset — перезапускает уже существующую с нуля
+func enqueueGeocodeSQL(reset bool) string {
+	query := `INSERT INTO geocode_job (company_id, status, attempts, next_run_at, created_at, updated_at)
+VALUES (?, 'pending', 0, ?, ?, ?)
+ON CONFLICT (company_id) DO `
+	if !reset {
+		return query + "NOTHING"
+	}
+	return query + `UPDATE SET status = 'pending', attempts = 0, next_run_at = EXCLUDED.next_run_at,
+	locked_until = NULL, lease_id = NULL, last_error = NULL, updated_at = EXCLUDED.updated_at`
+}
+
+func enqueueGeocode(companyID int64, reset bool) error {
+	now := time.Now()
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.Raw(enqueueGeocodeSQL(reset), companyID, now, now, now).Exec(); err != nil {
+		return fmt.Errorf("failed to enqueue geocoding: %v", err)
+	}
+	wakeGeocodeWorkers()
+	return nil
+}
+
+// EnqueueGeocode ставит компанию в очередь геокодирования; существующая задача начинается заново
+// (компанию только что создали, изменили её город или адрес, или администратор перезапустил задачу).
+// Обработчик, который ещё выполняет прежнюю задачу, теряет аренду и не записывает свой итог.
+func EnqueueGeocode(companyID int64) error {
+	return enqueueGeocode(companyID, true)
+}
+
+// RequestGeocode ставит компанию в очередь, только если задачи у неё ещё нет: повторные
+// публичные запросы не сбрасывают счётчик попыток и задержку
+func RequestGeocode(companyID int64) error {
+	return enqueueGeocode(companyID, false)
+}
+
+// GeocodeStatus — состояние геокодирования компании: pending (в очереди или обрабатывается),
+// ok или failed. Пустая строка — задачи нет.
+func GeocodeStatus(companyID int64) (string, error) {
+	var job GeocodeJob
+	o := orm.NewOrmUsingDB("mydatabase")
+	err := o.QueryTable("geocode_job").Filter("company_id", companyID).One(&job, "Status")
+	switch {
+	case errors.Is(err, orm.ErrNoRows):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("failed to load geocode job: %v", err)
+	case job.Status == GeocodeRunning:
+		return GeocodePending, nil
+	}
+	return job.Status, nil
+}
+
+// ListGeocodeJobs возвращает задачи (все или с указанным статусом), сначала недавно изменённые
+func ListGeocodeJobs(status string, limit, offset int) ([]GeocodeJob, error) {
+	qs := orm.NewOrmUsingDB("mydatabase").QueryTable("geocode_job")
+	switch status {
+	case "":
+	case GeocodePending, GeocodeRunning, GeocodeOK, GeocodeFailed:
+		qs = qs.Filter("status", status)
+	default:
+		return nil, ErrInvalidGeocodeStatus
+	}
+
+	jobs := []GeocodeJob{}
+	if _, err := qs.OrderBy("-updated_at", "-id").Limit(limit, offset).All(&jobs); err != nil {
+		return nil, fmt.Errorf("failed to list geocode jobs: %v", err)
+	}
+	return jobs, nil
+}
+
+// RetryGeocode перезапускает геокодирование компании. Несуществующая компания — ErrNotFound.
+func RetryGeocode(companyID int64, actor Actor) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if !o.QueryTable("company").Filter("id", companyID).Exist() {
+		return ErrNotFound
+	}
+	if err := EnqueueGeocode(companyID); err != nil {
+		return err
+	}
+	RecordChange(actor, "company.geocode_retry", "company", companyID, nil, nil)
+	return nil
+}
+
+// RetryFailedGeocodes перезапускает все задачи в статусе failed и возвращает их число
+func RetryFailedGeocodes(actor Actor) (int64, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	n, err := o.QueryTable("geocode_job").Filter("status", GeocodeFailed).Update(orm.Params{
+		"status":      GeocodePending,
+		"attempts":    0,
+		"next_run_at": time.Now(),
+		"last_error":  nil,
+		"updated_at":  time.Now(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to retry geocode jobs: %v", err)
+	}
+	if n > 0 {
+		wakeGeocodeWorkers()
+		RecordChange(actor, "company.geocode_retry_failed", "geocode_job", 0, nil, map[string]int64{"Count": n})
+	}
+	return n, nil
+}
+
+// claimGeocodeSQL захватывает самую раннюю готовую задачу: ожидающую, срок которой подошёл,
+// или зависшую в running после истечения аренды. SKIP LOCKED не даёт двум обработчикам
+// взять одну задачу. lease_id — случайный идентификатор захвата: locked_until хранится с точностью
+// до секунды и у двух захватов подряд может совпасть.
+const claimGeocodeSQL = `UPDATE geocode_job
+SET status = 'running', attempts = attempts + 1, locked_until = ?, lease_id = ?, updated_at = ?
+WHERE id = (
+	SELECT id FROM geocode_job
+	WHERE (status = 'pending' AND next_run_at <= ?) OR (status = 'running' AND locked_until < ?)
+	ORDER BY next_run_at, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, company_id, attempts`
+
+// ProcessGeocodeJob берёт из очереди одну задачу и выполняет её; false — готовых задач нет
+func ProcessGeocodeJob(ctx context.Context) (bool, error) {
+	now := time.Now()
+	lease := configDuration("geocode_job_lease", 2*time.Minute)
+
+	job := GeocodeJob{LockedUntil: now.Add(lease), LeaseId: newTokenID()}
+	o := orm.NewOrmUsingDB("mydatabase")
+	err := o.Raw(claimGeocodeSQL, job.LockedUntil, job.LeaseId, now, now, now).QueryRow(&job.Id, &job.CompanyId, &job.Attempts)
+	if errors.Is(err, orm.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim geocode job: %v", err)
+	}
+
+	// Не дольше аренды, иначе задачу возьмёт другой обработчик
+	ctx, cancel := context.WithTimeout(ctx, lease)
+	defer cancel()
+	result, err := geocodeCompany(ctx, job.CompanyId)
+	return true, finishGeocodeJob(job, result, err)
+}
+
+// finishGeocodeJob сохраняет итог попытки: ok, повтор с задержкой или failed. Итог записывается,
+// только пока задача арендована этим обработчиком (lease_id не изменился с захвата):
+// иначе её уже перезапустили или взял другой обработчик, и его итог важнее.
+func finishGeocodeJob(job GeocodeJob, result geocoder.Result, geocodeErr error) error {
+	logFields := map[string]interface{}{
+		"job_id":     job.Id,
+		"company_id": job.CompanyId,
+		"attempts":   job.Attempts,
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	jobs := o.QueryTable("geocode_job").Filter("id", job.Id).Filter("lease_id", job.LeaseId)
+	if errors.Is(geocodeErr, ErrNotFound) {
+		logger.InfoAny("Company deleted, dropping geocode job", logFields)
+		if _, err := jobs.Delete(); err != nil {
+			return fmt.Errorf("failed to delete geocode job: %v", err)
+		}
+		return nil
+	}
+
+	params := orm.Params{"locked_until": nil, "lease_id": nil, "updated_at": time.Now()}
+	switch {
+	case geocodeErr == nil:
+		params["status"] = GeocodeOK
+		params["last_error"] = nil
+		params["provider"] = result.Provider
+		params["precision"] = string(result.Precision)
+	case errors.Is(geocodeErr, geocoder.ErrNotFound) || job.Attempts >= geocodeMaxAttempts():
+		params["status"] = GeocodeFailed
+		params["last_error"] = geocodeErr.Error()
+		logFields["error"] = geocodeErr.Error()
+		logger.ErrorAny("Company geocoding failed", logFields)
+	default:
+		delay := GeocodeBackoff(job.Attempts)
+		params["status"] = GeocodePending
+		params["last_error"] = geocodeErr.Error()
+		params["next_run_at"] = time.Now().Add(delay)
+		logFields["error"] = geocodeErr.Error()
+		logFields["retry_in"] = delay.String()
+		logger.WarnAny("Company geocoding attempt failed, will retry", logFields)
+	}
+
+	n, err := jobs.Update(params)
+	if err != nil {
+		return fmt.Errorf("failed to update geocode job: %v", err)
+	}
+	if n == 0 {
+		logger.WarnAny("Geocode job lease lost, result discarded", logFields)
+	}
+	return nil
+}
+
+// enqueueMissingGeocodesSQL ставит в очередь компании без координат, у которых нет задачи
+// (созданные до появления очереди)
+const enqueueMissingGeocodesSQL = `INSERT INTO geocode_job (company_id, status, attempts, next_run_at, created_at, updated_at)
+SELECT c.id, 'pending', 0, ?, ?, ?
+FROM company c
+WHERE (c.lat IS NULL OR c.lat = 0 OR c.lon IS NULL OR c.lon = 0)
+	AND NOT EXISTS (SELECT 1 FROM geocode_job j WHERE j.company_id = c.id)
+ON CONFLICT (company_id) DO NOTHING`
+
+// StartGeocodeWorkers ставит в очередь компании без координат и запускает geocode_workers
+// обработчиков. Обработчик без работы ждёт новую задачу или geocode_poll_interval.
+func StartGeocodeWorkers() {
+	now := time.Now()
+	o := orm.NewOrmUsingDB("mydatabase")
+	if res, err := o.Raw(enqueueMissingGeocodesSQL, now, now, now).Exec(); err != nil {
+		logger.ErrorAny("Failed to enqueue companies without coordinates", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if n, _ := res.RowsAffected(); n > 0 {
+		logger.InfoAny("Companies without coordinates enqueued for geocoding", map[string]interface{}{
+			"count": n,
+		})
+	}
+
+	interval := configDuration("geocode_poll_interval", 5*time.Second)
+	for i := 0; i < beego.AppConfig.DefaultInt("geocode_workers", 2); i++ {
+		go geocodeWorker(interval)
+	}
+}
+
+func geocodeWorker(interval time.Duration) {
+	for {
+		processed, err := ProcessGeocodeJob(context.Background())
+		if err != nil {
+			logger.ErrorAny("Geocode worker failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		if processed {
+			continue
+		}
+		select {
+		case <-geocodeWake:
+		case <-time.After(interval):
+		}
+	}
+}
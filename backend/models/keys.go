@@ -0,0 +1,69 @@
+package models
+
+import (
+	"api/pkg/jwtkeys"
+	"fmt"
+	"sync"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+var (
+	keyrings     map[string]*jwtkeys.Keyring
+	keyringsErr  error
+	keyringsOnce sync.Once
+)
+
+// LoadSigningKeys загружает связки ключей для каждой роли из conf/app.conf
+// (jwt_<role>_keys и jwt_<role>_signing_kid, значения можно брать из окружения через ${VAR}).
+// Вызывается при старте, чтобы ошибка конфигурации не всплыла на первом входе.
+func LoadSigningKeys() error {
+	keyringsOnce.Do(func() {
+		keyrings = make(map[string]*jwtkeys.Keyring)
+		for _, role := range []string{RoleVisitor, RoleOwner} {
+			spec := beego.AppConfig.DefaultString("jwt_"+role+"_keys", "")
+			signingKid := beego.AppConfig.DefaultString("jwt_"+role+"_signing_kid", "")
+
+			keyring, err := jwtkeys.Parse(spec, signingKid)
+			if err != nil {
+				keyringsErr = fmt.Errorf("jwt_%s_keys: %v", role, err)
+				return
+			}
+			keyrings[role] = keyring
+		}
+	})
+	return keyringsErr
+}
+
+func keyringFor(role string) (*jwtkeys.Keyring, error) {
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	keyring, ok := keyrings[role]
+	if !ok {
+		return nil, ErrUnknownRole
+	}
+	return keyring, nil
+}
+
+func signClaims(claims *Claims) (string, error) {
+	keyring, err := keyringFor(claims.Role)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Sign(claims)
+}
+
+// JWKS возвращает открытые ключи всех ролей для /.well-known/jwks.json
+func JWKS() (jwtkeys.JWKSet, error) {
+	set := jwtkeys.JWKSet{Keys: []jwtkeys.JWK{}}
+	for _, role := range []string{RoleVisitor, RoleOwner} {
+		keyring, err := keyringFor(role)
+		if err != nil {
+			return set, err
+		}
+		set.Keys = append(set.Keys, keyring.PublicKeys()...)
+	}
+	return set, nil
+}
@@ -0,0 +1,313 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(LoginAttempt))
+}
+
+// LoginAttempt — счётчик неудачных входов по ключу (аккаунт или IP)
+type LoginAttempt struct {
+	Key         string    `orm:"pk;size(191);column(key)"`
+	Failures    int       `orm:"column(failures)"`
+	LastFailure time.Time `orm:"type(timestamp);column(last_failure)"`
+	LockedUntil time.Time `orm:"type(timestamp);null;column(locked_until)"`
+}
+
+// LoginAttemptStore хранит счётчики неудачных входов. Реализация в БД нужна,
+// чтобы блокировка действовала на всех экземплярах приложения.
+type LoginAttemptStore interface {
+	// LockedUntil возвращает момент окончания блокировки ключа (нулевое время — не заблокирован)
+	LockedUntil(key string) (time.Time, error)
+	// Fail атомарно увеличивает счётчик и возвращает число неудач подряд. Счётчик начинается
+	// заново, если с последней неудачи и с конца блокировки прошло больше window: иначе после
+	// блокировки дольше window срок снова начинался бы с login_lockout_base.
+	Fail(key string, window time.Duration) (int, error)
+	// Lock блокирует ключ до until (блокировка только продлевается)
+	Lock(key string, until time.Time) error
+	// Reset сбрасывает счётчик и блокировку
+	Reset(key string) error
+}
+
+// LoginAttempts используется GuardLogin. По умолчанию счётчики хранятся в БД.
+var LoginAttempts LoginAttemptStore = ormLoginAttemptStore{}
+
+type ormLoginAttemptStore struct{}
+
+func (ormLoginAttemptStore) LockedUntil(key string) (time.Time, error) {
+	var attempt LoginAttempt
+	o := orm.NewOrmUsingDB("mydatabase")
+	err := o.QueryTable("login_attempt").Filter("key", key).One(&attempt)
+	if errors.Is(err, orm.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return attempt.LockedUntil, err
+}
+
+func (ormLoginAttemptStore) Fail(key string, window time.Duration) (int, error) {
+	now := time.Now()
+	var failures int
+	o := orm.NewOrmUsingDB("mydatabase")
+	err := o.Raw(`INSERT INTO login_attempt (key, failures, last_failure) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN GREATEST(login_attempt.last_failure, login_attempt.locked_until) < ?
+				THEN 1 ELSE login_attempt.failures + 1 END,
+			last_failure = EXCLUDED.last_failure
+		RETURNING failures`, key, now, now.Add(-window)).QueryRow(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %v", err)
+	}
+	return failures, nil
+}
+
+func (ormLoginAttemptStore) Lock(key string, until time.Time) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.Raw(`UPDATE login_attempt SET locked_until = ?
+		WHERE key = ? AND (locked_until IS NULL OR locked_until < ?)`, until, key, until).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %v", err)
+	}
+	return nil
+}
+
+func (ormLoginAttemptStore) Reset(key string) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.QueryTable("login_attempt").Filter("key", key).Delete(); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %v", err)
+	}
+	return nil
+}
+
+// MemoryLoginAttemptStore — счётчики в памяти процесса, для тестов и одиночного экземпляра
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]*LoginAttempt)}
+}
+
+func (s *MemoryLoginAttemptStore) LockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok {
+		return attempt.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryLoginAttemptStore) Fail(key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	if cutoff := now.Add(-window); attempt.LastFailure.Before(cutoff) && attempt.LockedUntil.Before(cutoff) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailure = now
+	return attempt.Failures, nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok && attempt.LockedUntil.Before(until) {
+		attempt.LockedUntil = until
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// LockoutPolicy — пороги и длительность блокировки входа (login_* в app.conf).
+// После MaxFailures неудач подряд ключ блокируется на Base, каждая следующая неудача
+// удваивает срок, но не больше Max.
+type LockoutPolicy struct {
+	MaxFailures   int
+	IPMaxFailures int
+	Base          time.Duration
+	Max           time.Duration
+	Window        time.Duration
+}
+
+func loginLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:   beego.AppConfig.DefaultInt("login_max_failures", 5),
+		IPMaxFailures: beego.AppConfig.DefaultInt("login_ip_max_failures", 20),
+		Base:          configDuration("login_lockout_base", 30*time.Second),
+		Max:           configDuration("login_lockout_max", time.Hour),
+		Window:        configDuration("login_failure_window", 15*time.Minute),
+	}
+}
+
+// Lockout возвращает срок блокировки после failures неудач при пороге limit (0 — не блокировать)
+func (p LockoutPolicy) Lockout(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+	d := p.Base
+	for i := limit; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	return d
+}
+
+func accountLoginKey(subjectType, identifier string) string {
+	return "account:" + subjectType + ":" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+// isCredentialError сообщает, что вход не удался из-за неверных логина, пароля или кода 2FA
+func isCredentialError(err error) bool {
+	return errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrInvalidOwnerCredentials) ||
+		errors.Is(err, ErrInvalidMFACode)
+}
+
+// GuardLogin выполняет login с защитой от подбора пароля: считает неудачные входы
+// по аккаунту (identifier — имя или email, независимо от того, существует ли аккаунт) и по IP,
+// а после порога блокирует вход с экспоненциально растущим сроком.
+// Пока блокировка действует, login не вызывается и возвращается *CooldownError.
+func GuardLogin[T any](subjectType, identifier, ip string, login func() (T, error)) (T, error) {
+	return guardLogin([]string{accountLoginKey(subjectType, identifier)}, subjectType, identifier, ip, login)
+}
+
+// GuardAccountLogin — GuardLogin для единого входа и присоединения профиля по login
+// (email или имя посетителя). Неудачи считаются по профилям, которые находит login, на тех же
+// счётчиках, что у входа посетителя и владельца: иначе каждый эндпоинт давал бы подбору
+// свой бюджет попыток. Login, который ни к кому не ведёт, считается сам по себе.
+func GuardAccountLogin[T any](login, ip string, fn func() (T, error)) (T, error) {
+	keys, err := accountLoginKeys(login)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return guardLogin(keys, AccountLoginType, login, ip, fn)
+}
+
+// accountLoginKeys возвращает ключи счётчиков профилей, найденных по login
+func accountLoginKeys(login string) ([]string, error) {
+	candidates, err := loginCandidates(orm.NewOrmUsingDB("mydatabase"), login)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, candidate := range candidates {
+		if candidate.user != nil {
+			keys = append(keys, accountLoginKey(RoleVisitor, candidate.user.Username))
+		}
+		if candidate.owner != nil {
+			keys = append(keys, accountLoginKey(RoleOwner, candidate.owner.Email))
+		}
+	}
+	if len(keys) == 0 {
+		keys = append(keys, accountLoginKey(AccountLoginType, login))
+	}
+	return keys, nil
+}
+
+// guardLogin — общая часть GuardLogin и GuardAccountLogin: accountKeys — счётчики аккаунта
+func guardLogin[T any](accountKeys []string, subjectType, identifier, ip string, login func() (T, error)) (T, error) {
+	var zero T
+	policy := loginLockoutPolicy()
+	ipKey := ipLoginKey(ip)
+
+	var lockedUntil time.Time
+	for _, key := range append([]string{ipKey}, accountKeys...) {
+		until, err := LoginAttempts.LockedUntil(key)
+		if err != nil {
+			return zero, err
+		}
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		return zero, &CooldownError{RetryAfter: wait}
+	}
+
+	result, err := login()
+	if err == nil {
+		for _, key := range accountKeys {
+			if err := LoginAttempts.Reset(key); err != nil {
+				logger.WarnAny("Failed to reset login attempts", map[string]interface{}{
+					"key":   key,
+					"error": err.Error(),
+				})
+			}
+		}
+		return result, nil
+	}
+	if !isCredentialError(err) {
+		return zero, err
+	}
+
+	limits := map[string]int{ipKey: policy.IPMaxFailures}
+	for _, key := range accountKeys {
+		limits[key] = policy.MaxFailures
+	}
+
+	var lockout time.Duration
+	for key, limit := range limits {
+		failures, ferr := LoginAttempts.Fail(key, policy.Window)
+		if ferr != nil {
+			return zero, ferr
+		}
+
+		d := policy.Lockout(failures, limit)
+		if d == 0 {
+			continue
+		}
+		until := time.Now().Add(d)
+		if lerr := LoginAttempts.Lock(key, until); lerr != nil {
+			return zero, lerr
+		}
+
+		WriteAudit(AuditLog{
+			Action:     "login.lockout",
+			EntityType: strings.SplitN(key, ":", 2)[0],
+			EntityId:   key,
+			IP:         ip,
+		}, map[string]interface{}{
+			"subject_type": subjectType,
+			"identifier":   identifier,
+			"failures":     failures,
+			"locked_until": until,
+		})
+		if d > lockout {
+			lockout = d
+		}
+	}
+
+	if lockout > 0 {
+		return zero, &CooldownError{RetryAfter: lockout}
+	}
+	return zero, err
+}
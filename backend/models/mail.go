@@ -0,0 +1,44 @@
+package models
+
+import (
+	"api/pkg/mailer"
+	"fmt"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Mailer отправляет письма приложения. Заполняется LoadMailSender при старте;
+// тесты подставляют mailer.FileOutbox.
+var Mailer mailer.Sender
+
+// LoadMailSender создаёт отправителя писем по mail_sender из app.conf:
+// smtp — через smtp_addr / smtp_username / smtp_password, file — в каталог mail_outbox_dir
+func LoadMailSender() error {
+	from := beego.AppConfig.DefaultString("mail_from", "QWERTY.TOWN <no-reply@qwerty.town>")
+
+	switch kind := beego.AppConfig.DefaultString("mail_sender", "file"); kind {
+	case "smtp":
+		addr := beego.AppConfig.DefaultString("smtp_addr", "")
+		if addr == "" {
+			return fmt.Errorf("mail_sender = smtp requires smtp_addr")
+		}
+		Mailer = &mailer.SMTPSender{
+			Addr:     addr,
+			Username: beego.AppConfig.DefaultString("smtp_username", ""),
+			Password: beego.AppConfig.DefaultString("smtp_password", ""),
+			From:     from,
+		}
+	case "file":
+		Mailer = mailer.NewFileOutbox(beego.AppConfig.DefaultString("mail_outbox_dir", "outbox"), from)
+	default:
+		return fmt.Errorf("unknown mail_sender %q", kind)
+	}
+	return nil
+}
+
+func sendMail(msg mailer.Message) error {
+	if Mailer == nil {
+		return fmt.Errorf("mail sender is not configured")
+	}
+	return Mailer.Send(msg)
+}
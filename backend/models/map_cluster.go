@@ -0,0 +1,236 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Кластеризация компаний на карте. Компании группируются по ячейкам сетки Web Mercator:
+// на масштабе z ячейка — тайл масштаба z+clusterCellShift (при тайлах 256 px это квадрат 64 px).
+// Точки, сетки по масштабам и векторные тайлы кешируются; кеш сбрасывается при изменении координат, состава
+// или категорий компаний, а на случай изменений с других экземпляров — по истечении map_cluster_cache_ttl.
+
+const (
+	clusterCellShift  = 2
+	mercatorMaxLat    = 85.05112878
+	MapZoomMax        = 22
+	clusterCategories = 3
+)
+
+var ErrInvalidZoom = errors.New("zoom must be within [0, 22]")
+
+// CategoryCount — сфера деятельности и число компаний в кластере
+type CategoryCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// MapCluster — группа близких компаний: число, центр масс, охватывающий прямоугольник
+// (west, south, east, north) и самые частые сферы деятельности
+type MapCluster struct {
+	Count         int             `json:"count"`
+	Lat           float64         `json:"lat"`
+	Lon           float64         `json:"lon"`
+	BBox          [4]float64      `json:"bbox"`
+	TopCategories []CategoryCount `json:"top_categories"`
+}
+
+// MapClusters — содержимое видимой области: кластеры и отдельные компании
+type MapClusters struct {
+	Zoom     int          `json:"zoom"`
+	Clusters []MapCluster `json:"clusters"`
+	Points   []GeoCompany `json:"points"`
+}
+
+// clusterCell — ячейка сетки; single — первая попавшая в неё компания, показывается, если она в ячейке одна
+type clusterCell struct {
+	cluster MapCluster
+	sumLat  float64
+	sumLon  float64
+	spheres map[string]int
+	single  GeoCompany
+}
+
+// mapClusterCache — точки компаний и построенные по ним кластеры и тайлы (см. map_tile.go)
+var mapClusterCache struct {
+	sync.Mutex
+	points   []GeoCompany
+	byZoom   map[int][]*clusterCell
+	tiles    map[TileCoord][]byte
+	loadedAt time.Time
+}
+
+// MapClusterMaxZoom — масштаб, начиная с которого компании показываются без группировки
+func MapClusterMaxZoom() int {
+	return beego.AppConfig.DefaultInt("map_cluster_max_zoom", 17)
+}
+
+func mapClusterTTL() time.Duration {
+	return configDuration("map_cluster_cache_ttl", 5*time.Minute)
+}
+
+// invalidateMapCache сбрасывает кеш кластеров и тайлов
+func invalidateMapCache() {
+	mapClusterCache.Lock()
+	mapClusterCache.points = nil
+	mapClusterCache.byZoom = nil
+	mapClusterCache.tiles = nil
+	mapClusterCache.Unlock()
+}
+
+// mapPoints возвращает незаблокированные компании с координатами; вызывается под блокировкой кеша
+func mapPoints() ([]GeoCompany, error) {
+	if mapClusterCache.points != nil && time.Since(mapClusterCache.loadedAt) < mapClusterTTL() {
+		return mapClusterCache.points, nil
+	}
+
+	var companies []Company
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("company").SetCond(geoFilter(CompanyListParams{})).Limit(-1).
+		All(&companies, "Id", "Name", "City", "Address", "BusinessSphere", "OrganizationType", "Lat", "Lon")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch companies: %v", err)
+	}
+
+	points := make([]GeoCompany, 0, len(companies))
+	for _, c := range companies {
+		points = append(points, newGeoCompany(c))
+	}
+	mapClusterCache.points = points
+	mapClusterCache.byZoom = make(map[int][]*clusterCell)
+	mapClusterCache.tiles = make(map[TileCoord][]byte)
+	mapClusterCache.loadedAt = time.Now()
+	return points, nil
+}
+
+// mercator — положение точки на масштабе zoom в тайлах: целая часть — номер тайла, дробная — место в нём
+func mercator(p GeoPoint, zoom int) (x, y float64) {
+	n := math.Exp2(float64(zoom))
+	lat := math.Max(-mercatorMaxLat, math.Min(mercatorMaxLat, p.Lat)) * math.Pi / 180
+	x = (p.Lon + 180) / 360 * n
+	y = (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * n
+	return x, y
+}
+
+// mercatorCell — номер тайла с точкой на масштабе zoom
+func mercatorCell(p GeoPoint, zoom int) (x, y int) {
+	fx, fy := mercator(p, zoom)
+	last := 1<<zoom - 1
+	return min(max(int(fx), 0), last), min(max(int(fy), 0), last)
+}
+
+// buildClusters группирует точки по ячейкам масштаба zoom
+func buildClusters(points []GeoCompany, zoom int) []*clusterCell {
+	type key struct{ x, y int }
+	cells := make(map[key]*clusterCell)
+	var order []*clusterCell
+	for _, p := range points {
+		x, y := mercatorCell(GeoPoint{Lat: p.Lat, Lon: p.Lon}, zoom+clusterCellShift)
+		cell, ok := cells[key{x, y}]
+		if !ok {
+			cell = &clusterCell{
+				cluster: MapCluster{BBox: [4]float64{p.Lon, p.Lat, p.Lon, p.Lat}},
+				spheres: make(map[string]int),
+				single:  p,
+			}
+			cells[key{x, y}] = cell
+			order = append(order, cell)
+		}
+		cell.cluster.Count++
+		cell.sumLat += p.Lat
+		cell.sumLon += p.Lon
+		b := &cell.cluster.BBox
+		b[0], b[1], b[2], b[3] = math.Min(b[0], p.Lon), math.Min(b[1], p.Lat), math.Max(b[2], p.Lon), math.Max(b[3], p.Lat)
+		if p.BusinessSphere != "" {
+			cell.spheres[p.BusinessSphere]++
+		}
+	}
+
+	for _, cell := range order {
+		cell.cluster.Lat = cell.sumLat / float64(cell.cluster.Count)
+		cell.cluster.Lon = cell.sumLon / float64(cell.cluster.Count)
+		cell.cluster.TopCategories = topCategories(cell.spheres)
+	}
+	return order
+}
+
+func topCategories(spheres map[string]int) []CategoryCount {
+	top := make([]CategoryCount, 0, len(spheres))
+	for name, count := range spheres {
+		top = append(top, CategoryCount{Name: name, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > clusterCategories {
+		top = top[:clusterCategories]
+	}
+	return top
+}
+
+// intersects проверяет пересечение с прямоугольником west, south, east, north, не пересекающим 180-й меридиан
+func (b BBox) intersects(other [4]float64) bool {
+	if other[1] > b.North || other[3] < b.South {
+		return false
+	}
+	if b.West <= b.East {
+		return other[0] <= b.East && other[2] >= b.West
+	}
+	return other[2] >= b.West || other[0] <= b.East
+}
+
+// ClusterCompanies возвращает кластеры и отдельные компании в видимой области на масштабе zoom.
+// Ячейки с одной компанией и все компании на масштабе от MapClusterMaxZoom отдаются точками.
+func ClusterCompanies(box BBox, zoom int) (*MapClusters, error) {
+	if !box.Valid() {
+		return nil, ErrInvalidBBox
+	}
+	if zoom < 0 || zoom > MapZoomMax {
+		return nil, ErrInvalidZoom
+	}
+
+	mapClusterCache.Lock()
+	defer mapClusterCache.Unlock()
+
+	points, err := mapPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MapClusters{Zoom: zoom, Clusters: []MapCluster{}, Points: []GeoCompany{}}
+	if zoom >= MapClusterMaxZoom() {
+		for _, p := range points {
+			if box.intersects([4]float64{p.Lon, p.Lat, p.Lon, p.Lat}) {
+				result.Points = append(result.Points, p)
+			}
+		}
+		return result, nil
+	}
+
+	cells, ok := mapClusterCache.byZoom[zoom]
+	if !ok {
+		cells = buildClusters(points, zoom)
+		mapClusterCache.byZoom[zoom] = cells
+	}
+	for _, cell := range cells {
+		if !box.intersects(cell.cluster.BBox) {
+			continue
+		}
+		if cell.cluster.Count == 1 {
+			result.Points = append(result.Points, cell.single)
+		} else {
+			result.Clusters = append(result.Clusters, cell.cluster)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"api/pkg/mvt"
+	"errors"
+	"math"
+)
+
+// Векторные тайлы с точками компаний. Строятся из тех же закешированных точек, что и кластеры,
+// поэтому сбрасываются вместе с ними: когда у компании появляются или меняются координаты,
+// когда её блокируют или удаляют.
+
+// CompanyTileLayer — имя слоя с компаниями в тайле
+const CompanyTileLayer = "companies"
+
+const (
+	// tileBuffer — запас вокруг тайла во внутренних координатах: точки у края попадают в оба
+	// соседних тайла, и значки на границе не обрезаются
+	tileBuffer = 64
+	// tileCacheMax — сколько тайлов держать в памяти; при переполнении кеш тайлов очищается
+	tileCacheMax = 4096
+)
+
+var ErrInvalidTile = errors.New("tile coordinates out of range: 0 <= z <= 22, 0 <= x, y < 2^z")
+
+// TileCoord — адрес тайла в схеме XYZ (Web Mercator, y растёт к югу)
+type TileCoord struct {
+	Z, X, Y int
+}
+
+// Valid проверяет масштаб и номера тайла
+func (t TileCoord) Valid() bool {
+	if t.Z < 0 || t.Z > MapZoomMax {
+		return false
+	}
+	n := 1 << t.Z
+	return t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+// tilePixel — положение точки во внутренних координатах тайла
+func (t TileCoord) tilePixel(p GeoPoint) (x, y int) {
+	worldX, worldY := mercator(p, t.Z)
+	return int(math.Round((worldX - float64(t.X)) * mvt.Extent)), int(math.Round((worldY - float64(t.Y)) * mvt.Extent))
+}
+
+// CompanyTile возвращает тайл MVT со слоем companies: точки компаний со свойствами id, name и
+// business_sphere (рейтинга у компаний пока нет). nil — в тайле нет компаний.
+func CompanyTile(t TileCoord) ([]byte, error) {
+	if !t.Valid() {
+		return nil, ErrInvalidTile
+	}
+
+	mapClusterCache.Lock()
+	defer mapClusterCache.Unlock()
+
+	points, err := mapPoints()
+	if err != nil {
+		return nil, err
+	}
+	if tile, ok := mapClusterCache.tiles[t]; ok {
+		return tile, nil
+	}
+
+	layer := mvt.Layer{Name: CompanyTileLayer}
+	for _, p := range points {
+		x, y := t.tilePixel(GeoPoint{Lat: p.Lat, Lon: p.Lon})
+		if x < -tileBuffer || x > mvt.Extent+tileBuffer || y < -tileBuffer || y > mvt.Extent+tileBuffer {
+			continue
+		}
+		layer.Features = append(layer.Features, mvt.Feature{
+			ID: uint64(p.Id),
+			X:  x,
+			Y:  y,
+			Properties: map[string]interface{}{
+				"id":              p.Id,
+				"name":            p.Name,
+				"business_sphere": p.BusinessSphere,
+			},
+		})
+	}
+
+	tile, err := mvt.Encode(layer)
+	if err != nil {
+		return nil, err
+	}
+	if len(mapClusterCache.tiles) >= tileCacheMax {
+		mapClusterCache.tiles = make(map[TileCoord][]byte)
+	}
+	mapClusterCache.tiles[t] = tile
+	return tile, nil
+}
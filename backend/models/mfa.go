@@ -0,0 +1,370 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"api/pkg/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(OwnerMFA), new(MFARecoveryCode))
+}
+
+// RecoveryCodeCount — сколько кодов восстановления выдаётся при включении 2FA
+const RecoveryCodeCount = 10
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotPending     = errors.New("two-factor enrollment not started or already confirmed")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired two-factor login token")
+)
+
+// OwnerMFA — секрет TOTP владельца. Пока Enabled == false, подключение не подтверждено
+// и при входе второй шаг не запрашивается.
+type OwnerMFA struct {
+	OwnerId     int64     `orm:"pk;column(owner_id)"`
+	Secret      string    `orm:"size(64);column(secret)"`
+	Enabled     bool      `orm:"default(false);column(enabled)"`
+	LastCounter int64     `orm:"default(0);column(last_counter)"`
+	ConfirmedAt time.Time `orm:"type(timestamp);null;column(confirmed_at)"`
+	CreatedAt   time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+}
+
+func (m *OwnerMFA) TableName() string {
+	return "owner_mfa"
+}
+
+// MFARecoveryCode — одноразовый код восстановления, хранится только sha256
+type MFARecoveryCode struct {
+	Id       int64  `orm:"auto;column(id)"`
+	OwnerId  int64  `orm:"index;column(owner_id)"`
+	CodeHash string `orm:"unique;size(64);column(code_hash)"`
+	Used     bool   `orm:"default(false);column(used)"`
+}
+
+func (c *MFARecoveryCode) TableName() string {
+	return "mfa_recovery_code"
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// MFAEnrollment — данные для подключения приложения-аутентификатора
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"otpauth_uri"`
+}
+
+// MFAChallenge — ответ первого шага входа, если у владельца включена 2FA:
+// вместо токенов выдаётся короткоживущий mfa_token для POST /login/mfa
+type MFAChallenge struct {
+	MFARequired  bool   `json:"mfa_required"`
+	MFAToken     string `json:"mfa_token"`
+	MFAExpiresIn int64  `json:"mfa_expires_in"`
+}
+
+// OwnerLogin — результат входа владельца: пара токенов либо запрос второго шага
+type OwnerLogin struct {
+	*TokenPair
+	*MFAChallenge
+}
+
+// MFAPendingTTL — время на ввод кода после пароля (mfa_pending_ttl в app.conf)
+func MFAPendingTTL() time.Duration {
+	return configDuration("mfa_pending_ttl", 5*time.Minute)
+}
+
+func mfaAudience() string {
+	return Audience(RoleOwner) + "/mfa"
+}
+
+// ownerMFAEnabled сообщает, подтверждена ли у владельца 2FA
+func ownerMFAEnabled(o orm.Ormer, ownerID int64) (bool, error) {
+	mfa := OwnerMFA{OwnerId: ownerID}
+	err := o.Read(&mfa)
+	if errors.Is(err, orm.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read two-factor settings: %v", err)
+	}
+	return mfa.Enabled, nil
+}
+
+// newMFAChallenge выдаёт токен второго шага входа
+func newMFAChallenge(ownerID int64) (*MFAChallenge, error) {
+	token, err := signPurposeClaims(newPurposeClaims(RoleOwner, mfaAudience(), ownerID, MFAPendingTTL()))
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{
+		MFARequired:  true,
+		MFAToken:     token,
+		MFAExpiresIn: int64(MFAPendingTTL().Seconds()),
+	}, nil
+}
+
+// EnrollOwnerMFA создаёт новый секрет TOTP. Неподтверждённое подключение перезаписывается,
+// включённую 2FA нужно сначала отключить.
+func EnrollOwnerMFA(ownerID int64) (*MFAEnrollment, error) {
+	owner, err := GetOwner(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	enabled, err := ownerMFAEnabled(o, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := o.InsertOrUpdate(&OwnerMFA{OwnerId: ownerID, Secret: secret}, "owner_id"); err != nil {
+		return nil, fmt.Errorf("failed to store two-factor secret: %v", err)
+	}
+
+	issuer := beego.AppConfig.DefaultString("mfa_issuer", "QWERTY.TOWN")
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(issuer, owner.Email, secret),
+	}, nil
+}
+
+// ConfirmOwnerMFA включает 2FA после проверки первого кода из приложения
+// и возвращает коды восстановления. Они показываются один раз.
+func ConfirmOwnerMFA(ownerID int64, code string) ([]string, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	mfa := OwnerMFA{OwnerId: ownerID}
+	if err := o.Read(&mfa); err != nil || mfa.Enabled {
+		return nil, ErrMFANotPending
+	}
+
+	counter, ok := totp.Validate(code, mfa.Secret, time.Now(), 1, mfa.LastCounter)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	mfa.Enabled = true
+	mfa.LastCounter = counter
+	mfa.ConfirmedAt = time.Now()
+	if _, err := o.Update(&mfa, "enabled", "last_counter", "confirmed_at"); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+
+	codes, err := replaceRecoveryCodes(o, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "mfa.enable",
+		ActorType:  RoleOwner,
+		ActorId:    ownerID,
+		EntityType: RoleOwner,
+		EntityId:   strconv.FormatInt(ownerID, 10),
+	}, nil)
+	return codes, nil
+}
+
+// DisableOwnerMFA отключает 2FA; владелец подтверждает действие кодом TOTP или кодом восстановления
+func DisableOwnerMFA(ownerID int64, code string) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	mfa := OwnerMFA{OwnerId: ownerID}
+	if err := o.Read(&mfa); err != nil || !mfa.Enabled {
+		return ErrMFANotEnabled
+	}
+	if err := verifyMFACode(o, &mfa, code); err != nil {
+		return err
+	}
+
+	if err := deleteOwnerMFA(o, ownerID); err != nil {
+		return err
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "mfa.disable",
+		ActorType:  RoleOwner,
+		ActorId:    ownerID,
+		EntityType: RoleOwner,
+		EntityId:   strconv.FormatInt(ownerID, 10),
+	}, nil)
+	return nil
+}
+
+// ResetOwnerMFA сбрасывает 2FA владельца по запросу администратора (например, при потере телефона)
+func ResetOwnerMFA(ownerID int64, actor *Principal) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := GetOwner(ownerID); err != nil {
+		return ErrNotFound
+	}
+	if err := deleteOwnerMFA(o, ownerID); err != nil {
+		return err
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "mfa.reset",
+		ActorType:  actor.Role,
+		ActorId:    actor.ID,
+		EntityType: RoleOwner,
+		EntityId:   strconv.FormatInt(ownerID, 10),
+	}, nil)
+	return nil
+}
+
+func deleteOwnerMFA(o orm.Ormer, ownerID int64) error {
+	if _, err := o.QueryTable("mfa_recovery_code").Filter("owner_id", ownerID).Delete(); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+	if _, err := o.QueryTable("owner_mfa").Filter("owner_id", ownerID).Delete(); err != nil {
+		return fmt.Errorf("failed to delete two-factor settings: %v", err)
+	}
+	return nil
+}
+
+// CompleteOwnerMFALogin — второй шаг входа: проверяет mfa_token и код, выдаёт пару токенов.
+// mfa_token одноразовый: после успешного входа его jti попадает в чёрный список.
+func CompleteOwnerMFALogin(mfaToken, code string, client SessionClient) (*TokenPair, error) {
+	claims, ownerID, err := verifyPurposeClaims(mfaToken, RoleOwner, mfaAudience())
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if revoked, err := AccessTokenRevocations.IsRevoked(claims.ID); err != nil || revoked {
+		return nil, ErrInvalidMFAToken
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	mfa := OwnerMFA{OwnerId: ownerID}
+	if err := o.Read(&mfa); err != nil || !mfa.Enabled {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := verifyMFACode(o, &mfa, code); err != nil {
+		return nil, err
+	}
+
+	if err := AccessTokenRevocations.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	owner, err := GetOwner(ownerID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if owner.Blocked {
+		return nil, ErrAccountBlocked
+	}
+	return issueOwnerTokens(*owner, "", client)
+}
+
+// MFAPendingSubject возвращает id владельца из mfa_token без проверки кода.
+// Нужен, чтобы считать неудачные попытки второго шага по аккаунту.
+func MFAPendingSubject(mfaToken string) (int64, error) {
+	_, ownerID, err := verifyPurposeClaims(mfaToken, RoleOwner, mfaAudience())
+	if err != nil {
+		return 0, ErrInvalidMFAToken
+	}
+	return ownerID, nil
+}
+
+// verifyMFACode принимает код TOTP (6 цифр) или код восстановления.
+// Использованный интервал TOTP запоминается, код восстановления гасится.
+func verifyMFACode(o orm.Ormer, mfa *OwnerMFA, code string) error {
+	code = strings.TrimSpace(code)
+
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(code, mfa.Secret, time.Now(), 1, mfa.LastCounter)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		// Условное обновление: один код нельзя использовать дважды даже одновременно
+		n, err := o.QueryTable("owner_mfa").
+			Filter("owner_id", mfa.OwnerId).
+			Filter("last_counter__lt", counter).
+			Update(orm.Params{"last_counter": counter})
+		if err != nil {
+			return fmt.Errorf("failed to store two-factor counter: %v", err)
+		}
+		if n == 0 {
+			return ErrInvalidMFACode
+		}
+		mfa.LastCounter = counter
+		return nil
+	}
+
+	n, err := o.QueryTable("mfa_recovery_code").
+		Filter("owner_id", mfa.OwnerId).
+		Filter("code_hash", recoveryCodeHash(mfa.OwnerId, code)).
+		Filter("used", false).
+		Update(orm.Params{"used": true})
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %v", err)
+	}
+	if n == 0 {
+		return ErrInvalidMFACode
+	}
+
+	logger.InfoAny("Recovery code used", map[string]interface{}{
+		"owner_id": mfa.OwnerId,
+	})
+	return nil
+}
+
+// replaceRecoveryCodes удаляет прежние коды восстановления и выдаёт новые
+func replaceRecoveryCodes(o orm.Ormer, ownerID int64) ([]string, error) {
+	if _, err := o.QueryTable("mfa_recovery_code").Filter("owner_id", ownerID).Delete(); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	records := make([]MFARecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code := newRecoveryCode()
+		codes = append(codes, code)
+		records = append(records, MFARecoveryCode{OwnerId: ownerID, CodeHash: recoveryCodeHash(ownerID, code)})
+	}
+
+	if _, err := o.InsertMulti(len(records), records); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %v", err)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode возвращает код вида xxxxx-xxxxx (50 бит, base32 в нижнем регистре)
+func newRecoveryCode() string {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	s := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:]
+}
+
+// recoveryCodeHash нормализует код (регистр, дефисы, пробелы) и хеширует его вместе с id владельца
+func recoveryCodeHash(ownerID int64, code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(strconv.FormatInt(ownerID, 10) + ":" + normalized)
+}
@@ -0,0 +1,369 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"api/pkg/oidc"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(UserIdentity), new(OIDCLoginState))
+}
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrInvalidOIDCState    = errors.New("invalid or expired login state")
+	ErrOIDCAccountConflict = errors.New("an account with this email already exists; sign in with your password and verify the email to link the provider")
+)
+
+// UserIdentity связывает посетителя с учётной записью у внешнего провайдера (provider + sub)
+type UserIdentity struct {
+	Id        int64     `orm:"auto;column(id)"`
+	UserId    int64     `orm:"index;column(user_id)"`
+	Provider  string    `orm:"size(32);column(provider)"`
+	Subject   string    `orm:"size(191);column(subject)"`
+	Email     string    `orm:"null;column(email)"`
+	CreatedAt time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+}
+
+func (i *UserIdentity) TableUnique() [][]string {
+	return [][]string{{"Provider", "Subject"}}
+}
+
+// OIDCLoginState — незавершённый вход через провайдера: state из ссылки,
+// nonce для id_token и code_verifier PKCE. Запись одноразовая.
+type OIDCLoginState struct {
+	State        string    `orm:"pk;size(64);column(state)"`
+	Provider     string    `orm:"size(32);column(provider)"`
+	Nonce        string    `orm:"size(64);column(nonce)"`
+	CodeVerifier string    `orm:"size(64);column(code_verifier)"`
+	ExpiresAt    time.Time `orm:"type(timestamp);column(expires_at)"`
+}
+
+func (s *OIDCLoginState) TableName() string {
+	return "oidc_login_state"
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// OIDCStateStore хранит незавершённые входы между редиректом к провайдеру и callback
+type OIDCStateStore interface {
+	Save(state OIDCLoginState) error
+	// Consume возвращает и удаляет запись; повторный вызов с тем же state возвращает ErrInvalidOIDCState
+	Consume(state string) (*OIDCLoginState, error)
+}
+
+// OIDCStates используется StartOIDCLogin и FinishOIDCLogin. По умолчанию записи хранятся в БД,
+// чтобы callback мог прийти на любой экземпляр приложения.
+var OIDCStates OIDCStateStore = ormOIDCStateStore{}
+
+type ormOIDCStateStore struct{}
+
+func (ormOIDCStateStore) Save(state OIDCLoginState) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.Insert(&state); err != nil {
+		return fmt.Errorf("failed to store login state: %v", err)
+	}
+
+	// Попутно чистим брошенные входы
+	if _, err := o.QueryTable("oidc_login_state").Filter("expires_at__lt", time.Now()).Delete(); err != nil {
+		logger.WarnAny("Failed to purge expired login states", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return nil
+}
+
+func (ormOIDCStateStore) Consume(state string) (*OIDCLoginState, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	var s OIDCLoginState
+	err := o.Raw(`DELETE FROM oidc_login_state WHERE state = ? AND expires_at > ?
+		RETURNING state, provider, nonce, code_verifier, expires_at`, state, time.Now()).QueryRow(&s)
+	if errors.Is(err, orm.ErrNoRows) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume login state: %v", err)
+	}
+	return &s, nil
+}
+
+// MemoryOIDCStateStore — незавершённые входы в памяти процесса, для тестов и одиночного экземпляра
+type MemoryOIDCStateStore struct {
+	mu     sync.Mutex
+	states map[string]OIDCLoginState
+}
+
+func NewMemoryOIDCStateStore() *MemoryOIDCStateStore {
+	return &MemoryOIDCStateStore{states: make(map[string]OIDCLoginState)}
+}
+
+func (m *MemoryOIDCStateStore) Save(state OIDCLoginState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state.State] = state
+	return nil
+}
+
+func (m *MemoryOIDCStateStore) Consume(state string) (*OIDCLoginState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.states[state]
+	delete(m.states, state)
+	if !ok || s.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidOIDCState
+	}
+	return &s, nil
+}
+
+var (
+	oidcProviders     map[string]*oidc.Client
+	oidcProvidersMu   sync.Mutex
+	oidcProvidersOnce sync.Once
+)
+
+// loadOIDCProviders читает провайдеров из app.conf: oidc_providers — имена через запятую,
+// для каждого имени oidc_<name>_issuer, _client_id, _client_secret, _redirect_url и _scopes
+func loadOIDCProviders() {
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+
+	if oidcProviders == nil {
+		oidcProviders = make(map[string]*oidc.Client)
+	}
+	for _, name := range strings.Split(beego.AppConfig.DefaultString("oidc_providers", ""), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "oidc_" + name + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       beego.AppConfig.DefaultString(prefix+"issuer", ""),
+			ClientID:     beego.AppConfig.DefaultString(prefix+"client_id", ""),
+			ClientSecret: beego.AppConfig.DefaultString(prefix+"client_secret", ""),
+			RedirectURL:  beego.AppConfig.DefaultString(prefix+"redirect_url", ""),
+			Scopes:       strings.Fields(beego.AppConfig.DefaultString(prefix+"scopes", "openid email profile")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			logger.WarnAny("OIDC provider is not fully configured, skipping", map[string]interface{}{
+				"provider": name,
+			})
+			continue
+		}
+		oidcProviders[name] = oidc.NewClient(cfg)
+	}
+}
+
+// RegisterOIDCProvider добавляет провайдера в обход app.conf (тесты, локальный IdP)
+func RegisterOIDCProvider(client *oidc.Client) {
+	oidcProvidersOnce.Do(loadOIDCProviders)
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+	oidcProviders[client.Config.Name] = client
+}
+
+func oidcProvider(name string) (*oidc.Client, error) {
+	oidcProvidersOnce.Do(loadOIDCProviders)
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+
+	client, ok := oidcProviders[name]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	return client, nil
+}
+
+// OIDCProviderNames возвращает имена настроенных провайдеров
+func OIDCProviderNames() []string {
+	oidcProvidersOnce.Do(loadOIDCProviders)
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+
+	names := make([]string, 0, len(oidcProviders))
+	for name := range oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OIDCStateTTL — сколько ждать возвращения пользователя от провайдера (oidc_state_ttl в app.conf)
+func OIDCStateTTL() time.Duration {
+	return configDuration("oidc_state_ttl", 10*time.Minute)
+}
+
+// StartOIDCLogin создаёт state, nonce и PKCE и возвращает адрес страницы входа провайдера
+// и state, который нужно сохранить в браузере пользователя для FinishOIDCLogin
+func StartOIDCLogin(ctx context.Context, provider string) (string, string, error) {
+	client, err := oidcProvider(provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, challenge := oidc.NewPKCE()
+	state := OIDCLoginState{
+		State:        oidc.RandomString(24),
+		Provider:     provider,
+		Nonce:        oidc.RandomString(24),
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL()),
+	}
+
+	authURL, err := client.AuthCodeURL(ctx, state.State, state.Nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+	if err := OIDCStates.Save(state); err != nil {
+		return "", "", err
+	}
+	return authURL, state.State, nil
+}
+
+// FinishOIDCLogin проверяет state, обменивает code на id_token и входит посетителем,
+// связанным с учётной записью провайдера. browserState — state, сохранённый в браузере
+// при StartOIDCLogin: без него чужие code и state, подсунутые жертве, входили бы
+// в аккаунт атакующего (login CSRF).
+func FinishOIDCLogin(ctx context.Context, provider, code, stateValue, browserState string, device SessionClient) (*TokenPair, error) {
+	client, err := oidcProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(browserState), []byte(stateValue)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	state, err := OIDCStates.Consume(stateValue)
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != provider {
+		return nil, ErrInvalidOIDCState
+	}
+
+	idToken, err := client.Exchange(ctx, code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logger.WarnAny("OIDC code exchange failed", map[string]interface{}{
+			"provider": provider,
+			"error":    err.Error(),
+		})
+		return nil, err
+	}
+
+	user, err := userForIdentity(provider, idToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.Blocked {
+		return nil, ErrAccountBlocked
+	}
+	return issueUserTokens(*user, "", device)
+}
+
+// userForIdentity находит посетителя по связке provider + sub. Если связки нет,
+// учётная запись привязывается к посетителю с тем же подтверждённым email,
+// а если такого нет — создаётся новый посетитель.
+func userForIdentity(provider string, idToken *oidc.IDToken) (*User, error) {
+	logFields := map[string]interface{}{
+		"provider": provider,
+		"subject":  idToken.Subject,
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	var identity UserIdentity
+	err := o.QueryTable("user_identity").
+		Filter("provider", provider).
+		Filter("subject", idToken.Subject).
+		One(&identity)
+	if err == nil {
+		return GetUser(identity.UserId)
+	}
+	if !errors.Is(err, orm.ErrNoRows) {
+		return nil, fmt.Errorf("failed to look up identity: %v", err)
+	}
+
+	var user User
+	if idToken.Email != "" {
+		err = o.QueryTable("user").Filter("email", idToken.Email).One(&user)
+		if err != nil && !errors.Is(err, orm.ErrNoRows) {
+			return nil, fmt.Errorf("failed to look up user: %v", err)
+		}
+	}
+
+	if user.Id != 0 {
+		// Привязка по адресу допустима, только если адрес подтвердили обе стороны:
+		// иначе чужой аккаунт, зарегистрированный на этот адрес, получил бы вход через провайдера
+		if !idToken.EmailVerified || !user.EmailVerified {
+			logger.WarnAny("OIDC login matches an account with unverified email", logFields)
+			return nil, ErrOIDCAccountConflict
+		}
+		logFields["user_id"] = user.Id
+		logger.InfoAny("Linking OIDC identity to existing user", logFields)
+	} else {
+		created, err := createOIDCUser(o, provider, idToken)
+		if err != nil {
+			return nil, err
+		}
+		user = *created
+		logFields["user_id"] = user.Id
+		logger.InfoAny("User created from OIDC identity", logFields)
+	}
+
+	identity = UserIdentity{UserId: user.Id, Provider: provider, Subject: idToken.Subject, Email: idToken.Email}
+	if _, err := o.Insert(&identity); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %v", err)
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "identity.link",
+		ActorType:  RoleVisitor,
+		ActorId:    user.Id,
+		EntityType: RoleVisitor,
+		EntityId:   strconv.FormatInt(user.Id, 10),
+	}, map[string]interface{}{
+		"provider": provider,
+		"subject":  idToken.Subject,
+	})
+	return &user, nil
+}
+
+// createOIDCUser создаёт посетителя без пароля: войти он может только через провайдера
+// или задав пароль через forgot-password
+func createOIDCUser(o orm.Ormer, provider string, idToken *oidc.IDToken) (*User, error) {
+	unusable, err := HashPassword(randomToken(32))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	user := User{
+		Username:      provider + "_" + hashToken(provider + ":" + idToken.Subject)[:12],
+		Email:         idToken.Email,
+		Password:      unusable,
+		EmailVerified: idToken.EmailVerified && idToken.Email != "",
+	}
+	if user.Id, err = o.Insert(&user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	attachNewAccount(RoleVisitor, user.Id, user.Email)
+	if user.Email != "" && !user.EmailVerified {
+		notifyEmailVerification(RoleVisitor, user.Id, user.Email)
+	}
+	return &user, nil
+}
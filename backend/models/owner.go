@@ -5,15 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/beego/beego/v2/client/orm"
-	"github.com/golang-jwt/jwt/v5"
 	"strings"
-	"time"
 )
 
 func init() {
 	orm.RegisterModel(new(Owner))
 }
 
+var ErrInvalidOwnerCredentials = errors.New("invalid email or password")
+
 type PostOwnerRequest struct {
 	FullName     string `json:"fullname"`
 	ContactEmail string `json:"email"`
@@ -31,6 +31,10 @@ type Owner struct {
 	Email    string `orm:"column(contact_email)"`
 	Password string `orm:"column(password)"`
 	Phone    string `orm:"column(contact_phone)"`
+	Blocked  bool   `orm:"default(false);column(blocked)"`
+
+	EmailVerified bool  `orm:"default(false);column(email_verified)"`
+	AccountId     int64 `orm:"default(0);index;column(account_id)"`
 }
 
 type OwnerLoginRequest struct {
@@ -38,34 +42,19 @@ type OwnerLoginRequest struct {
 	Password string `json:"password"`
 }
 
-var SecretOwnerKey = []byte("your-secret-key")
-
-func CreateOwnerToken(owner Owner) (string, error) {
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    owner.Id,
-		"email": owner.Email,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
-	})
-	return claims.SignedString(SecretOwnerKey)
+func CreateOwnerToken(owner Owner, sessionID string) (string, error) {
+	claims := newClaims(RoleOwner, owner.Id, sessionID)
+	claims.Email = owner.Email
+	claims.EmailVerified = owner.EmailVerified
+	claims.attachAccount(owner.AccountId)
+	return signClaims(claims)
 }
 
-func VerifyOwnerToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return SecretOwnerKey, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	return token.Claims.(jwt.MapClaims), nil
+func VerifyOwnerToken(tokenString string) (*Claims, error) {
+	return verifyClaims(tokenString, RoleOwner)
 }
 
-func AddOwner(o Owner) (int64, error) {
+func AddOwner(o Owner, actor Actor) (int64, error) {
 	logFields := map[string]interface{}{
 		"fullname": o.Fullname,
 		"email":    o.Email,
@@ -73,6 +62,14 @@ func AddOwner(o Owner) (int64, error) {
 
 	logger.InfoAny("Attempting to create Owner", logFields)
 
+	hash, err := HashPassword(o.Password)
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to hash owner password", logFields)
+		return 0, fmt.Errorf("failed to create owner: %v", err)
+	}
+	o.Password = hash
+
 	ormer := orm.NewOrmUsingDB("mydatabase")
 	id, err := ormer.Insert(&o)
 	if err != nil {
@@ -94,6 +91,12 @@ func AddOwner(o Owner) (int64, error) {
 	logFields["owner_id"] = id
 	logger.InfoAny("Owner created successfully", logFields)
 
+	o.Id = id
+	RecordChange(actor, "owner.create", RoleOwner, id, nil, o)
+
+	attachNewAccount(RoleOwner, id, o.Email)
+	notifyEmailVerification(RoleOwner, id, o.Email)
+
 	return id, nil
 }
 
@@ -107,38 +110,151 @@ func GetOwner(uid int64) (u *Owner, err error) {
 	return &owner, nil
 }
 
-func GetAllOwners() *[]Owner {
+// GetAllOwners возвращает десять последних владельцев без хешей паролей
+func GetAllOwners() []AccountSummary {
 	var owners []Owner
 	o := orm.NewOrmUsingDB("mydatabase")
-	qb, _ := orm.NewQueryBuilder("postgres")
-	qb.Select("id", "full_name", "password").From("owner").Where("id > ?").OrderBy("id").Desc().Limit(10)
-	o.Raw(qb.String(), 0).QueryRows(&owners)
-	return &owners
+	o.QueryTable("owner").OrderBy("-id").Limit(10).All(&owners, "Id", "Fullname", "Email", "Blocked")
+
+	result := make([]AccountSummary, 0, len(owners))
+	for _, ow := range owners {
+		result = append(result, ow.Summary())
+	}
+	return result
 }
 
-func UpdateOwner(oo *Owner) error {
+// UpdateOwner меняет контакты владельца; пароль меняется, только если передан
+func UpdateOwner(oo *Owner, actor Actor) (err error) {
+	columns := []string{"full_name", "contact_email", "contact_phone"}
+	passwordChanged := oo.Password != ""
+	if passwordChanged {
+		if oo.Password, err = hashNewPassword(oo.Password); err != nil {
+			return err
+		}
+		columns = append(columns, "password")
+	}
+
 	o := orm.NewOrmUsingDB("mydatabase")
-	_, err := o.Update(oo, "full_name", "contact_email", "contact_phone", "password")
-	return err
+	current := Owner{Id: oo.Id}
+	if err := o.Read(&current); err != nil {
+		return fmt.Errorf("owner not found")
+	}
+
+	// Новый адрес нужно подтвердить заново
+	emailChanged := current.Email != oo.Email
+	oo.EmailVerified = current.EmailVerified && !emailChanged
+	if emailChanged {
+		columns = append(columns, "email_verified")
+	}
+
+	if _, err = o.Update(oo, columns...); err != nil {
+		return err
+	}
+
+	after := current
+	after.Fullname, after.Email, after.Phone = oo.Fullname, oo.Email, oo.Phone
+	if passwordChanged {
+		after.Password = oo.Password
+	}
+	after.EmailVerified = oo.EmailVerified
+	RecordChange(actor, "owner.update", RoleOwner, oo.Id, current, after)
+	if emailChanged {
+		notifyEmailVerification(RoleOwner, oo.Id, oo.Email)
+	}
+	if passwordChanged {
+		return endSessionsAfterPasswordChange(RoleOwner, oo.Id, actor)
+	}
+	return nil
 }
 
-func DeleteOwner(uid int64) error {
-	o := orm.NewOrmUsingDB("mydatabase")
-	if _, err := o.Delete(&Owner{Id: uid}); err != nil {
+// DeleteOwner сразу удаляет владельца вместе с его компаниями и остальными данными
+// по политике удаления (privacy.go). Несуществующий владелец — ErrNotFound.
+func DeleteOwner(uid int64, actor Actor) error {
+	if err := eraseProfileNow(RoleOwner, uid, actor); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return err
+		}
 		return fmt.Errorf("failed to delete owner: %v", err)
 	}
 	return nil
 }
 
-func LoginOwner(req OwnerLoginRequest) (string, error) {
+// LoginOwner проверяет email и пароль. Если у владельца включена 2FA,
+// вместо токенов возвращается MFAChallenge для второго шага (CompleteOwnerMFALogin).
+func LoginOwner(req OwnerLoginRequest, client SessionClient) (*OwnerLogin, error) {
 	o := orm.NewOrmUsingDB("mydatabase")
 	var owner Owner
 	err := o.QueryTable("owner").Filter("contact_email", req.Email).One(&owner)
 	if err != nil {
-		return "", errors.New("invalid email or password")
+		return nil, ErrInvalidOwnerCredentials
+	}
+	ok, upgrade := CheckPassword(req.Password, owner.Password)
+	if !ok {
+		return nil, ErrInvalidOwnerCredentials
+	}
+	if owner.Blocked {
+		return nil, ErrAccountBlocked
+	}
+	if upgrade {
+		upgradeOwnerPassword(o, &owner, req.Password)
+	}
+
+	mfaEnabled, err := ownerMFAEnabled(o, owner.Id)
+	if err != nil {
+		return nil, err
+	}
+	if mfaEnabled {
+		challenge, err := newMFAChallenge(owner.Id)
+		if err != nil {
+			return nil, err
+		}
+		return &OwnerLogin{MFAChallenge: challenge}, nil
+	}
+
+	tokens, err := issueOwnerTokens(owner, "", client)
+	if err != nil {
+		return nil, err
+	}
+	return &OwnerLogin{TokenPair: tokens}, nil
+}
+
+// RefreshOwnerToken обменивает refresh-токен владельца на новую пару токенов
+func RefreshOwnerToken(raw string, client SessionClient) (*TokenPair, error) {
+	rt, err := rotateRefreshToken(raw, RoleOwner)
+	if err != nil {
+		return nil, err
 	}
-	if req.Password != owner.Password {
-		return "", errors.New("invalid email or password")
+
+	owner, err := GetOwner(rt.SubjectId)
+	if err != nil || owner.Blocked {
+		return nil, ErrInvalidRefreshToken
 	}
-	return CreateOwnerToken(owner)
+	return issueOwnerTokens(*owner, rt.FamilyId, client)
+}
+
+func issueOwnerTokens(owner Owner, familyID string, client SessionClient) (*TokenPair, error) {
+	return issueTokenPair(RoleOwner, owner.Id, familyID, client, nil, func(sessionID string) (string, error) {
+		return CreateOwnerToken(owner, sessionID)
+	})
+}
+
+// upgradeOwnerPassword перезаписывает устаревший или открытый пароль новым хешем.
+// Ошибка только логируется: вход при этом не должен срываться.
+func upgradeOwnerPassword(o orm.Ormer, owner *Owner, plain string) {
+	logFields := map[string]interface{}{
+		"owner_id": owner.Id,
+	}
+
+	hash, err := HashPassword(plain)
+	if err == nil {
+		owner.Password = hash
+		_, err = o.Update(owner, "password")
+	}
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to upgrade owner password hash", logFields)
+		return
+	}
+
+	logger.InfoAny("Owner password hash upgraded", logFields)
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"api/pkg/password"
+	"sync"
+
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+var (
+	passwordParams     password.Params
+	passwordParamsOnce sync.Once
+)
+
+// PasswordParams возвращает параметры хеширования из conf/app.conf
+func PasswordParams() password.Params {
+	passwordParamsOnce.Do(func() {
+		p := password.DefaultParams()
+		p.Algorithm = beego.AppConfig.DefaultString("password_algorithm", p.Algorithm)
+		p.Memory = uint32(beego.AppConfig.DefaultInt("argon2_memory", int(p.Memory)))
+		p.Iterations = uint32(beego.AppConfig.DefaultInt("argon2_iterations", int(p.Iterations)))
+		p.Parallelism = uint8(beego.AppConfig.DefaultInt("argon2_parallelism", int(p.Parallelism)))
+		p.BcryptCost = beego.AppConfig.DefaultInt("bcrypt_cost", p.BcryptCost)
+		passwordParams = p
+	})
+	return passwordParams
+}
+
+// HashPassword хеширует пароль с текущими параметрами установки
+func HashPassword(plain string) (string, error) {
+	return password.Hash(plain, PasswordParams())
+}
+
+// CheckPassword сверяет пароль с сохранённым значением.
+// upgrade = true означает, что значение нужно перезаписать новым хешем:
+// пароль хранился в открытом виде или параметры хеширования устарели.
+func CheckPassword(plain, stored string) (ok bool, upgrade bool) {
+	if !password.IsHashed(stored) {
+		ok = password.VerifyLegacy(plain, stored)
+		return ok, ok
+	}
+
+	ok, err := password.Verify(plain, stored)
+	if err != nil {
+		logger.WarnAny("Failed to verify password hash", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return false, false
+	}
+	return ok, ok && password.NeedsRehash(stored, PasswordParams())
+}
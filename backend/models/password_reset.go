@@ -0,0 +1,266 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"api/pkg/mailer"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(PasswordReset))
+}
+
+// MinPasswordLength — минимальная длина нового пароля при сбросе и смене
+const MinPasswordLength = 8
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	ErrWeakPassword      = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PasswordReset — выданный токен сброса пароля. Хранится только sha256 от токена,
+// чтобы утечка таблицы не позволяла сбросить чужой пароль.
+type PasswordReset struct {
+	Id          int64     `orm:"auto;column(id)"`
+	TokenHash   string    `orm:"unique;size(64);column(token_hash)"`
+	SubjectType string    `orm:"size(16);column(subject_type)"`
+	SubjectId   int64     `orm:"column(subject_id)"`
+	Used        bool      `orm:"default(false);column(used)"`
+	ExpiresAt   time.Time `orm:"type(timestamp);column(expires_at)"`
+	CreatedAt   time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+}
+
+// PasswordResetTTL — срок действия ссылки сброса (password_reset_ttl в app.conf)
+func PasswordResetTTL() time.Duration {
+	return configDuration("password_reset_ttl", time.Hour)
+}
+
+// PasswordResetCooldown — минимальный интервал между письмами сброса одному аккаунту
+// (password_reset_cooldown в app.conf)
+func PasswordResetCooldown() time.Duration {
+	return configDuration("password_reset_cooldown", time.Minute)
+}
+
+// passwordColumn возвращает колонку хеша пароля аккаунта данной роли
+func passwordColumn(subjectType string) string {
+	if subjectType == RoleOwner {
+		return "password"
+	}
+	return "password_hash"
+}
+
+// RequestPasswordReset отправляет письмо со ссылкой сброса пароля на адрес email.
+// Если аккаунта нет, он заблокирован или письмо уже отправлялось недавно, ничего не происходит,
+// а вызывающий получает тот же результат: ответ не должен выдавать, зарегистрирован ли адрес.
+// Поэтому синхронно выполняется только поиск аккаунта, одинаковый для обоих случаев, а токен
+// и письмо готовятся в фоне — иначе адрес выдавало бы время ответа.
+func RequestPasswordReset(subjectType, email string) error {
+	table, emailColumn, err := accountTable(subjectType)
+	if err != nil {
+		return err
+	}
+
+	logFields := map[string]interface{}{
+		"subject_type": subjectType,
+	}
+
+	var account struct {
+		Id      int64
+		Blocked bool
+	}
+	o := orm.NewOrmUsingDB("mydatabase")
+	err = o.Raw(fmt.Sprintf(`SELECT id, blocked FROM "%s" WHERE %s = ?`, table, emailColumn), email).QueryRow(&account)
+	if errors.Is(err, orm.ErrNoRows) {
+		logger.InfoAny("Password reset requested for unknown email", logFields)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up account: %v", err)
+	}
+
+	logFields["subject_id"] = account.Id
+	if account.Blocked {
+		logger.WarnAny("Password reset requested for blocked account", logFields)
+		return nil
+	}
+
+	go func() {
+		if err := issuePasswordReset(subjectType, account.Id, email); err != nil {
+			logger.ErrorAny("Failed to issue password reset", map[string]interface{}{
+				"subject_type": subjectType,
+				"subject_id":   account.Id,
+				"error":        err.Error(),
+			})
+		}
+	}()
+	return nil
+}
+
+// issuePasswordReset выдаёт новый токен сброса аккаунту, отзывая прежние, и отправляет письмо;
+// повторный запрос в пределах password_reset_cooldown игнорируется
+func issuePasswordReset(subjectType string, subjectID int64, email string) error {
+	logFields := map[string]interface{}{
+		"subject_type": subjectType,
+		"subject_id":   subjectID,
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	qs := o.QueryTable("password_reset").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID)
+
+	var last PasswordReset
+	err := qs.OrderBy("-created_at").One(&last)
+	if err != nil && !errors.Is(err, orm.ErrNoRows) {
+		return fmt.Errorf("failed to check password reset cooldown: %v", err)
+	}
+	if err == nil && time.Since(last.CreatedAt) < PasswordResetCooldown() {
+		logger.InfoAny("Password reset requested again within cooldown", logFields)
+		return nil
+	}
+
+	// Действует только последняя ссылка
+	if _, err := qs.Filter("used", false).Update(orm.Params{"used": true}); err != nil {
+		return fmt.Errorf("failed to revoke previous reset tokens: %v", err)
+	}
+
+	raw := randomToken(32)
+	reset := PasswordReset{
+		TokenHash:   hashToken(raw),
+		SubjectType: subjectType,
+		SubjectId:   subjectID,
+		ExpiresAt:   time.Now().Add(PasswordResetTTL()),
+	}
+	if _, err := o.Insert(&reset); err != nil {
+		return fmt.Errorf("failed to store reset token: %v", err)
+	}
+
+	if err := sendMail(passwordResetMessage(subjectType, email, raw)); err != nil {
+		return fmt.Errorf("failed to send password reset email: %v", err)
+	}
+
+	logger.InfoAny("Password reset email sent", logFields)
+	return nil
+}
+
+func passwordResetMessage(subjectType, email, token string) mailer.Message {
+	link := beego.AppConfig.DefaultString("password_reset_url", "http://localhost:5173/reset-password") +
+		"?" + url.Values{"role": {subjectType}, "token": {token}}.Encode()
+
+	return mailer.Message{
+		To:      email,
+		Subject: "Сброс пароля",
+		Body: "Здравствуйте!\n\n" +
+			"Для аккаунта " + email + " в QWERTY.TOWN запрошен сброс пароля. Задать новый пароль можно по ссылке:\n" +
+			link + "\n\n" +
+			"Ссылка действует " + PasswordResetTTL().String() + " и сработает один раз.\n" +
+			"После сброса все активные сеансы будут завершены.\n" +
+			"Если вы не запрашивали сброс, просто проигнорируйте это письмо: пароль останется прежним.\n",
+	}
+}
+
+// hashNewPassword проверяет длину нового пароля и хеширует его
+func hashNewPassword(password string) (string, error) {
+	if len([]rune(password)) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return hash, nil
+}
+
+// endSessionsAfterPasswordChange завершает сессии аккаунта после смены пароля. Если пароль
+// сменил сам аккаунт, его текущая сессия остаётся.
+func endSessionsAfterPasswordChange(subjectType string, subjectID int64, actor Actor) error {
+	if actor.Type != subjectType || actor.ID != subjectID || actor.SessionID == "" {
+		return RevokeAllSessions(subjectType, subjectID)
+	}
+	if _, err := Sessions.RevokeAll(subjectType, subjectID, actor.SessionID); err != nil {
+		return err
+	}
+	return revokeOtherTokenFamilies(subjectType, subjectID, actor.SessionID)
+}
+
+// ResetPassword гасит токен сброса, задаёт новый пароль и завершает все сессии аккаунта
+func ResetPassword(subjectType, token, password string) error {
+	table, _, err := accountTable(subjectType)
+	if err != nil {
+		return err
+	}
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	var reset PasswordReset
+	err = o.QueryTable("password_reset").
+		Filter("token_hash", hashToken(token)).
+		Filter("subject_type", subjectType).
+		One(&reset)
+	if err != nil {
+		if errors.Is(err, orm.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if reset.ExpiresAt.Before(time.Now()) {
+		return ErrInvalidResetToken
+	}
+
+	// Условное обновление: из двух одновременных запросов с одним токеном пройдёт один
+	n, err := o.QueryTable("password_reset").
+		Filter("id", reset.Id).
+		Filter("used", false).
+		Update(orm.Params{"used": true})
+	if err != nil {
+		return fmt.Errorf("failed to consume reset token: %v", err)
+	}
+	if n == 0 {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+	n, err = o.QueryTable(table).
+		Filter("id", reset.SubjectId).
+		Update(orm.Params{passwordColumn(subjectType): hash})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+	if n == 0 {
+		return ErrInvalidResetToken
+	}
+
+	logFields := map[string]interface{}{
+		"subject_type": subjectType,
+		"subject_id":   reset.SubjectId,
+	}
+	if err := RevokeAllSessions(subjectType, reset.SubjectId); err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to end sessions after password reset", logFields)
+		return err
+	}
+
+	logger.InfoAny("Password reset", logFields)
+	return nil
+}
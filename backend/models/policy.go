@@ -0,0 +1,22 @@
+package models
+
+import "errors"
+
+var ErrForbidden = errors.New("access denied")
+
+// AuthorizeCompanyMutation разрешает изменять и удалять компанию только её владельцу
+func AuthorizeCompanyMutation(p *Principal, c *Company) error {
+	if p == nil || p.Role != RoleOwner {
+		return ErrForbidden
+	}
+	if c.Owner == nil || c.Owner.Id != p.ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanViewCompany скрывает заблокированную компанию от всех, кроме модераторов и администраторов
+// (companies:manage): в списках, на карте и в выгрузке её тоже нет
+func CanViewCompany(p *Principal, c *Company) bool {
+	return !c.Blocked || (p != nil && p.Can(PermCompaniesManage))
+}
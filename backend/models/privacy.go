@@ -0,0 +1,532 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(ErasureRequest))
+}
+
+// Политика удаления персональных данных.
+//
+// Аккаунт удаляется по запросу владельца не сразу: в течение account_erasure_grace
+// вход продолжает работать, и запрос можно отменить. По истечении срока ProcessErasures:
+//   - отзывает все сессии и токены профилей (записи subject_revocation остаются —
+//     в них нет персональных данных, а без них выданные access-токены снова стали бы действительными);
+//   - удаляет профили посетителя и владельца и всё, что принадлежит только им:
+//     компании владельца, API-ключи, 2FA, привязки OIDC, роли, сессии, refresh-токены,
+//     токены подтверждения почты и сброса пароля (erasureTargets и subjectErasureTables);
+//   - обезличивает журнал аудита: записи остаются для расследований, но IP, подробности
+//     и значения изменённых полей стираются,
+//     идентификаторы удалённых профилей ни с кем больше не связаны;
+//   - удаляет сам аккаунт.
+//
+// Счётчики неудачных входов (login_attempt) не чистятся: они истекают сами через login_failure_window.
+// Проход повторяем: если он прервался, следующий запуск удалит оставшееся.
+var (
+	ErrErasurePending   = errors.New("account erasure is already scheduled")
+	ErrNoErasurePending = errors.New("no pending account erasure")
+)
+
+// ErasureRequest — запрос на удаление аккаунта (или одиночного профиля без аккаунта)
+type ErasureRequest struct {
+	Id          int64     `orm:"auto;column(id)"`
+	AccountId   int64     `orm:"default(0);index;column(account_id)"`
+	UserId      int64     `orm:"default(0);column(user_id)"`
+	OwnerId     int64     `orm:"default(0);column(owner_id)"`
+	IP          string    `orm:"size(64);null;column(ip)"`
+	RequestedAt time.Time `orm:"auto_now_add;type(timestamp);column(requested_at)"`
+	EraseAfter  time.Time `orm:"type(timestamp);index;column(erase_after)"`
+	CancelledAt time.Time `orm:"type(timestamp);null;column(cancelled_at)"`
+	CompletedAt time.Time `orm:"type(timestamp);null;column(completed_at)"`
+}
+
+// ErasureInfo — запланированное удаление в ответах API
+type ErasureInfo struct {
+	RequestedAt time.Time `json:"requested_at"`
+	EraseAfter  time.Time `json:"erase_after"`
+}
+
+// erasureTarget — таблица с данными только одного профиля и колонка с id профиля
+type erasureTarget struct {
+	table  string
+	column string
+}
+
+var erasureTargets = map[string][]erasureTarget{
+	RoleVisitor: {
+		{"user_identity", "user_id"},
+	},
+	RoleOwner: {
+		{"company", "owner_id"},
+		{"api_key", "owner_id"},
+		{"mfa_recovery_code", "owner_id"},
+		{"owner_mfa", "owner_id"},
+	},
+}
+
+// subjectErasureTables — общие для посетителей и владельцев таблицы с subject_type и subject_id
+var subjectErasureTables = []string{
+	"account_session",
+	"refresh_token",
+	"account_role",
+	"email_verification",
+	"password_reset",
+}
+
+// ErasureGrace — срок между запросом на удаление и окончательным удалением
+func ErasureGrace() time.Duration {
+	return configDuration("account_erasure_grace", 30*24*time.Hour)
+}
+
+// AccountExport — архив персональных данных аккаунта
+type AccountExport struct {
+	ExportedAt time.Time      `json:"exported_at"`
+	Account    *Account       `json:"account,omitempty"`
+	Visitor    *VisitorExport `json:"visitor,omitempty"`
+	Owner      *OwnerExport   `json:"owner,omitempty"`
+	Sessions   []SessionInfo  `json:"sessions"`
+	AuditLog   []AuditLog     `json:"audit_log"`
+	Erasure    *ErasureInfo   `json:"erasure,omitempty"`
+}
+
+type VisitorExport struct {
+	Id            int64            `json:"id"`
+	Username      string           `json:"username"`
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	Blocked       bool             `json:"blocked"`
+	Roles         []string         `json:"roles"`
+	Identities    []IdentityExport `json:"identities"`
+}
+
+type IdentityExport struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OwnerExport struct {
+	Id            int64        `json:"id"`
+	Fullname      string       `json:"fullname"`
+	Email         string       `json:"email"`
+	Phone         string       `json:"phone"`
+	EmailVerified bool         `json:"email_verified"`
+	Blocked       bool         `json:"blocked"`
+	MFAEnabled    bool         `json:"mfa_enabled"`
+	Roles         []string     `json:"roles"`
+	Companies     []Company    `json:"companies"`
+	APIKeys       []APIKeyInfo `json:"api_keys"`
+}
+
+// principalProfiles загружает профили аккаунта субъекта, включая заблокированные.
+// Субъект без аккаунта — одиночный профиль.
+func principalProfiles(o orm.Ormer, p *Principal) (*accountProfiles, error) {
+	if p.AccountID != 0 {
+		return loadAccountProfiles(o, p.AccountID)
+	}
+
+	profiles := &accountProfiles{}
+	switch p.Role {
+	case RoleVisitor:
+		user := User{Id: p.ID}
+		if err := o.Read(&user); err != nil {
+			return nil, fmt.Errorf("failed to load visitor profile: %v", err)
+		}
+		profiles.user = &user
+	case RoleOwner:
+		owner := Owner{Id: p.ID}
+		if err := o.Read(&owner); err != nil {
+			return nil, fmt.Errorf("failed to load owner profile: %v", err)
+		}
+		profiles.owner = &owner
+	}
+	return profiles, nil
+}
+
+// ExportAccount собирает все данные аккаунта субъекта: профили, компании, привязки входа,
+// ключи, сессии и записи аудита о действиях с профилями. Хеши паролей и секреты не выгружаются.
+func ExportAccount(p *Principal) (*AccountExport, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	profiles, err := principalProfiles(o, p)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &AccountExport{ExportedAt: time.Now(), Sessions: []SessionInfo{}, AuditLog: []AuditLog{}}
+	if profiles.accountID != 0 {
+		account := Account{Id: profiles.accountID}
+		if err := o.Read(&account); err != nil {
+			return nil, fmt.Errorf("failed to load account: %v", err)
+		}
+		export.Account = &account
+	}
+
+	var subjects []sessionSubject
+	if u := profiles.user; u != nil {
+		subjects = append(subjects, sessionSubject{RoleVisitor, u.Id})
+		export.Visitor = &VisitorExport{
+			Id:            u.Id,
+			Username:      u.Username,
+			Email:         u.Email,
+			EmailVerified: u.EmailVerified,
+			Blocked:       u.Blocked,
+			Roles:         SubjectRoles(RoleVisitor, u.Id),
+			Identities:    []IdentityExport{},
+		}
+
+		var identities []UserIdentity
+		if _, err := o.QueryTable("user_identity").Filter("user_id", u.Id).All(&identities); err != nil {
+			return nil, fmt.Errorf("failed to export identities: %v", err)
+		}
+		for _, id := range identities {
+			export.Visitor.Identities = append(export.Visitor.Identities, IdentityExport{
+				Provider:  id.Provider,
+				Subject:   id.Subject,
+				Email:     id.Email,
+				CreatedAt: id.CreatedAt,
+			})
+		}
+	}
+
+	if ow := profiles.owner; ow != nil {
+		subjects = append(subjects, sessionSubject{RoleOwner, ow.Id})
+		mfaEnabled, err := ownerMFAEnabled(o, ow.Id)
+		if err != nil {
+			return nil, err
+		}
+		companies, err := GetOwnerCompanies(ow.Id)
+		if err != nil {
+			return nil, err
+		}
+		for i := range companies {
+			companies[i].Owner = nil
+		}
+		keys, err := ListAPIKeys(ow.Id)
+		if err != nil {
+			return nil, err
+		}
+		if companies == nil {
+			companies = []Company{}
+		}
+		export.Owner = &OwnerExport{
+			Id:            ow.Id,
+			Fullname:      ow.Fullname,
+			Email:         ow.Email,
+			Phone:         ow.Phone,
+			EmailVerified: ow.EmailVerified,
+			Blocked:       ow.Blocked,
+			MFAEnabled:    mfaEnabled,
+			Roles:         SubjectRoles(RoleOwner, ow.Id),
+			Companies:     companies,
+			APIKeys:       keys,
+		}
+	}
+
+	for _, subject := range subjects {
+		sessions, err := Sessions.List(subject.role, subject.id, time.Now().Add(-RefreshTokenTTL()))
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sessions {
+			export.Sessions = append(export.Sessions, SessionInfo{
+				Id:         s.Id,
+				UserAgent:  s.UserAgent,
+				IP:         s.IP,
+				CreatedAt:  s.CreatedAt,
+				LastSeenAt: s.LastSeenAt,
+				Current:    s.Id == p.SessionID,
+			})
+		}
+
+		var entries []AuditLog
+		_, err = o.QueryTable("audit_log").SetCond(auditSubjectCond(subject.role, subject.id)).OrderBy("id").All(&entries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export audit log: %v", err)
+		}
+		export.AuditLog = append(export.AuditLog, entries...)
+	}
+
+	pending, err := pendingErasure(o, profiles)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		export.Erasure = &ErasureInfo{RequestedAt: pending.RequestedAt, EraseAfter: pending.EraseAfter}
+	}
+	return export, nil
+}
+
+// auditSubjectCond — записи аудита, где профиль выступает субъектом действия или его объектом
+func auditSubjectCond(role string, id int64) *orm.Condition {
+	actor := orm.NewCondition().And("actor_type", role).And("actor_id", id)
+	entity := orm.NewCondition().And("entity_type", role).And("entity_id", strconv.FormatInt(id, 10))
+	return orm.NewCondition().AndCond(actor).OrCond(entity)
+}
+
+func pendingErasure(o orm.Ormer, profiles *accountProfiles) (*ErasureRequest, error) {
+	qs := o.QueryTable("erasure_request").Filter("completed_at__isnull", true).Filter("cancelled_at__isnull", true)
+	switch {
+	case profiles.accountID != 0:
+		qs = qs.Filter("account_id", profiles.accountID)
+	case profiles.user != nil:
+		qs = qs.Filter("user_id", profiles.user.Id)
+	case profiles.owner != nil:
+		qs = qs.Filter("owner_id", profiles.owner.Id)
+	default:
+		return nil, nil
+	}
+
+	var req ErasureRequest
+	err := qs.One(&req)
+	if errors.Is(err, orm.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load erasure request: %v", err)
+	}
+	return &req, nil
+}
+
+// RequestErasure планирует удаление аккаунта субъекта со всеми профилями через ErasureGrace.
+// До этого срока аккаунт работает как прежде, и удаление можно отменить через CancelErasure.
+func RequestErasure(p *Principal, ip string) (*ErasureInfo, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	profiles, err := principalProfiles(o, p)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingErasure(o, profiles)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, ErrErasurePending
+	}
+
+	now := time.Now()
+	req := ErasureRequest{
+		AccountId:   profiles.accountID,
+		IP:          ip,
+		RequestedAt: now,
+		EraseAfter:  now.Add(ErasureGrace()),
+	}
+	if profiles.user != nil {
+		req.UserId = profiles.user.Id
+	}
+	if profiles.owner != nil {
+		req.OwnerId = profiles.owner.Id
+	}
+	id, err := o.Insert(&req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule erasure: %v", err)
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "account.erasure_request",
+		ActorType:  p.Role,
+		ActorId:    p.ID,
+		EntityType: "erasure_request",
+		EntityId:   strconv.FormatInt(id, 10),
+		IP:         ip,
+	}, map[string]interface{}{
+		"erase_after": req.EraseAfter,
+	})
+	return &ErasureInfo{RequestedAt: req.RequestedAt, EraseAfter: req.EraseAfter}, nil
+}
+
+// CancelErasure отменяет запланированное удаление аккаунта субъекта
+func CancelErasure(p *Principal, ip string) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	profiles, err := principalProfiles(o, p)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingErasure(o, profiles)
+	if err != nil {
+		return err
+	}
+	if pending == nil {
+		return ErrNoErasurePending
+	}
+
+	_, err = o.QueryTable("erasure_request").Filter("id", pending.Id).Update(orm.Params{"cancelled_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to cancel erasure: %v", err)
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "account.erasure_cancel",
+		ActorType:  p.Role,
+		ActorId:    p.ID,
+		EntityType: "erasure_request",
+		EntityId:   strconv.FormatInt(pending.Id, 10),
+		IP:         ip,
+	}, nil)
+	return nil
+}
+
+// ProcessErasures окончательно удаляет аккаунты, срок ожидания которых истёк к моменту now,
+// и возвращает число обработанных запросов
+func ProcessErasures(now time.Time) (int, error) {
+	var due []ErasureRequest
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("erasure_request").
+		Filter("completed_at__isnull", true).
+		Filter("cancelled_at__isnull", true).
+		Filter("erase_after__lte", now).
+		OrderBy("id").
+		All(&due)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load due erasures: %v", err)
+	}
+
+	for _, req := range due {
+		userID, ownerID := req.UserId, req.OwnerId
+		if req.AccountId != 0 {
+			// Профиль мог быть присоединён к аккаунту после запроса
+			profiles, err := loadAccountProfiles(o, req.AccountId)
+			if err != nil {
+				return 0, err
+			}
+			if profiles.user != nil {
+				userID = profiles.user.Id
+			}
+			if profiles.owner != nil {
+				ownerID = profiles.owner.Id
+			}
+		}
+
+		if userID != 0 {
+			if err := eraseProfile(o, RoleVisitor, userID); err != nil {
+				return 0, err
+			}
+		}
+		if ownerID != 0 {
+			if err := eraseProfile(o, RoleOwner, ownerID); err != nil {
+				return 0, err
+			}
+		}
+		if req.AccountId != 0 {
+			if _, err := o.QueryTable("account").Filter("id", req.AccountId).Delete(); err != nil {
+				return 0, fmt.Errorf("failed to delete account %d: %v", req.AccountId, err)
+			}
+		}
+		_, err := o.QueryTable("erasure_request").Filter("id", req.Id).Update(orm.Params{"completed_at": time.Now(), "ip": ""})
+		if err != nil {
+			return 0, fmt.Errorf("failed to complete erasure %d: %v", req.Id, err)
+		}
+
+		WriteAudit(AuditLog{
+			Action:     "account.erase",
+			ActorType:  ActorSystem,
+			EntityType: "erasure_request",
+			EntityId:   strconv.FormatInt(req.Id, 10),
+		}, map[string]interface{}{
+			"user_id":  userID,
+			"owner_id": ownerID,
+		})
+	}
+	return len(due), nil
+}
+
+// eraseProfile удаляет профиль и связанные с ним данные по политике из начала файла
+func eraseProfile(o orm.Ormer, role string, id int64) error {
+	if err := RevokeAllSessions(role, id); err != nil {
+		return err
+	}
+
+	for _, target := range erasureTargets[role] {
+		if _, err := o.QueryTable(target.table).Filter(target.column, id).Delete(); err != nil {
+			return fmt.Errorf("failed to erase %s of %s %d: %v", target.table, role, id, err)
+		}
+	}
+	if role == RoleOwner {
+		// Вместе с владельцем удалены его компании
+		invalidateMapCache()
+	}
+	for _, table := range subjectErasureTables {
+		if _, err := o.QueryTable(table).Filter("subject_type", role).Filter("subject_id", id).Delete(); err != nil {
+			return fmt.Errorf("failed to erase %s of %s %d: %v", table, role, id, err)
+		}
+	}
+
+	_, err := o.QueryTable("audit_log").SetCond(auditSubjectCond(role, id)).Update(orm.Params{"ip": "", "details": "", "changes": ""})
+	if err != nil {
+		return fmt.Errorf("failed to anonymize audit log of %s %d: %v", role, id, err)
+	}
+	if _, err := o.QueryTable(profileTable(role)).Filter("id", id).Delete(); err != nil {
+		return fmt.Errorf("failed to delete %s %d: %v", role, id, err)
+	}
+
+	logger.InfoAny("Profile erased", map[string]interface{}{
+		"subject_type": role,
+		"subject_id":   id,
+	})
+	return nil
+}
+
+// StartErasureWorker выполняет ProcessErasures в фоне раз в account_erasure_check_interval
+func StartErasureWorker() {
+	interval := configDuration("account_erasure_check_interval", time.Hour)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := ProcessErasures(time.Now())
+			if err != nil {
+				logger.ErrorAny("Account erasure failed", map[string]interface{}{
+					"error": err.Error(),
+				})
+				continue
+			}
+			if n > 0 {
+				logger.InfoAny("Accounts erased", map[string]interface{}{
+					"count": n,
+				})
+			}
+		}
+	}()
+}
+
+// eraseProfileNow удаляет профиль сразу, без срока ожидания (административное удаление),
+// и его аккаунт, если в нём не осталось профилей. Несуществующий профиль — ErrNotFound.
+func eraseProfileNow(role string, id int64, actor Actor) error {
+	var (
+		accountID int64
+		before    interface{}
+	)
+	o := orm.NewOrmUsingDB("mydatabase")
+	switch role {
+	case RoleVisitor:
+		user := User{Id: id}
+		if err := o.Read(&user); err != nil {
+			return ErrNotFound
+		}
+		accountID, before = user.AccountId, user
+	case RoleOwner:
+		owner := Owner{Id: id}
+		if err := o.Read(&owner); err != nil {
+			return ErrNotFound
+		}
+		accountID, before = owner.AccountId, owner
+	}
+
+	if err := eraseProfile(o, role, id); err != nil {
+		return err
+	}
+	if accountID != 0 {
+		removeEmptyAccount(o, accountID)
+	}
+
+	RecordChange(actor, role+".delete", role, id, before, nil)
+	return nil
+}
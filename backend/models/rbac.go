@@ -0,0 +1,234 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(Role), new(Permission), new(AccountRole))
+}
+
+// Дополнительные роли; visitor и owner выдаются по типу аккаунта
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Разрешения, которые проверяются контроллерами
+const (
+	PermUsersRead       = "users:read"
+	PermOwnersRead      = "owners:read"
+	PermCompaniesWrite  = "companies:write"
+	PermUsersManage     = "users:manage"
+	PermOwnersManage    = "owners:manage"
+	PermCompaniesManage = "companies:manage"
+	PermAuditRead       = "audit:read"
+)
+
+// defaultRolePermissions — набор ролей, которым заполняется БД при первом запуске.
+// Дальше источником правды служат таблицы role / permission / role_permission.
+var defaultRolePermissions = map[string][]string{
+	RoleVisitor: {},
+	RoleOwner:   {PermCompaniesWrite},
+	RoleModerator: {
+		PermUsersRead, PermOwnersRead,
+		PermUsersManage, PermCompaniesManage,
+	},
+	RoleAdmin: {
+		PermUsersRead, PermOwnersRead,
+		PermUsersManage, PermOwnersManage, PermCompaniesManage,
+		PermAuditRead,
+	},
+}
+
+type Role struct {
+	Id          int64         `orm:"auto;column(id)"`
+	Name        string        `orm:"unique;size(32);column(name)"`
+	Permissions []*Permission `orm:"rel(m2m);rel_table(role_permission)"`
+}
+
+type Permission struct {
+	Id    int64   `orm:"auto;column(id)"`
+	Code  string  `orm:"unique;size(64);column(code)"`
+	Roles []*Role `orm:"reverse(many)"`
+}
+
+// AccountRole назначает дополнительную роль пользователю или владельцу
+type AccountRole struct {
+	Id          int64  `orm:"auto;column(id)"`
+	SubjectType string `orm:"size(16);column(subject_type)"`
+	SubjectId   int64  `orm:"column(subject_id)"`
+	Role        *Role  `orm:"rel(fk);column(role_id)"`
+}
+
+func (a *AccountRole) TableUnique() [][]string {
+	return [][]string{{"SubjectType", "SubjectId", "Role"}}
+}
+
+// SeedRoles создаёт недостающие роли и разрешения из defaultRolePermissions.
+// Уже существующие связи не удаляются, чтобы не затирать ручные изменения.
+func SeedRoles() error {
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	for roleName, codes := range defaultRolePermissions {
+		role := Role{Name: roleName}
+		if _, _, err := o.ReadOrCreate(&role, "Name"); err != nil {
+			return fmt.Errorf("failed to seed role %s: %v", roleName, err)
+		}
+
+		m2m := o.QueryM2M(&role, "Permissions")
+		for _, code := range codes {
+			permission := Permission{Code: code}
+			if _, _, err := o.ReadOrCreate(&permission, "Code"); err != nil {
+				return fmt.Errorf("failed to seed permission %s: %v", code, err)
+			}
+			if !m2m.Exist(&permission) {
+				if _, err := m2m.Add(&permission); err != nil {
+					return fmt.Errorf("failed to grant %s to %s: %v", code, roleName, err)
+				}
+			}
+		}
+	}
+
+	invalidateRolePermissions()
+	return nil
+}
+
+// AssignRole назначает аккаунту дополнительную роль (moderator, admin)
+func AssignRole(subjectType string, subjectID int64, roleName string) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	role := Role{Name: roleName}
+	if err := o.Read(&role, "Name"); err != nil {
+		return fmt.Errorf("role %s not found", roleName)
+	}
+
+	assignment := AccountRole{SubjectType: subjectType, SubjectId: subjectID, Role: &role}
+	if _, _, err := o.ReadOrCreate(&assignment, "SubjectType", "SubjectId", "Role"); err != nil {
+		return fmt.Errorf("failed to assign role: %v", err)
+	}
+	return nil
+}
+
+// GrantAdminToUser назначает роль admin посетителю с указанным именем (admin_username в app.conf)
+func GrantAdminToUser(username string) error {
+	var user User
+	o := orm.NewOrmUsingDB("mydatabase")
+	if err := o.QueryTable("user").Filter("username", username).One(&user); err != nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+	return AssignRole(RoleVisitor, user.Id, RoleAdmin)
+}
+
+// SubjectRoles возвращает роли аккаунта: роль типа аккаунта и назначенные дополнительно
+func SubjectRoles(subjectType string, subjectID int64) []string {
+	roles := []string{subjectType}
+
+	var names orm.ParamsList
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.Raw(`SELECT r.name FROM account_role ar JOIN role r ON r.id = ar.role_id
+		WHERE ar.subject_type = ? AND ar.subject_id = ?`, subjectType, subjectID).ValuesFlat(&names)
+	if err != nil {
+		logger.WarnAny("Failed to load account roles", map[string]interface{}{
+			"subject_type": subjectType,
+			"subject_id":   subjectID,
+			"error":        err.Error(),
+		})
+		return roles
+	}
+
+	for _, name := range names {
+		if name, ok := name.(string); ok {
+			roles = append(roles, name)
+		}
+	}
+	return roles
+}
+
+var rolePermissionsCache struct {
+	sync.Mutex
+	byRole   map[string]map[string]bool
+	loadedAt time.Time
+}
+
+const rolePermissionsTTL = time.Minute
+
+type rolePermissionRow struct {
+	Name string
+	Code string
+}
+
+func invalidateRolePermissions() {
+	rolePermissionsCache.Lock()
+	rolePermissionsCache.byRole = nil
+	rolePermissionsCache.Unlock()
+}
+
+// rolePermissions возвращает разрешения ролей из БД с кешированием на минуту.
+// Если БД недоступна, используются встроенные значения по умолчанию.
+func rolePermissions() map[string]map[string]bool {
+	rolePermissionsCache.Lock()
+	defer rolePermissionsCache.Unlock()
+
+	if rolePermissionsCache.byRole != nil && time.Since(rolePermissionsCache.loadedAt) < rolePermissionsTTL {
+		return rolePermissionsCache.byRole
+	}
+
+	var rows []rolePermissionRow
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.Raw(`SELECT r.name, p.code FROM role r
+		JOIN role_permission rp ON rp.role_id = r.id
+		JOIN permission p ON p.id = rp.permission_id`).QueryRows(&rows)
+
+	byRole := make(map[string]map[string]bool)
+	if err != nil || len(rows) == 0 {
+		if err != nil {
+			logger.WarnAny("Failed to load role permissions, using defaults", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		for role, codes := range defaultRolePermissions {
+			byRole[role] = make(map[string]bool)
+			for _, code := range codes {
+				byRole[role][code] = true
+			}
+		}
+	} else {
+		for _, row := range rows {
+			if byRole[row.Name] == nil {
+				byRole[row.Name] = make(map[string]bool)
+			}
+			byRole[row.Name][row.Code] = true
+		}
+	}
+
+	rolePermissionsCache.byRole = byRole
+	rolePermissionsCache.loadedAt = time.Now()
+	return byRole
+}
+
+// Can сообщает, даёт ли хотя бы одна из ролей субъекта разрешение permission
+func (p *Principal) Can(permission string) bool {
+	byRole := rolePermissions()
+	for _, role := range p.Roles {
+		if byRole[role][permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole сообщает, есть ли у субъекта роль
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
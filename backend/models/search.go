@@ -0,0 +1,154 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// Полнотекстовый поиск по компаниям. Колонка company.search_vector (tsvector, русская конфигурация)
+// хранит взвешенные лексемы: название (A) важнее сферы деятельности (B), описания (C) и адреса (D).
+// Колонки нет в модели Company — её создаёт EnsureCompanySearch, а AddCompany и UpdateCompany
+// пересчитывают её для изменённой компании.
+
+// Размер страницы результатов поиска
+const (
+	SearchPageDefault = 20
+	SearchPageMax     = 100
+	searchQueryMaxLen = 200
+)
+
+var ErrEmptySearchQuery = errors.New("search query is empty")
+
+const companySearchVector = `setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+	setweight(to_tsvector('russian', coalesce(business_sphere, '')), 'B') ||
+	setweight(to_tsvector('russian', coalesce(description, '')), 'C') ||
+	setweight(to_tsvector('russian', coalesce(city, '') || ' ' || coalesce(address, '')), 'D')`
+
+// Границы совпадений в ts_headline — символы из области частного использования: их не бывает
+// в пользовательском тексте, поэтому после экранирования HTML их можно безопасно заменить на <mark>
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var (
+	// Название показывается целиком, из описания — до двух фрагментов вокруг совпадений
+	nameHeadlineOptions    = fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", highlightStart, highlightStop)
+	snippetHeadlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \"",
+		highlightStart, highlightStop)
+)
+
+// CompanySearchHit — найденная компания. Highlight-поля — HTML, где совпадения обёрнуты в <mark>,
+// а остальной текст экранирован.
+type CompanySearchHit struct {
+	Id             int64   `json:"id"`
+	Name           string  `json:"name"`
+	City           string  `json:"city"`
+	Address        string  `json:"address"`
+	BusinessSphere string  `json:"business_sphere"`
+	Lat            float64 `json:"lat"`
+	Lon            float64 `json:"lon"`
+	Rank           float64 `json:"rank"`
+	NameHighlight  string  `json:"name_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+// EnsureCompanySearch создаёт колонку и GIN-индекс полнотекстового поиска, триграммные индексы
+// подсказок и индексирует компании, ещё не попавшие в индекс (созданные до появления поиска
+// или при сбое обновления)
+func EnsureCompanySearch() error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	statements := []string{
+		`ALTER TABLE company ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS company_search_vector_idx ON company USING GIN (search_vector)`,
+		`UPDATE company SET search_vector = ` + companySearchVector + ` WHERE search_vector IS NULL`,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	}
+	for _, source := range suggestSources {
+		statements = append(statements, fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS company_%[1]s_trgm_idx ON company USING GIN (%[1]s gin_trgm_ops)`, source.column))
+	}
+	for _, stmt := range statements {
+		if _, err := o.Raw(stmt).Exec(); err != nil {
+			return fmt.Errorf("failed to prepare company search: %v", err)
+		}
+	}
+	return nil
+}
+
+// refreshCompanySearch пересчитывает поисковый вектор компании. Ошибка только логируется:
+// сохранение компании важнее свежести индекса.
+func refreshCompanySearch(o orm.Ormer, id int64) {
+	if _, err := o.Raw(`UPDATE company SET search_vector = `+companySearchVector+` WHERE id = ?`, id).Exec(); err != nil {
+		logger.ErrorAny("Failed to refresh company search index", map[string]interface{}{
+			"company_id": id,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// SearchCompanies ищет незаблокированные компании по запросу в синтаксисе веб-поиска
+// ("кофе -сеть", "\"свежая выпечка\"", "пицца or суши") с учётом морфологии русского языка.
+// Возвращает страницу результатов по убыванию релевантности и общее число найденных;
+// страница больше SearchPageMax урезается до него.
+func SearchCompanies(query string, limit, offset int) ([]CompanySearchHit, int64, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, 0, ErrEmptySearchQuery
+	}
+	if len([]rune(query)) > searchQueryMaxLen {
+		query = string([]rune(query)[:searchQueryMaxLen])
+	}
+	switch {
+	case limit <= 0:
+		limit = SearchPageDefault
+	case limit > SearchPageMax:
+		limit = SearchPageMax
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	var total int64
+	err := o.Raw(`SELECT count(*) FROM company
+		WHERE blocked = false AND search_vector @@ websearch_to_tsquery('russian', ?)`, query).QueryRow(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %v", err)
+	}
+
+	// ts_rank с нормализацией 32 (rank / (rank + 1)) даёт значения от 0 до 1
+	var hits []CompanySearchHit
+	_, err = o.Raw(`SELECT c.id, c.name, c.city, c.address, c.business_sphere, c.lat, c.lon,
+			ts_rank(c.search_vector, q, 32) AS rank,
+			ts_headline('russian', coalesce(c.name, ''), q, ?) AS name_highlight,
+			ts_headline('russian', coalesce(c.description, ''), q, ?) AS snippet
+		FROM company c, websearch_to_tsquery('russian', ?) q
+		WHERE c.blocked = false AND c.search_vector @@ q
+		ORDER BY rank DESC, c.id
+		LIMIT ? OFFSET ?`, nameHeadlineOptions, snippetHeadlineOptions, query, limit, offset).QueryRows(&hits)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search companies: %v", err)
+	}
+
+	for i := range hits {
+		hits[i].NameHighlight = highlightHTML(hits[i].NameHighlight)
+		hits[i].Snippet = highlightHTML(hits[i].Snippet)
+	}
+	if hits == nil {
+		hits = []CompanySearchHit{}
+	}
+	return hits, total, nil
+}
+
+// highlightHTML экранирует фрагмент и заменяет границы совпадений на <mark>
+func highlightHTML(fragment string) string {
+	fragment = html.EscapeString(fragment)
+	fragment = strings.ReplaceAll(fragment, highlightStart, "<mark>")
+	return strings.ReplaceAll(fragment, highlightStop, "</mark>")
+}
@@ -0,0 +1,407 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(AccountSession))
+}
+
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// sessionTouchInterval — как часто обновляется last_seen_at, чтобы не писать в БД на каждый запрос
+const sessionTouchInterval = time.Minute
+
+// AccountSession — вход аккаунта с конкретного устройства. Id совпадает с семейством
+// refresh-токенов и sid в access-токенах этого входа.
+type AccountSession struct {
+	Id          string    `orm:"pk;size(32);column(id)"`
+	SubjectType string    `orm:"size(16);column(subject_type)"`
+	SubjectId   int64     `orm:"index;column(subject_id)"`
+	UserAgent   string    `orm:"size(255);column(user_agent)"`
+	IP          string    `orm:"size(64);column(ip)"`
+	CreatedAt   time.Time `orm:"type(timestamp);column(created_at)"`
+	LastSeenAt  time.Time `orm:"type(timestamp);column(last_seen_at)"`
+	RevokedAt   time.Time `orm:"type(timestamp);null;column(revoked_at)"`
+	// Profiles — роли других профилей аккаунта через запятую, пароль которых проверен при входе
+	Profiles string `orm:"size(64);null;column(profiles)"`
+}
+
+// SessionClient — устройство, с которого выполняется вход или обновление токенов
+type SessionClient struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionInfo — сессия в ответах API
+type SessionInfo struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// SessionStore хранит сессии аккаунтов
+type SessionStore interface {
+	Create(s AccountSession) error
+	// Get возвращает сессию или nil, если её нет
+	Get(id string) (*AccountSession, error)
+	// Touch обновляет last_seen_at; непустые поля client заменяют сохранённые
+	Touch(id string, at time.Time, client SessionClient) error
+	// List возвращает действующие сессии аккаунта, начиная с последней активной
+	List(subjectType string, subjectID int64, activeSince time.Time) ([]AccountSession, error)
+	// Revoke отзывает сессию аккаунта; false — сессии нет или она уже отозвана
+	Revoke(subjectType string, subjectID int64, id string) (bool, error)
+	// RevokeAll отзывает все сессии аккаунта, кроме except, и возвращает их число
+	RevokeAll(subjectType string, subjectID int64, except string) (int64, error)
+}
+
+// Sessions используется при входе и в AuthFilter. По умолчанию сессии хранятся в БД.
+var Sessions SessionStore = ormSessionStore{}
+
+type ormSessionStore struct{}
+
+func (ormSessionStore) Create(s AccountSession) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.Insert(&s); err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+	return nil
+}
+
+func (ormSessionStore) Get(id string) (*AccountSession, error) {
+	var s AccountSession
+	o := orm.NewOrmUsingDB("mydatabase")
+	err := o.QueryTable("account_session").Filter("id", id).One(&s)
+	if errors.Is(err, orm.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %v", err)
+	}
+	return &s, nil
+}
+
+func (ormSessionStore) Touch(id string, at time.Time, client SessionClient) error {
+	params := orm.Params{"last_seen_at": at}
+	if client.UserAgent != "" {
+		params["user_agent"] = client.UserAgent
+	}
+	if client.IP != "" {
+		params["ip"] = client.IP
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.QueryTable("account_session").Filter("id", id).Update(params); err != nil {
+		return fmt.Errorf("failed to update session: %v", err)
+	}
+	return nil
+}
+
+func (ormSessionStore) List(subjectType string, subjectID int64, activeSince time.Time) ([]AccountSession, error) {
+	var sessions []AccountSession
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("account_session").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID).
+		Filter("revoked_at__isnull", true).
+		Filter("last_seen_at__gte", activeSince).
+		OrderBy("-last_seen_at").
+		All(&sessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+func (ormSessionStore) Revoke(subjectType string, subjectID int64, id string) (bool, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	n, err := o.QueryTable("account_session").
+		Filter("id", id).
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID).
+		Filter("revoked_at__isnull", true).
+		Update(orm.Params{"revoked_at": time.Now()})
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke session: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (ormSessionStore) RevokeAll(subjectType string, subjectID int64, except string) (int64, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	qs := o.QueryTable("account_session").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID).
+		Filter("revoked_at__isnull", true)
+	if except != "" {
+		qs = qs.Exclude("id", except)
+	}
+	n, err := qs.Update(orm.Params{"revoked_at": time.Now()})
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	return n, nil
+}
+
+// MemorySessionStore — сессии в памяти процесса, для тестов и одиночного экземпляра
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]AccountSession
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]AccountSession)}
+}
+
+func (m *MemorySessionStore) Create(s AccountSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.Id] = s
+	return nil
+}
+
+func (m *MemorySessionStore) Get(id string) (*AccountSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (m *MemorySessionStore) Touch(id string, at time.Time, client SessionClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	s.LastSeenAt = at
+	if client.UserAgent != "" {
+		s.UserAgent = client.UserAgent
+	}
+	if client.IP != "" {
+		s.IP = client.IP
+	}
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *MemorySessionStore) List(subjectType string, subjectID int64, activeSince time.Time) ([]AccountSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []AccountSession
+	for _, s := range m.sessions {
+		if s.SubjectType == subjectType && s.SubjectId == subjectID && s.RevokedAt.IsZero() && !s.LastSeenAt.Before(activeSince) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) Revoke(subjectType string, subjectID int64, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.SubjectType != subjectType || s.SubjectId != subjectID || !s.RevokedAt.IsZero() {
+		return false, nil
+	}
+	s.RevokedAt = time.Now()
+	m.sessions[id] = s
+	return true, nil
+}
+
+func (m *MemorySessionStore) RevokeAll(subjectType string, subjectID int64, except string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, s := range m.sessions {
+		if id != except && s.SubjectType == subjectType && s.SubjectId == subjectID && s.RevokedAt.IsZero() {
+			s.RevokedAt = time.Now()
+			m.sessions[id] = s
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c SessionClient) normalized() SessionClient {
+	if ua := []rune(c.UserAgent); len(ua) > 255 {
+		c.UserAgent = string(ua[:255])
+	}
+	if len(c.IP) > 64 {
+		c.IP = c.IP[:64]
+	}
+	return c
+}
+
+// startSession записывает сессию нового входа или обновляет сессию при ротации refresh-токена.
+// Для входов, выполненных до появления учёта сессий, запись создаётся при первом обновлении.
+// verified — другие профили аккаунта, пароль которых проверен при входе; при обновлении не меняются.
+func startSession(id, subjectType string, subjectID int64, client SessionClient, verified []string) error {
+	client = client.normalized()
+	now := time.Now()
+
+	existing, err := Sessions.Get(id)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return Sessions.Touch(id, now, client)
+	}
+	return Sessions.Create(AccountSession{
+		Id:          id,
+		SubjectType: subjectType,
+		SubjectId:   subjectID,
+		UserAgent:   client.UserAgent,
+		IP:          client.IP,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		Profiles:    strings.Join(verified, ","),
+	})
+}
+
+// CheckSession проверяет, что сессия access-токена не отозвана, и отмечает её активность.
+// Токены без sid (служебные, выданные не через вход) проверяются только по jti и iat.
+func CheckSession(p *Principal) error {
+	if p.SessionID == "" {
+		return nil
+	}
+
+	subjectType, subjectID := p.sessionSubject()
+	s, err := Sessions.Get(p.SessionID)
+	if err != nil {
+		return err
+	}
+	if s == nil || !s.RevokedAt.IsZero() || s.SubjectType != subjectType || s.SubjectId != subjectID {
+		return ErrSessionRevoked
+	}
+
+	now := time.Now()
+	if now.Sub(s.LastSeenAt) >= sessionTouchInterval {
+		if err := Sessions.Touch(s.Id, now, SessionClient{}); err != nil {
+			logger.WarnAny("Failed to update session last seen", map[string]interface{}{
+				"session_id": s.Id,
+				"error":      err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// sessionSubject — профиль, на который записываются сессии
+type sessionSubject struct {
+	role string
+	id   int64
+}
+
+// sessionSubjects возвращает профиль сессии токена и остальные профили его аккаунта:
+// сессиями управляют для всего аккаунта, с какого бы профиля ни был выполнен вход.
+// Закрытый в токене профиль не входит: его сессии видны только после входа в него.
+func (p *Principal) sessionSubjects() []sessionSubject {
+	role, id := p.sessionSubject()
+	subjects := []sessionSubject{{role, id}}
+	for r, profile := range p.Profiles {
+		if r != role && !profile.locked() {
+			subjects = append(subjects, sessionSubject{r, profile.ID})
+		}
+	}
+	return subjects
+}
+
+// ListSessions возвращает действующие сессии аккаунта субъекта; текущая отмечена current
+func ListSessions(p *Principal) ([]SessionInfo, error) {
+	var sessions []AccountSession
+	for _, subject := range p.sessionSubjects() {
+		found, err := Sessions.List(subject.role, subject.id, time.Now().Add(-RefreshTokenTTL()))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, found...)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, SessionInfo{
+			Id:         s.Id,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			Current:    s.Id == p.SessionID,
+		})
+	}
+	return infos, nil
+}
+
+// RevokeAccountSession завершает одну сессию аккаунта субъекта (например, потерянное устройство).
+// Чужая или уже завершённая сессия — ErrNotFound.
+func RevokeAccountSession(p *Principal, sessionID string, ip string) error {
+	var ok bool
+	for _, subject := range p.sessionSubjects() {
+		revoked, err := Sessions.Revoke(subject.role, subject.id, sessionID)
+		if err != nil {
+			return err
+		}
+		ok = ok || revoked
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	if err := RevokeTokenFamily(sessionID); err != nil {
+		return err
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "session.revoke",
+		ActorType:  p.Role,
+		ActorId:    p.ID,
+		EntityType: "session",
+		EntityId:   sessionID,
+		IP:         ip,
+	}, nil)
+	return nil
+}
+
+// RevokeOtherSessions завершает все сессии аккаунта, кроме текущей, и возвращает их число
+func RevokeOtherSessions(p *Principal, ip string) (int64, error) {
+	var n int64
+	for _, subject := range p.sessionSubjects() {
+		revoked, err := Sessions.RevokeAll(subject.role, subject.id, p.SessionID)
+		if err != nil {
+			return 0, err
+		}
+		if err := revokeOtherTokenFamilies(subject.role, subject.id, p.SessionID); err != nil {
+			return 0, err
+		}
+		n += revoked
+	}
+
+	WriteAudit(AuditLog{
+		Action:     "session.revoke_others",
+		ActorType:  p.Role,
+		ActorId:    p.ID,
+		EntityType: p.Role,
+		EntityId:   strconv.FormatInt(p.ID, 10),
+		IP:         ip,
+	}, map[string]interface{}{
+		"revoked": n,
+	})
+	return n, nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"api/pkg/keyboard"
+	"fmt"
+	"strings"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+// Виды подсказок
+const (
+	SuggestCompany        = "company"
+	SuggestCity           = "city"
+	SuggestBusinessSphere = "business_sphere"
+)
+
+// Число подсказок в ответе
+const (
+	SuggestLimitDefault = 10
+	SuggestLimitMax     = 20
+)
+
+// suggestSources — колонки company, из которых берутся подсказки
+var suggestSources = []struct{ kind, column string }{
+	{SuggestCompany, "name"},
+	{SuggestCity, "city"},
+	{SuggestBusinessSphere, "business_sphere"},
+}
+
+// Suggestion — подсказка для строки поиска. Score — близость к вводу (word_similarity из pg_trgm,
+// плюс 1 за совпадение по префиксу), Popularity — число незаблокированных компаний с этим значением.
+type Suggestion struct {
+	Kind       string  `json:"kind"`
+	Text       string  `json:"text"`
+	Score      float64 `json:"score"`
+	Popularity int64   `json:"popularity"`
+}
+
+// suggestThreshold — минимальная триграммная близость, при которой значение считается опечаткой ввода
+func suggestThreshold() float64 {
+	return beego.AppConfig.DefaultFloat("search_suggest_threshold", 0.3)
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// suggestSQL собирает запрос подсказок: по подзапросу на каждую колонку, значения сгруппированы,
+// поэтому одинаковые названия (сеть из нескольких точек) дают одну подсказку с большей популярностью.
+// Отбор идёт операторами ILIKE и %>, которые используют триграммные индексы EnsureCompanySearch;
+// порог %> задаётся pg_trgm.word_similarity_threshold на время запроса в input, а сравнение
+// с i.q не может выполниться раньше, чем прочитана строка input.
+func suggestSQL() string {
+	parts := make([]string, 0, len(suggestSources))
+	for _, source := range suggestSources {
+		parts = append(parts, fmt.Sprintf(`SELECT '%[1]s' AS kind, c.%[2]s AS text, count(*) AS popularity,
+				greatest(word_similarity(i.q, c.%[2]s), word_similarity(i.alt, c.%[2]s))
+					+ CASE WHEN c.%[2]s ILIKE i.prefix OR c.%[2]s ILIKE i.alt_prefix THEN 1 ELSE 0 END AS score
+			FROM company c, input i
+			WHERE c.blocked = false AND c.%[2]s <> ''
+				AND (c.%[2]s ILIKE i.prefix OR c.%[2]s ILIKE i.alt_prefix OR c.%[2]s %%> i.q OR c.%[2]s %%> i.alt)
+			GROUP BY c.%[2]s, i.q, i.alt, i.prefix, i.alt_prefix`, source.kind, source.column))
+	}
+	return `WITH input AS (SELECT ?::text AS q, ?::text AS alt, ?::text AS prefix, ?::text AS alt_prefix,
+			set_config('pg_trgm.word_similarity_threshold', ?::real::text, true) AS threshold)
+		SELECT kind, text, popularity, score FROM (
+			` + strings.Join(parts, "\n\t\t\tUNION ALL\n\t\t\t") + `
+		) s
+		ORDER BY score DESC, popularity DESC, text
+		LIMIT ?`
+}
+
+// SuggestCompanies подбирает подсказки по началу ввода среди названий компаний, городов и сфер
+// деятельности. Учитывает опечатки (триграммы) и ввод в латинской раскладке вместо русской:
+// "rjatq" ищется и как есть, и как "кофей". Больше SuggestLimitMax подсказок не возвращается.
+func SuggestCompanies(query string, limit int) ([]Suggestion, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []Suggestion{}, nil
+	}
+	if len([]rune(query)) > searchQueryMaxLen {
+		query = string([]rune(query)[:searchQueryMaxLen])
+	}
+	switch {
+	case limit <= 0:
+		limit = SuggestLimitDefault
+	case limit > SuggestLimitMax:
+		limit = SuggestLimitMax
+	}
+
+	alt := query
+	if converted, ok := keyboard.ToCyrillic(query); ok {
+		alt = converted
+	}
+
+	var suggestions []Suggestion
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.Raw(suggestSQL(), query, alt, escapeLike(query)+"%", escapeLike(alt)+"%", suggestThreshold(), limit).
+		QueryRows(&suggestions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch suggestions: %v", err)
+	}
+	if suggestions == nil {
+		suggestions = []Suggestion{}
+	}
+	return suggestions, nil
+}
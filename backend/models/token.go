@@ -0,0 +1,442 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(RefreshToken), new(RevokedToken), new(SubjectRevocation))
+}
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrAccountBlocked      = errors.New("account is blocked")
+)
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken хранит sha256 от выданного refresh-токена.
+// Все токены, полученные ротацией из одного входа, составляют семейство (FamilyId);
+// FamilyId также кладётся в access-токен как sid.
+type RefreshToken struct {
+	Id          int64     `orm:"auto;column(id)"`
+	TokenHash   string    `orm:"unique;size(64);column(token_hash)"`
+	FamilyId    string    `orm:"index;size(32);column(family_id)"`
+	SubjectType string    `orm:"size(16);column(subject_type)"`
+	SubjectId   int64     `orm:"column(subject_id)"`
+	Revoked     bool      `orm:"default(false);column(revoked)"`
+	ExpiresAt   time.Time `orm:"type(timestamp);column(expires_at)"`
+	CreatedAt   time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+}
+
+// RevokedToken — jti отозванного access-токена, хранится до истечения самого токена
+type RevokedToken struct {
+	Jti       string    `orm:"pk;size(32);column(jti)"`
+	ExpiresAt time.Time `orm:"type(timestamp);column(expires_at)"`
+}
+
+// SubjectRevocation — момент, раньше которого все access-токены аккаунта недействительны
+// (сброс пароля, блокировка)
+type SubjectRevocation struct {
+	Id            int64     `orm:"auto;column(id)"`
+	SubjectType   string    `orm:"size(16);column(subject_type)"`
+	SubjectId     int64     `orm:"column(subject_id)"`
+	RevokedBefore time.Time `orm:"type(timestamp);column(revoked_before)"`
+}
+
+func (r *SubjectRevocation) TableUnique() [][]string {
+	return [][]string{{"SubjectType", "SubjectId"}}
+}
+
+// RevocationStore хранит чёрный список jti access-токенов и моменты отзыва
+// всех токенов аккаунта
+type RevocationStore interface {
+	Revoke(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+	RevokeSubject(subjectType string, subjectID int64, before time.Time) error
+	SubjectRevokedBefore(subjectType string, subjectID int64) (time.Time, error)
+}
+
+// AccessTokenRevocations используется VerifyToken и VerifyOwnerToken.
+// По умолчанию список хранится в БД, чтобы его видели все экземпляры приложения.
+var AccessTokenRevocations RevocationStore = ormRevocationStore{}
+
+type ormRevocationStore struct{}
+
+func (ormRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.InsertOrUpdate(&RevokedToken{Jti: jti, ExpiresAt: expiresAt}, "jti"); err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+
+	// Попутно чистим записи о токенах, которые уже истекли сами
+	if _, err := o.QueryTable("revoked_token").Filter("expires_at__lt", time.Now()).Delete(); err != nil {
+		logger.WarnAny("Failed to purge expired revoked tokens", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return nil
+}
+
+func (ormRevocationStore) IsRevoked(jti string) (bool, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+	exists := o.QueryTable("revoked_token").
+		Filter("jti", jti).
+		Filter("expires_at__gt", time.Now()).
+		Exist()
+	return exists, nil
+}
+
+func (ormRevocationStore) RevokeSubject(subjectType string, subjectID int64, before time.Time) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.Raw(`INSERT INTO subject_revocation (subject_type, subject_id, revoked_before) VALUES (?, ?, ?)
+		ON CONFLICT (subject_type, subject_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before`,
+		subjectType, subjectID, before).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to revoke subject tokens: %v", err)
+	}
+	return nil
+}
+
+func (ormRevocationStore) SubjectRevokedBefore(subjectType string, subjectID int64) (time.Time, error) {
+	var r SubjectRevocation
+	o := orm.NewOrmUsingDB("mydatabase")
+	err := o.QueryTable("subject_revocation").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID).
+		One(&r)
+	if errors.Is(err, orm.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return r.RevokedBefore, err
+}
+
+// MemoryRevocationStore — чёрный список в памяти процесса, для тестов и одиночного экземпляра
+type MemoryRevocationStore struct {
+	mu       sync.Mutex
+	revoked  map[string]time.Time
+	subjects map[string]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked:  make(map[string]time.Time),
+		subjects: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, exp := range s.revoked {
+		if exp.Before(now) {
+			delete(s.revoked, k)
+		}
+	}
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.revoked[jti]
+	return ok && exp.After(time.Now()), nil
+}
+
+func (s *MemoryRevocationStore) RevokeSubject(subjectType string, subjectID int64, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subjects[fmt.Sprintf("%s:%d", subjectType, subjectID)] = before
+	return nil
+}
+
+func (s *MemoryRevocationStore) SubjectRevokedBefore(subjectType string, subjectID int64) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subjects[fmt.Sprintf("%s:%d", subjectType, subjectID)], nil
+}
+
+// AccessTokenTTL — время жизни access-токена (access_token_ttl в app.conf)
+func AccessTokenTTL() time.Duration {
+	return configDuration("access_token_ttl", 15*time.Minute)
+}
+
+// RefreshTokenTTL — время жизни refresh-токена (refresh_token_ttl в app.conf)
+func RefreshTokenTTL() time.Duration {
+	return configDuration("refresh_token_ttl", 30*24*time.Hour)
+}
+
+func configDuration(key string, def time.Duration) time.Duration {
+	value, err := beego.AppConfig.String(key)
+	if err != nil || value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.WarnAny("Invalid duration in config, using default", map[string]interface{}{
+			"key":     key,
+			"value":   value,
+			"default": def.String(),
+		})
+		return def
+	}
+	return d
+}
+
+// randomToken возвращает n случайных байт в виде base64url
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// newTokenID генерирует jti и идентификатор семейства refresh-токенов
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokenPair выдаёт access-токен и сохраняет новый refresh-токен семейства familyID.
+// Пустой familyID означает новый вход и новое семейство; сессия входа записывается с данными client
+// и профилями verified (см. startSession).
+func issueTokenPair(subjectType string, subjectID int64, familyID string, client SessionClient, verified []string, sign func(sessionID string) (string, error)) (*TokenPair, error) {
+	if familyID == "" {
+		familyID = newTokenID()
+	}
+	if err := startSession(familyID, subjectType, subjectID, client, verified); err != nil {
+		return nil, err
+	}
+
+	raw := randomToken(32)
+	rt := RefreshToken{
+		TokenHash:   hashToken(raw),
+		FamilyId:    familyID,
+		SubjectType: subjectType,
+		SubjectId:   subjectID,
+		ExpiresAt:   time.Now().Add(RefreshTokenTTL()),
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	if _, err := o.Insert(&rt); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %v", err)
+	}
+
+	access, err := sign(familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: raw,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// rotateRefreshToken погашает предъявленный refresh-токен и возвращает его запись.
+// Повторное предъявление уже погашенного токена означает утечку:
+// отзывается всё семейство, включая токены, выданные ротацией.
+func rotateRefreshToken(raw, subjectType string) (*RefreshToken, error) {
+	o := orm.NewOrmUsingDB("mydatabase")
+
+	var rt RefreshToken
+	err := o.QueryTable("refresh_token").
+		Filter("token_hash", hashToken(raw)).
+		Filter("subject_type", subjectType).
+		One(&rt)
+	if err != nil {
+		if errors.Is(err, orm.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	logFields := map[string]interface{}{
+		"family_id":    rt.FamilyId,
+		"subject_type": rt.SubjectType,
+		"subject_id":   rt.SubjectId,
+	}
+
+	if rt.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Условное обновление защищает от гонки двух одновременных ротаций
+	n, err := o.QueryTable("refresh_token").
+		Filter("id", rt.Id).
+		Filter("revoked", false).
+		Update(orm.Params{"revoked": true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %v", err)
+	}
+	if n == 0 {
+		logger.WarnAny("Refresh token reuse detected, revoking token family", logFields)
+		if err := RevokeTokenFamily(rt.FamilyId); err != nil {
+			logFields["error"] = err.Error()
+			logger.ErrorAny("Failed to revoke token family", logFields)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return &rt, nil
+}
+
+// RevokeTokenFamily отзывает все refresh-токены семейства
+func RevokeTokenFamily(familyID string) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("refresh_token").
+		Filter("family_id", familyID).
+		Filter("revoked", false).
+		Update(orm.Params{"revoked": true})
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family: %v", err)
+	}
+	return nil
+}
+
+// RevokeSubjectTokens отзывает все refresh-токены аккаунта.
+// Уже выданные access-токены доживают свой короткий срок (access_token_ttl).
+func RevokeSubjectTokens(subjectType string, subjectID int64) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("refresh_token").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID).
+		Filter("revoked", false).
+		Update(orm.Params{"revoked": true})
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %v", err)
+	}
+	return nil
+}
+
+// revokeOtherTokenFamilies отзывает refresh-токены аккаунта, кроме семейства keepFamilyID
+func revokeOtherTokenFamilies(subjectType string, subjectID int64, keepFamilyID string) error {
+	o := orm.NewOrmUsingDB("mydatabase")
+	_, err := o.QueryTable("refresh_token").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID).
+		Filter("revoked", false).
+		Exclude("family_id", keepFamilyID).
+		Update(orm.Params{"revoked": true})
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %v", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions завершает все сессии аккаунта: отзывает refresh-токены
+// и делает недействительными access-токены, выданные до этого момента
+func RevokeAllSessions(subjectType string, subjectID int64) error {
+	if err := RevokeSubjectTokens(subjectType, subjectID); err != nil {
+		return err
+	}
+	if _, err := Sessions.RevokeAll(subjectType, subjectID, ""); err != nil {
+		return err
+	}
+
+	// iat хранится с точностью до секунды: токены, выданные в ту же секунду, остаются
+	// действительными, иначе отзыв задел бы и токен, выданный сразу после него
+	before := time.Now().Truncate(time.Second)
+	return AccessTokenRevocations.RevokeSubject(subjectType, subjectID, before)
+}
+
+// RevokeSession завершает сессию, к которой относится access-токен:
+// отзывает семейство refresh-токенов (sid) и вносит jti в чёрный список до истечения токена.
+func RevokeSession(p *Principal) error {
+	if p.SessionID != "" {
+		if err := RevokeTokenFamily(p.SessionID); err != nil {
+			return err
+		}
+		subjectType, subjectID := p.sessionSubject()
+		if _, err := Sessions.Revoke(subjectType, subjectID, p.SessionID); err != nil {
+			return err
+		}
+	}
+
+	if p.TokenID == "" {
+		return nil
+	}
+	return AccessTokenRevocations.Revoke(p.TokenID, p.ExpiresAt)
+}
+
+// checkRevoked проверяет jti проверенного токена по чёрному списку
+// и время выдачи по моменту отзыва всех токенов аккаунта — и самого профиля токена,
+// и открытых в нём профилей аккаунта: заблокированный владелец или владелец со сброшенным
+// паролем не остаётся доступен через токен посетителя
+func checkRevoked(claims *Claims) error {
+	if claims.ID != "" {
+		revoked, err := AccessTokenRevocations.IsRevoked(claims.ID)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+
+	subjectID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token subject: %v", err)
+	}
+	if err := checkSubjectRevoked(claims, claims.Role, subjectID); err != nil {
+		return err
+	}
+	for role, profile := range claims.Profiles {
+		if role == claims.Role || profile.locked() {
+			continue
+		}
+		if err := checkSubjectRevoked(claims, role, profile.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSubjectRevoked сравнивает время выдачи токена с моментом отзыва токенов профиля
+func checkSubjectRevoked(claims *Claims, subjectType string, subjectID int64) error {
+	before, err := AccessTokenRevocations.SubjectRevokedBefore(subjectType, subjectID)
+	if err != nil {
+		return err
+	}
+	if !before.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(before)) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
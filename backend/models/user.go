@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/beego/beego/v2/client/orm"
-	"github.com/golang-jwt/jwt/v5"
 	"strings"
 )
 
@@ -13,6 +12,8 @@ func init() {
 	orm.RegisterModel(new(User))
 }
 
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
 type PostUserRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
@@ -28,6 +29,10 @@ type User struct {
 	Username string `orm:"column(username)"`
 	Email    string `orm:"column(email)"`
 	Password string `orm:"column(password_hash)"`
+	Blocked  bool   `orm:"default(false);column(blocked)"`
+
+	EmailVerified bool  `orm:"default(false);column(email_verified)"`
+	AccountId     int64 `orm:"default(0);index;column(account_id)"`
 }
 
 type LoginRequest struct {
@@ -35,40 +40,21 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-// Создание секретного ключа
-var SecretKey = []byte("your-secret-key")
-
-func CreateToken(u User) (string, error) {
+func CreateToken(u User, sessionID string) (string, error) {
 	// создаем заявку
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":   u.Id,
-		"name": u.Username,
-	})
-	// генерируем токен
-	tokenString, err := claims.SignedString(SecretKey)
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
+	claims := newClaims(RoleVisitor, u.Id, sessionID)
+	claims.Name = u.Username
+	claims.EmailVerified = u.EmailVerified
+	claims.attachAccount(u.AccountId)
+	// генерируем токен ключом подписи посетителей
+	return signClaims(claims)
 }
 
-func VerifyToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	return token.Claims.(jwt.MapClaims), nil
+func VerifyToken(tokenString string) (*Claims, error) {
+	return verifyClaims(tokenString, RoleVisitor)
 }
 
-func AddUser(u User) (int64, error) {
+func AddUser(u User, actor Actor) (int64, error) {
 	logFields := map[string]interface{}{
 		"username": u.Username,
 		"email":    u.Email,
@@ -76,6 +62,14 @@ func AddUser(u User) (int64, error) {
 
 	logger.InfoAny("Attempting to create user", logFields)
 
+	hash, err := HashPassword(u.Password)
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to hash user password", logFields)
+		return 0, fmt.Errorf("failed to create user: %v", err)
+	}
+	u.Password = hash
+
 	o := orm.NewOrmUsingDB("mydatabase")
 	id, err := o.Insert(&u)
 	if err != nil {
@@ -97,6 +91,12 @@ func AddUser(u User) (int64, error) {
 	logFields["user_id"] = id
 	logger.InfoAny("User created successfully", logFields)
 
+	u.Id = id
+	RecordChange(actor, "visitor.create", RoleVisitor, id, nil, u)
+
+	attachNewAccount(RoleVisitor, id, u.Email)
+	notifyEmailVerification(RoleVisitor, id, u.Email)
+
 	return id, nil
 }
 
@@ -110,48 +110,129 @@ func GetUser(uid int64) (u *User, err error) {
 	return &user, nil
 }
 
-func GetAllUsers() *[]User {
+// GetAllUsers возвращает десять последних посетителей без хешей паролей
+func GetAllUsers() []AccountSummary {
 	var users []User
 	o := orm.NewOrmUsingDB("mydatabase")
-	qb, _ := orm.NewQueryBuilder("postgres")
-	qb.Select("id", "username", "password_hash").From("user").Where("id > ?").OrderBy("id").Desc().Limit(10)
-	o.Raw(qb.String(), 0).QueryRows(&users)
-	return &users
+	o.QueryTable("user").OrderBy("-id").Limit(10).All(&users, "Id", "Username", "Email", "Blocked")
+
+	result := make([]AccountSummary, 0, len(users))
+	for _, u := range users {
+		result = append(result, u.Summary())
+	}
+	return result
 }
 
-func UpdateUser(uu *User) (err error) {
+// UpdateUser меняет имя посетителя; пароль меняется, только если передан
+func UpdateUser(uu *User, actor Actor) (err error) {
+	columns := []string{"username"}
+	passwordChanged := uu.Password != ""
+	if passwordChanged {
+		if uu.Password, err = hashNewPassword(uu.Password); err != nil {
+			return err
+		}
+		columns = append(columns, "password_hash")
+	}
+
 	o := orm.NewOrmUsingDB("mydatabase")
-	_, err = o.Update(uu, "username", "password_hash")
+	before := User{Id: uu.Id}
+	if err := o.Read(&before); err != nil {
+		return errors.New("user not found")
+	}
+	_, err = o.Update(uu, columns...)
 	if err != nil {
 		return errors.New("user not found")
 	}
+
+	after := before
+	after.Username = uu.Username
+	if passwordChanged {
+		after.Password = uu.Password
+	}
+	RecordChange(actor, "visitor.update", RoleVisitor, uu.Id, before, after)
+	if passwordChanged {
+		return endSessionsAfterPasswordChange(RoleVisitor, uu.Id, actor)
+	}
 	return nil
 }
 
-func Login(req LoginRequest) (string, error) {
+func Login(req LoginRequest, client SessionClient) (*TokenPair, error) {
 	o := orm.NewOrmUsingDB("mydatabase")
 
 	var user User
 	err := o.QueryTable("user").Filter("username", req.Username).One(&user)
 	if err != nil {
 		if errors.Is(err, orm.ErrNoRows) {
-			return "", errors.New("invalid username or password")
+			return nil, ErrInvalidCredentials
 		}
-		return "", err
+		return nil, err
 	}
 
 	// Сравниваем пароль
-	if req.Password != user.Password {
-		return "", errors.New("invalid username or password")
+	ok, upgrade := CheckPassword(req.Password, user.Password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Blocked {
+		return nil, ErrAccountBlocked
+	}
+	if upgrade {
+		upgradeUserPassword(o, &user, req.Password)
 	}
 
-	// Генерируем токен, если логин и пароль верны
-	return CreateToken(user)
+	// Генерируем токены, если логин и пароль верны
+	return issueUserTokens(user, "", client)
 }
 
-func DeleteUser(uid int64) bool {
-	o := orm.NewOrmUsingDB("mydatabase")
-	user := User{Id: uid}
-	_, err := o.Delete(&user)
-	return err == nil
+// RefreshUserToken обменивает refresh-токен посетителя на новую пару токенов
+func RefreshUserToken(raw string, client SessionClient) (*TokenPair, error) {
+	rt, err := rotateRefreshToken(raw, RoleVisitor)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := GetUser(rt.SubjectId)
+	if err != nil || user.Blocked {
+		return nil, ErrInvalidRefreshToken
+	}
+	return issueUserTokens(*user, rt.FamilyId, client)
+}
+
+func issueUserTokens(u User, familyID string, client SessionClient) (*TokenPair, error) {
+	return issueTokenPair(RoleVisitor, u.Id, familyID, client, nil, func(sessionID string) (string, error) {
+		return CreateToken(u, sessionID)
+	})
+}
+
+// DeleteUser сразу удаляет посетителя и его данные по политике удаления (privacy.go)
+func DeleteUser(uid int64, actor Actor) bool {
+	if err := eraseProfileNow(RoleVisitor, uid, actor); err != nil {
+		logger.ErrorAny("Failed to delete user", map[string]interface{}{
+			"user_id": uid,
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// upgradeUserPassword перезаписывает устаревший или открытый пароль новым хешем.
+// Ошибка только логируется: вход при этом не должен срываться.
+func upgradeUserPassword(o orm.Ormer, user *User, plain string) {
+	logFields := map[string]interface{}{
+		"user_id": user.Id,
+	}
+
+	hash, err := HashPassword(plain)
+	if err == nil {
+		user.Password = hash
+		_, err = o.Update(user, "password_hash")
+	}
+	if err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to upgrade user password hash", logFields)
+		return
+	}
+
+	logger.InfoAny("User password hash upgraded", logFields)
 }
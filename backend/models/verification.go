@@ -0,0 +1,233 @@
+package models
+
+import (
+	"api/pkg/logger"
+	"api/pkg/mailer"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+func init() {
+	orm.RegisterModel(new(EmailVerification))
+}
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+// CooldownError — действие повторено раньше, чем разрешено; RetryAfter — сколько ждать
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("too many requests, retry in %d seconds", e.RetrySeconds())
+}
+
+// RetrySeconds возвращает значение для заголовка Retry-After (не меньше 1)
+func (e *CooldownError) RetrySeconds() int64 {
+	seconds := int64((e.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// EmailVerification — выданный токен подтверждения почты (aud qwerty.town/<role>/verify-email).
+// Сам токен подписан ключом роли, в БД хранится только jti, чтобы погасить токен после использования.
+type EmailVerification struct {
+	Jti         string    `orm:"pk;size(32);column(jti)"`
+	SubjectType string    `orm:"size(16);column(subject_type)"`
+	SubjectId   int64     `orm:"column(subject_id)"`
+	Email       string    `orm:"column(email)"`
+	Used        bool      `orm:"default(false);column(used)"`
+	ExpiresAt   time.Time `orm:"type(timestamp);column(expires_at)"`
+	CreatedAt   time.Time `orm:"auto_now_add;type(timestamp);column(created_at)"`
+}
+
+func emailVerificationAudience(role string) string {
+	return Audience(role) + "/verify-email"
+}
+
+// EmailVerificationTTL — срок действия ссылки (email_verification_ttl в app.conf)
+func EmailVerificationTTL() time.Duration {
+	return configDuration("email_verification_ttl", 24*time.Hour)
+}
+
+// EmailVerificationCooldown — минимальный интервал между письмами одному аккаунту
+// (email_verification_cooldown в app.conf)
+func EmailVerificationCooldown() time.Duration {
+	return configDuration("email_verification_cooldown", time.Minute)
+}
+
+// accountTable возвращает таблицу и колонку почты аккаунта данной роли
+func accountTable(subjectType string) (table, emailColumn string, err error) {
+	switch subjectType {
+	case RoleVisitor:
+		return "user", "email", nil
+	case RoleOwner:
+		return "owner", "contact_email", nil
+	}
+	return "", "", ErrUnknownRole
+}
+
+// SendEmailVerification выдаёт новый токен подтверждения адреса email и отправляет письмо.
+// Не чаще одного письма за EmailVerificationCooldown; прежние непогашенные токены аккаунта отзываются.
+func SendEmailVerification(subjectType string, subjectID int64, email string) error {
+	logFields := map[string]interface{}{
+		"subject_type": subjectType,
+		"subject_id":   subjectID,
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	qs := o.QueryTable("email_verification").
+		Filter("subject_type", subjectType).
+		Filter("subject_id", subjectID)
+
+	var last EmailVerification
+	err := qs.OrderBy("-created_at").One(&last)
+	if err != nil && !errors.Is(err, orm.ErrNoRows) {
+		return fmt.Errorf("failed to check verification cooldown: %v", err)
+	}
+	if wait := EmailVerificationCooldown() - time.Since(last.CreatedAt); err == nil && wait > 0 {
+		return &CooldownError{RetryAfter: wait}
+	}
+
+	if _, err := qs.Filter("used", false).Update(orm.Params{"used": true}); err != nil {
+		return fmt.Errorf("failed to revoke previous verification tokens: %v", err)
+	}
+
+	claims := newPurposeClaims(subjectType, emailVerificationAudience(subjectType), subjectID, EmailVerificationTTL())
+	claims.Email = email
+
+	record := EmailVerification{
+		Jti:         claims.ID,
+		SubjectType: subjectType,
+		SubjectId:   subjectID,
+		Email:       email,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	}
+	if _, err := o.Insert(&record); err != nil {
+		return fmt.Errorf("failed to store verification token: %v", err)
+	}
+
+	token, err := signPurposeClaims(claims)
+	if err != nil {
+		return err
+	}
+
+	if err := sendMail(verificationMessage(subjectType, email, token)); err != nil {
+		logFields["error"] = err.Error()
+		logger.ErrorAny("Failed to send verification email", logFields)
+		return fmt.Errorf("failed to send verification email: %v", err)
+	}
+
+	logger.InfoAny("Verification email sent", logFields)
+	return nil
+}
+
+func verificationMessage(subjectType, email, token string) mailer.Message {
+	link := beego.AppConfig.DefaultString("email_verification_url", "http://localhost:5173/verify-email") +
+		"?" + url.Values{"role": {subjectType}, "token": {token}}.Encode()
+
+	return mailer.Message{
+		To:      email,
+		Subject: "Подтвердите адрес электронной почты",
+		Body: "Здравствуйте!\n\n" +
+			"Чтобы подтвердить адрес " + email + " в QWERTY.TOWN, перейдите по ссылке:\n" +
+			link + "\n\n" +
+			"Ссылка действует " + EmailVerificationTTL().String() + " и сработает один раз.\n" +
+			"Если вы не регистрировались, просто проигнорируйте это письмо.\n",
+	}
+}
+
+// ConfirmEmail проверяет подпись и срок токена подтверждения, гасит его
+// и отмечает почту аккаунта подтверждённой. Токен действует только для того адреса,
+// на который был выдан: после смены почты нужно подтверждать заново.
+func ConfirmEmail(tokenString, subjectType string) error {
+	table, emailColumn, err := accountTable(subjectType)
+	if err != nil {
+		return err
+	}
+
+	claims, subjectID, err := verifyPurposeClaims(tokenString, subjectType, emailVerificationAudience(subjectType))
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	o := orm.NewOrmUsingDB("mydatabase")
+	n, err := o.QueryTable("email_verification").
+		Filter("jti", claims.ID).
+		Filter("used", false).
+		Update(orm.Params{"used": true})
+	if err != nil {
+		return fmt.Errorf("failed to consume verification token: %v", err)
+	}
+	if n == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	n, err = o.QueryTable(table).
+		Filter("id", subjectID).
+		Filter(emailColumn, claims.Email).
+		Update(orm.Params{"email_verified": true})
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %v", err)
+	}
+	if n == 0 {
+		return ErrInvalidVerificationToken
+	}
+
+	logger.InfoAny("Email verified", map[string]interface{}{
+		"subject_type": subjectType,
+		"subject_id":   subjectID,
+	})
+	return nil
+}
+
+// ResendEmailVerification повторно отправляет письмо подтверждения аккаунту p
+func ResendEmailVerification(p *Principal) error {
+	switch p.Role {
+	case RoleVisitor:
+		user, err := GetUser(p.ID)
+		if err != nil {
+			return err
+		}
+		if user.EmailVerified {
+			return ErrEmailAlreadyVerified
+		}
+		return SendEmailVerification(RoleVisitor, user.Id, user.Email)
+	case RoleOwner:
+		owner, err := GetOwner(p.ID)
+		if err != nil {
+			return err
+		}
+		if owner.EmailVerified {
+			return ErrEmailAlreadyVerified
+		}
+		return SendEmailVerification(RoleOwner, owner.Id, owner.Email)
+	}
+	return ErrUnknownRole
+}
+
+// notifyEmailVerification отправляет письмо после регистрации или смены адреса.
+// Ошибка отправки не срывает операцию: письмо можно запросить повторно через verify-email/resend.
+func notifyEmailVerification(subjectType string, subjectID int64, email string) {
+	if err := SendEmailVerification(subjectType, subjectID, email); err != nil {
+		logger.WarnAny("Verification email not sent", map[string]interface{}{
+			"subject_type": subjectType,
+			"subject_id":   subjectID,
+			"error":        err.Error(),
+		})
+	}
+}
@@ -1,20 +1,138 @@
 package geocoder
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
-	_ "strconv"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-type GeoResponse struct {
+// Геокодирование адресов: провайдеры Yandex, Nominatim (OpenStreetMap и совместимые сервера)
+// и Static с заранее известными адресами, а также Chain — опрос провайдеров по очереди.
+
+var ErrNotFound = errors.New("address not found")
+
+// Precision — насколько точно найден адрес
+type Precision string
+
+const (
+	PrecisionExact    Precision = "exact"    // дом
+	PrecisionStreet   Precision = "street"   // улица или соседний дом
+	PrecisionLocality Precision = "locality" // населённый пункт или район
+	PrecisionOther    Precision = "other"
+)
+
+// Result — найденная точка. Address — адрес в написании провайдера, Provider — кто его нашёл.
+type Result struct {
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Precision Precision `json:"precision"`
+	Address   string    `json:"address"`
+	Provider  string    `json:"provider"`
+}
+
+func (r Result) validate() error {
+	if r.Lat < -90 || r.Lat > 90 || r.Lon < -180 || r.Lon > 180 {
+		return fmt.Errorf("invalid coordinates %v, %v", r.Lat, r.Lon)
+	}
+	return nil
+}
+
+// Geocoder находит координаты адреса. Адрес, которого провайдер не знает, — ErrNotFound;
+// остальные ошибки (сеть, лимиты, неверный ключ) временные.
+type Geocoder interface {
+	Name() string
+	Geocode(ctx context.Context, address string) (Result, error)
+}
+
+// Chain опрашивает провайдеров по порядку и возвращает первый найденный результат.
+// ErrNotFound — только если адреса не знает ни один провайдер.
+type Chain []Geocoder
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, g := range c {
+		names[i] = g.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Geocode(ctx context.Context, address string) (Result, error) {
+	var failures []string
+	for _, g := range c {
+		result, err := g.Geocode(ctx, address)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			failures = append(failures, g.Name()+": "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return Result{}, fmt.Errorf("geocoding failed: %s", strings.Join(failures, "; "))
+	}
+	return Result{}, ErrNotFound
+}
+
+// getJSON выполняет GET и разбирает ответ; тело ответа ограничено мегабайтом
+func getJSON(ctx context.Context, client *http.Client, rawURL string, header http.Header, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// YandexURL — адрес HTTP Геокодера Яндекса
+const YandexURL = "https://geocode-maps.yandex.ru/1.x/"
+
+// Yandex — HTTP Геокодер Яндекса
+type Yandex struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewYandex(apiKey string, timeout time.Duration) *Yandex {
+	return &Yandex{APIKey: apiKey, BaseURL: YandexURL, HTTPClient: &http.Client{Timeout: timeout}}
+}
+
+func (y *Yandex) Name() string { return "yandex" }
+
+type yandexResponse struct {
 	Response struct {
 		GeoObjectCollection struct {
 			FeatureMember []struct {
 				GeoObject struct {
+					MetaDataProperty struct {
+						GeocoderMetaData struct {
+							Precision string `json:"precision"`
+							Kind      string `json:"kind"`
+							Text      string `json:"text"`
+						} `json:"GeocoderMetaData"`
+					} `json:"metaDataProperty"`
 					Point struct {
 						Pos string `json:"pos"`
 					} `json:"Point"`
@@ -24,34 +142,237 @@ type GeoResponse struct {
 	} `json:"response"`
 }
 
-func GetCoordinates(fullAddress string) (string, string, error) {
-	baseURL := "https://geocode-maps.yandex.ru/1.x/"
+func (y *Yandex) Geocode(ctx context.Context, address string) (Result, error) {
+	if strings.TrimSpace(address) == "" {
+		return Result{}, ErrNotFound
+	}
 	params := url.Values{}
-	params.Set("apikey", "e0b9b1d8-b8fa-4c07-ae3a-8b524663ebf5")
+	params.Set("apikey", y.APIKey)
 	params.Set("format", "json")
-	params.Set("geocode", fullAddress)
+	params.Set("lang", "ru_RU")
+	params.Set("results", "1")
+	params.Set("geocode", address)
 
-	resp, err := http.Get(baseURL + "?" + params.Encode())
-	if err != nil {
-		return "", "", err
+	var resp yandexResponse
+	if err := getJSON(ctx, y.HTTPClient, y.BaseURL+"?"+params.Encode(), nil, &resp); err != nil {
+		return Result{}, err
 	}
-	defer resp.Body.Close()
+	members := resp.Response.GeoObjectCollection.FeatureMember
+	if len(members) == 0 {
+		return Result{}, ErrNotFound
+	}
+
+	object := members[0].GeoObject
+	// pos — «долгота широта» через пробел
+	lonStr, latStr, ok := strings.Cut(object.Point.Pos, " ")
+	if !ok {
+		return Result{}, fmt.Errorf("invalid coordinates format %q", object.Point.Pos)
+	}
+	lat, latErr := strconv.ParseFloat(latStr, 64)
+	lon, lonErr := strconv.ParseFloat(lonStr, 64)
+	if err := errors.Join(latErr, lonErr); err != nil {
+		return Result{}, fmt.Errorf("invalid coordinates format %q", object.Point.Pos)
+	}
+
+	meta := object.MetaDataProperty.GeocoderMetaData
+	result := Result{
+		Lat:       lat,
+		Lon:       lon,
+		Precision: yandexPrecision(meta.Precision, meta.Kind),
+		Address:   meta.Text,
+		Provider:  y.Name(),
+	}
+	return result, result.validate()
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
+// yandexPrecision переводит precision и kind Яндекса в Precision
+func yandexPrecision(precision, kind string) Precision {
+	switch precision {
+	case "exact", "number":
+		return PrecisionExact
+	case "near", "range", "street":
+		return PrecisionStreet
+	}
+	switch kind {
+	case "locality", "district", "area", "province":
+		return PrecisionLocality
+	}
+	return PrecisionOther
+}
+
+// NominatimURL — публичный сервер Nominatim (не больше запроса в секунду, обязателен User-Agent)
+const NominatimURL = "https://nominatim.openstreetmap.org"
+
+// NominatimInterval — минимальный интервал между запросами к публичному серверу Nominatim
+const NominatimInterval = time.Second
+
+// Nominatim — геокодер OpenStreetMap или совместимый сервер (свой Nominatim, LocationIQ и т. п.)
+type Nominatim struct {
+	BaseURL string
+	// UserAgent и Email идентифицируют приложение по правилам использования Nominatim
+	UserAgent  string
+	Email      string
+	HTTPClient *http.Client
+	// Interval — не чаще одного запроса в Interval на все горутины, которые используют геокодер
+	Interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func NewNominatim(baseURL, email string, timeout time.Duration) *Nominatim {
+	return &Nominatim{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		UserAgent:  "qwerty.town-api",
+		Email:      email,
+		HTTPClient: &http.Client{Timeout: timeout},
+		Interval:   NominatimInterval,
+	}
+}
+
+func (n *Nominatim) Name() string { return "nominatim" }
+
+// wait занимает ближайшее свободное окно для запроса и ждёт его
+func (n *Nominatim) wait(ctx context.Context) error {
+	n.mu.Lock()
+	at := n.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	n.next = at.Add(n.Interval)
+	n.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type nominatimPlace struct {
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	PlaceRank   int    `json:"place_rank"`
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, address string) (Result, error) {
+	if strings.TrimSpace(address) == "" {
+		return Result{}, ErrNotFound
+	}
+	params := url.Values{}
+	params.Set("q", address)
+	params.Set("format", "jsonv2")
+	params.Set("limit", "1")
+	params.Set("accept-language", "ru")
+	if n.Email != "" {
+		params.Set("email", n.Email)
+	}
 
-	var geoResp GeoResponse
-	if err := json.Unmarshal(body, &geoResp); err != nil {
-		return "", "", err
+	if err := n.wait(ctx); err != nil {
+		return Result{}, err
 	}
 
-	if len(geoResp.Response.GeoObjectCollection.FeatureMember) == 0 {
-		return "", "", fmt.Errorf("coordinates not found")
+	var places []nominatimPlace
+	header := http.Header{"User-Agent": {n.UserAgent}}
+	if err := getJSON(ctx, n.HTTPClient, n.BaseURL+"/search?"+params.Encode(), header, &places); err != nil {
+		return Result{}, err
 	}
+	if len(places) == 0 {
+		return Result{}, ErrNotFound
+	}
+
+	place := places[0]
+	lat, latErr := strconv.ParseFloat(place.Lat, 64)
+	lon, lonErr := strconv.ParseFloat(place.Lon, 64)
+	if err := errors.Join(latErr, lonErr); err != nil {
+		return Result{}, fmt.Errorf("invalid coordinates %q, %q", place.Lat, place.Lon)
+	}
+	result := Result{
+		Lat:       lat,
+		Lon:       lon,
+		Precision: nominatimPrecision(place.PlaceRank),
+		Address:   place.DisplayName,
+		Provider:  n.Name(),
+	}
+	return result, result.validate()
+}
+
+// nominatimPrecision переводит place_rank (https://nominatim.org/release-docs/latest/customize/Ranking/)
+// в Precision: 30 — дом, 26–29 — улица, 13–25 — населённый пункт или район
+func nominatimPrecision(rank int) Precision {
+	switch {
+	case rank >= 30:
+		return PrecisionExact
+	case rank >= 26:
+		return PrecisionStreet
+	case rank >= 13:
+		return PrecisionLocality
+	}
+	return PrecisionOther
+}
+
+// Static отвечает по заранее известным адресам: тесты и локальная разработка без сети.
+// Адреса сравниваются без учёта регистра, лишних пробелов и пробелов вокруг запятых.
+type Static struct {
+	results map[string]Result
+}
+
+func NewStatic(results map[string]Result) *Static {
+	s := &Static{results: make(map[string]Result, len(results))}
+	for address, result := range results {
+		result.Provider = s.Name()
+		if result.Address == "" {
+			result.Address = address
+		}
+		if result.Precision == "" {
+			result.Precision = PrecisionExact
+		}
+		s.results[normalizeAddress(address)] = result
+	}
+	return s
+}
+
+// LoadStatic читает JSON-файл вида {"Казань, ул. Баумана, 1": {"lat": 55.79, "lon": 49.11}};
+// precision и address необязательны
+func LoadStatic(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results map[string]Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	for address, result := range results {
+		if err := result.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %q: %v", path, address, err)
+		}
+	}
+	return NewStatic(results), nil
+}
+
+func (s *Static) Name() string { return "static" }
+
+func (s *Static) Geocode(_ context.Context, address string) (Result, error) {
+	result, ok := s.results[normalizeAddress(address)]
+	if !ok {
+		return Result{}, ErrNotFound
+	}
+	return result, nil
+}
 
-	pos := geoResp.Response.GeoObjectCollection.FeatureMember[0].GeoObject.Point.Pos
-	parts := strings.Split(pos, " ")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid coordinates format")
+func normalizeAddress(address string) string {
+	parts := strings.Split(strings.ToLower(address), ",")
+	for i, part := range parts {
+		parts[i] = strings.Join(strings.Fields(part), " ")
 	}
-	return parts[1], parts[0], nil
+	return strings.Join(parts, ",")
 }
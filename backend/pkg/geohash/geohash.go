@@ -0,0 +1,108 @@
+package geohash
+
+import (
+	"math"
+	"strings"
+)
+
+// Геохеш (https://en.wikipedia.org/wiki/Geohash) — ячейка сетки широт и долгот в виде строки base32.
+// Точки одной ячейки имеют общий префикс, поэтому поиск по области сводится к поиску
+// по нескольким префиксам в обычном btree-индексе.
+
+// MaxPrecision — длина геохеша, который хранится у компании (ячейка меньше 4 × 2 см)
+const MaxPrecision = 12
+
+const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Encode возвращает геохеш точки длиной precision символов (1..MaxPrecision)
+func Encode(lat, lon float64, precision int) string {
+	precision = max(1, min(precision, MaxPrecision))
+	latLo, latHi := -90.0, 90.0
+	lonLo, lonHi := -180.0, 180.0
+
+	var sb strings.Builder
+	bit, ch, even := 0, 0, true
+	for sb.Len() < precision {
+		if even {
+			mid := (lonLo + lonHi) / 2
+			if lon >= mid {
+				ch = ch<<1 | 1
+				lonLo = mid
+			} else {
+				ch <<= 1
+				lonHi = mid
+			}
+		} else {
+			mid := (latLo + latHi) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				latLo = mid
+			} else {
+				ch <<= 1
+				latHi = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			sb.WriteByte(alphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// cellSize — размер ячейки длины precision в градусах
+func cellSize(precision int) (latDeg, lonDeg float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lonBits))
+}
+
+// span — номера ячеек от lo до hi включительно по одной оси сетки из n ячеек размером size
+type span struct{ from, to int }
+
+func axisSpan(lo, hi, origin, size float64, n int) span {
+	from := int(math.Floor((lo - origin) / size))
+	to := int(math.Floor((hi - origin) / size))
+	return span{max(0, min(from, n-1)), max(0, min(to, n-1))}
+}
+
+// Cover возвращает префиксы — ячейки самой мелкой сетки, которыми прямоугольник покрывается
+// не больше чем maxCells ячейками. West > East — прямоугольник пересекает 180-й меридиан.
+// nil — прямоугольник больше любой допустимой сетки, и отбирать по префиксам незачем.
+func Cover(south, west, north, east float64, maxCells int) []string {
+	for precision := MaxPrecision; precision >= 1; precision-- {
+		latDeg, lonDeg := cellSize(precision)
+		latN := int(math.Round(180 / latDeg))
+		lonN := int(math.Round(360 / lonDeg))
+
+		lats := axisSpan(south, north, -90, latDeg, latN)
+		lons := []span{axisSpan(west, east, -180, lonDeg, lonN)}
+		if west > east {
+			lons = []span{axisSpan(west, 180, -180, lonDeg, lonN), axisSpan(-180, east, -180, lonDeg, lonN)}
+		}
+
+		count := 0
+		for _, s := range lons {
+			count += (s.to - s.from + 1) * (lats.to - lats.from + 1)
+		}
+		if count > maxCells {
+			continue
+		}
+
+		cells := make([]string, 0, count)
+		for _, s := range lons {
+			for x := s.from; x <= s.to; x++ {
+				for y := lats.from; y <= lats.to; y++ {
+					// Центр ячейки однозначно кодируется её геохешем
+					lat := -90 + (float64(y)+0.5)*latDeg
+					lon := -180 + (float64(x)+0.5)*lonDeg
+					cells = append(cells, Encode(lat, lon, precision))
+				}
+			}
+		}
+		return cells
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrNoSigningKey = errors.New("keyring has no signing key")
+	ErrUnknownKey   = errors.New("token signed with unknown key")
+)
+
+// Key — один ключ в связке. У ключа только для проверки signKey == nil.
+type Key struct {
+	ID        string
+	Algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign сообщает, есть ли у ключа закрытая часть (или секрет для HS256)
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Keyring — набор ключей одной аудитории: один ключ подписи и
+// несколько ключей проверки, чтобы старые токены оставались валидными во время ротации.
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+// Parse разбирает описание связки ключей.
+// Ключи перечисляются через запятую или пробел в формате kid:ALG:источник, где источник —
+// file:/path (PEM или секрет), env:VAR (PEM или секрет) или secret:строка (только HS256).
+// Ключом подписи становится signingKid, а если он пуст — первый ключ, которым можно подписывать.
+func Parse(spec, signingKid string) (*Keyring, error) {
+	r := &Keyring{keys: make(map[string]*Key)}
+
+	entries := strings.FieldsFunc(spec, func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\n' || c == '\t'
+	})
+	for _, entry := range entries {
+		key, err := parseKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := r.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		r.keys[key.ID] = key
+		r.order = append(r.order, key.ID)
+	}
+
+	if signingKid != "" {
+		key, ok := r.keys[signingKid]
+		if !ok || !key.CanSign() {
+			return nil, fmt.Errorf("signing key %q not found or has no private part", signingKid)
+		}
+		r.signing = key
+	} else {
+		for _, kid := range r.order {
+			if r.keys[kid].CanSign() {
+				r.signing = r.keys[kid]
+				break
+			}
+		}
+	}
+
+	if r.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return r, nil
+}
+
+func parseKey(entry string) (*Key, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid key entry %q: expected kid:ALG:source", entry)
+	}
+	key := &Key{ID: parts[0], Algorithm: parts[1]}
+
+	material, err := loadMaterial(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %v", key.ID, err)
+	}
+
+	switch key.Algorithm {
+	case HS256:
+		if len(material) < 16 {
+			return nil, fmt.Errorf("key %q: HS256 secret must be at least 16 bytes", key.ID)
+		}
+		key.signKey, key.verifyKey = material, material
+	case RS256:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(material); err == nil {
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(material); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("key %q: invalid RSA PEM: %v", key.ID, err)
+		}
+	case EdDSA:
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(material); err == nil {
+			key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(material); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("key %q: invalid Ed25519 PEM: %v", key.ID, err)
+		}
+	default:
+		return nil, fmt.Errorf("key %q: unsupported algorithm %q", key.ID, key.Algorithm)
+	}
+	return key, nil
+}
+
+func loadMaterial(source string) ([]byte, error) {
+	kind, value, ok := strings.Cut(source, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid key source %q", source)
+	}
+
+	switch kind {
+	case "file":
+		return os.ReadFile(value)
+	case "env":
+		v := os.Getenv(value)
+		if v == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", value)
+		}
+		return []byte(v), nil
+	case "secret":
+		return []byte(value), nil
+	default:
+		return nil, fmt.Errorf("unknown key source %q", kind)
+	}
+}
+
+// SigningKey возвращает текущий ключ подписи
+func (r *Keyring) SigningKey() *Key {
+	return r.signing
+}
+
+// Sign подписывает claims текущим ключом и проставляет kid в заголовок
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(r.signing.Algorithm), claims)
+	token.Header["kid"] = r.signing.ID
+	return token.SignedString(r.signing.signKey)
+}
+
+// Keyfunc выбирает ключ проверки по kid; токены без kid (выпущенные до ротации)
+// проверяются текущим ключом подписи
+func (r *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := r.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = r.keys[kid]; !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), key.ID)
+	}
+	return key.verifyKey, nil
+}
+
+// Algorithms возвращает алгоритмы всех ключей связки для jwt.WithValidMethods
+func (r *Keyring) Algorithms() []string {
+	var algs []string
+	seen := make(map[string]bool)
+	for _, kid := range r.order {
+		alg := r.keys[kid].Algorithm
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWK — открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys возвращает открытые ключи связки. Секреты HS256 не публикуются.
+func (r *Keyring) PublicKeys() []JWK {
+	var jwks []JWK
+	for _, kid := range r.order {
+		key := r.keys[kid]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
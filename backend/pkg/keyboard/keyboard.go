@@ -0,0 +1,39 @@
+package keyboard
+
+import "unicode"
+
+// qwertyToJcuken — символы латинской раскладки QWERTY и буквы, стоящие на тех же клавишах в ЙЦУКЕН
+var qwertyToJcuken = map[rune]rune{
+	'q': 'й', 'w': 'ц', 'e': 'у', 'r': 'к', 't': 'е', 'y': 'н', 'u': 'г', 'i': 'ш', 'o': 'щ', 'p': 'з', '[': 'х', ']': 'ъ',
+	'a': 'ф', 's': 'ы', 'd': 'в', 'f': 'а', 'g': 'п', 'h': 'р', 'j': 'о', 'k': 'л', 'l': 'д', ';': 'ж', '\'': 'э',
+	'z': 'я', 'x': 'ч', 'c': 'с', 'v': 'м', 'b': 'и', 'n': 'т', 'm': 'ь', ',': 'б', '.': 'ю', '`': 'ё',
+	'Q': 'Й', 'W': 'Ц', 'E': 'У', 'R': 'К', 'T': 'Е', 'Y': 'Н', 'U': 'Г', 'I': 'Ш', 'O': 'Щ', 'P': 'З', '{': 'Х', '}': 'Ъ',
+	'A': 'Ф', 'S': 'Ы', 'D': 'В', 'F': 'А', 'G': 'П', 'H': 'Р', 'J': 'О', 'K': 'Л', 'L': 'Д', ':': 'Ж', '"': 'Э',
+	'Z': 'Я', 'X': 'Ч', 'C': 'С', 'V': 'М', 'B': 'И', 'N': 'Т', 'M': 'Ь', '<': 'Б', '>': 'Ю', '~': 'Ё',
+}
+
+// ToCyrillic переводит текст, набранный в латинской раскладке вместо русской ("rjatqyz" → "кофейня").
+// Текст без латинских букв или уже содержащий кириллицу не меняется, ok = false:
+// смешанный ввод — это скорее название вроде "Кофе Like", чем ошибка раскладки.
+func ToCyrillic(s string) (converted string, ok bool) {
+	hasLatin := false
+	for _, r := range s {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return s, false
+		}
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			hasLatin = true
+		}
+	}
+	if !hasLatin {
+		return s, false
+	}
+
+	out := []rune(s)
+	for i, r := range out {
+		if c, found := qwertyToJcuken[r]; found {
+			out[i] = c
+		}
+	}
+	return string(out), true
+}
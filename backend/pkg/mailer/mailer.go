@@ -0,0 +1,145 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoRecipient = errors.New("message has no recipient")
+
+// Message — письмо в виде обычного текста
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender отправляет письма. Реализации: SMTPSender для продакшена и
+// FileOutbox для тестов и локальной разработки.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Bytes возвращает письмо в формате RFC 5322 с заголовками From и Date
+func (m Message) Bytes(from string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+func (m Message) validate() error {
+	if m.To == "" {
+		return ErrNoRecipient
+	}
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return fmt.Errorf("header contains line break")
+	}
+	return nil
+}
+
+// SMTPSender отправляет письма через SMTP-сервер с PLAIN-аутентификацией
+// (net/smtp сам включает STARTTLS, если сервер его поддерживает)
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, msg.Bytes(s.From, time.Now())); err != nil {
+		return fmt.Errorf("smtp send to %s: %v", msg.To, err)
+	}
+	return nil
+}
+
+// FileOutbox складывает письма файлами .eml в каталог вместо отправки.
+// Отправленные письма можно прочитать через Messages, например в тестах.
+type FileOutbox struct {
+	Dir  string
+	From string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewFileOutbox(dir, from string) *FileOutbox {
+	return &FileOutbox{Dir: dir, From: from}
+}
+
+func (f *FileOutbox) Send(msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return fmt.Errorf("outbox: %v", err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%03d.eml", now.Format("20060102T150405.000000000"), len(f.sent))
+	if err := os.WriteFile(filepath.Join(f.Dir, name), msg.Bytes(f.From, now), 0o644); err != nil {
+		return fmt.Errorf("outbox: %v", err)
+	}
+
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// Messages возвращает письма, отправленные этим экземпляром, в порядке отправки
+func (f *FileOutbox) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
+
+// Last возвращает последнее письмо на адрес to
+func (f *FileOutbox) Last(to string) (Message, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.sent) - 1; i >= 0; i-- {
+		if f.sent[i].To == to {
+			return f.sent[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Files возвращает пути к файлам писем в каталоге, отсортированные по времени отправки
+func (f *FileOutbox) Files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(f.Dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,183 @@
+package mvt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Кодирование точечных слоёв в Mapbox Vector Tile 2.1
+// (https://github.com/mapbox/vector-tile-spec/tree/master/2.1) без сгенерированного кода protobuf.
+
+// Extent — размер тайла во внутренних координатах по умолчанию
+const Extent = 4096
+
+const (
+	geomTypePoint = 1
+	cmdMoveTo     = 1
+	layerVersion  = 2
+)
+
+// Номера полей сообщений vector_tile.proto
+const (
+	tileLayers = 3
+
+	layerName     = 1
+	layerFeatures = 2
+	layerKeys     = 3
+	layerValues   = 4
+	layerExtent   = 5
+	layerVersionF = 15
+
+	featureID       = 1
+	featureTags     = 2
+	featureType     = 3
+	featureGeometry = 4
+
+	valueString = 1
+	valueDouble = 3
+	valueInt    = 4
+	valueBool   = 7
+)
+
+// Feature — точка в координатах тайла (0..Extent, ось Y направлена вниз). Свойства — string,
+// int, int64, float64 или bool; пустые строки и nil не пишутся.
+type Feature struct {
+	ID         uint64
+	X, Y       int
+	Properties map[string]interface{}
+}
+
+// Layer — именованный слой точек
+type Layer struct {
+	Name     string
+	Features []Feature
+}
+
+// Encode кодирует слои в тайл. Слои без точек пропускаются; nil — в тайле нечего показывать.
+func Encode(layers ...Layer) ([]byte, error) {
+	var tile []byte
+	for _, layer := range layers {
+		if len(layer.Features) == 0 {
+			continue
+		}
+		b, err := encodeLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+		tile = protowire.AppendTag(tile, tileLayers, protowire.BytesType)
+		tile = protowire.AppendBytes(tile, b)
+	}
+	return tile, nil
+}
+
+func encodeLayer(layer Layer) ([]byte, error) {
+	var keys []string
+	keyIndex := make(map[string]uint64)
+	var values [][]byte
+	valueIndex := make(map[string]uint64)
+
+	var b []byte
+	b = protowire.AppendTag(b, layerVersionF, protowire.VarintType)
+	b = protowire.AppendVarint(b, layerVersion)
+	b = protowire.AppendTag(b, layerName, protowire.BytesType)
+	b = protowire.AppendString(b, layer.Name)
+
+	for _, f := range layer.Features {
+		// Ключи по порядку, чтобы одинаковые данные давали одинаковые байты (и ETag)
+		names := make([]string, 0, len(f.Properties))
+		for key := range f.Properties {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+
+		var tags []byte
+		for _, key := range names {
+			encoded, err := encodeValue(f.Properties[key])
+			if err != nil {
+				return nil, fmt.Errorf("property %s of feature %d: %v", key, f.ID, err)
+			}
+			if encoded == nil {
+				continue
+			}
+			ki, ok := keyIndex[key]
+			if !ok {
+				ki = uint64(len(keys))
+				keyIndex[key] = ki
+				keys = append(keys, key)
+			}
+			vi, ok := valueIndex[string(encoded)]
+			if !ok {
+				vi = uint64(len(values))
+				valueIndex[string(encoded)] = vi
+				values = append(values, encoded)
+			}
+			tags = protowire.AppendVarint(tags, ki)
+			tags = protowire.AppendVarint(tags, vi)
+		}
+
+		var geometry []byte
+		geometry = protowire.AppendVarint(geometry, cmdMoveTo|1<<3)
+		geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(int64(f.X)))
+		geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(int64(f.Y)))
+
+		var feature []byte
+		feature = protowire.AppendTag(feature, featureID, protowire.VarintType)
+		feature = protowire.AppendVarint(feature, f.ID)
+		if len(tags) > 0 {
+			feature = protowire.AppendTag(feature, featureTags, protowire.BytesType)
+			feature = protowire.AppendBytes(feature, tags)
+		}
+		feature = protowire.AppendTag(feature, featureType, protowire.VarintType)
+		feature = protowire.AppendVarint(feature, geomTypePoint)
+		feature = protowire.AppendTag(feature, featureGeometry, protowire.BytesType)
+		feature = protowire.AppendBytes(feature, geometry)
+
+		b = protowire.AppendTag(b, layerFeatures, protowire.BytesType)
+		b = protowire.AppendBytes(b, feature)
+	}
+
+	for _, key := range keys {
+		b = protowire.AppendTag(b, layerKeys, protowire.BytesType)
+		b = protowire.AppendString(b, key)
+	}
+	for _, value := range values {
+		b = protowire.AppendTag(b, layerValues, protowire.BytesType)
+		b = protowire.AppendBytes(b, value)
+	}
+	b = protowire.AppendTag(b, layerExtent, protowire.VarintType)
+	b = protowire.AppendVarint(b, Extent)
+	return b, nil
+}
+
+// encodeValue кодирует сообщение Value; nil — пустое значение, свойство не пишется
+func encodeValue(v interface{}) ([]byte, error) {
+	var b []byte
+	switch value := v.(type) {
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		b = protowire.AppendTag(b, valueString, protowire.BytesType)
+		b = protowire.AppendString(b, value)
+	case int:
+		b = protowire.AppendTag(b, valueInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(value)))
+	case int64:
+		b = protowire.AppendTag(b, valueInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(value))
+	case float64:
+		b = protowire.AppendTag(b, valueDouble, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(value))
+	case bool:
+		b = protowire.AppendTag(b, valueBool, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(value))
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+	return b, nil
+}
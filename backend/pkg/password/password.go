@@ -0,0 +1,169 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hashing algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+// Params описывает алгоритм и стоимость хеширования, действующие на этой установке
+type Params struct {
+	Algorithm   string
+	Memory      uint32 // KiB, argon2id
+	Iterations  uint32 // argon2id
+	Parallelism uint8  // argon2id
+	SaltLength  uint32
+	KeyLength   uint32
+	BcryptCost  int
+}
+
+// DefaultParams возвращает параметры по умолчанию (рекомендации OWASP для argon2id)
+func DefaultParams() Params {
+	return Params{
+		Algorithm:   Argon2id,
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+		BcryptCost:  12,
+	}
+}
+
+// Hash хеширует пароль; параметры сохраняются вместе с хешем
+func Hash(plain string, p Params) (string, error) {
+	switch p.Algorithm {
+	case Argon2id:
+		salt := make([]byte, p.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("error generating salt: %v", err)
+		}
+		key := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(plain), p.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	default:
+		return "", ErrUnknownAlgorithm
+	}
+}
+
+// IsHashed сообщает, похоже ли сохранённое значение на хеш, а не на пароль в открытом виде
+func IsHashed(stored string) bool {
+	return algorithmOf(stored) != ""
+}
+
+// Verify сравнивает пароль с сохранённым хешем за постоянное время
+func Verify(plain, stored string) (bool, error) {
+	switch algorithmOf(stored) {
+	case Argon2id:
+		p, salt, key, err := decodeArgon2id(stored)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return false, ErrMalformedHash
+	}
+}
+
+// VerifyLegacy сравнивает пароль со строкой, хранившейся в открытом виде (до миграции)
+func VerifyLegacy(plain, stored string) bool {
+	return subtle.ConstantTimeCompare([]byte(plain), []byte(stored)) == 1
+}
+
+// NeedsRehash сообщает, что хеш создан другим алгоритмом или с более слабыми параметрами
+func NeedsRehash(stored string, p Params) bool {
+	algorithm := algorithmOf(stored)
+	if algorithm != p.Algorithm {
+		return true
+	}
+
+	switch algorithm {
+	case Argon2id:
+		current, _, key, err := decodeArgon2id(stored)
+		if err != nil {
+			return true
+		}
+		return current.Memory < p.Memory ||
+			current.Iterations < p.Iterations ||
+			current.Parallelism < p.Parallelism ||
+			uint32(len(key)) < p.KeyLength
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(stored))
+		return err != nil || cost < p.BcryptCost
+	}
+	return true
+}
+
+func algorithmOf(stored string) string {
+	switch {
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		return Bcrypt
+	default:
+		return ""
+	}
+}
+
+// decodeArgon2id разбирает строку вида $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func decodeArgon2id(stored string) (Params, []byte, []byte, error) {
+	var p Params
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	p.Algorithm = Argon2id
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrMalformedHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -7,10 +7,181 @@ import (
 
 func init() {
 
-    beego.GlobalControllerRouter["api/controllers:CompanyController"] = append(beego.GlobalControllerRouter["api/controllers:CompanyController"],
+    beego.GlobalControllerRouter["api/controllers:AccountController"] = append(beego.GlobalControllerRouter["api/controllers:AccountController"],
         beego.ControllerComments{
-            Method: "Post",
-            Router: `/`,
+            Method: "RequestErasure",
+            Router: `/erasure`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AccountController"] = append(beego.GlobalControllerRouter["api/controllers:AccountController"],
+        beego.ControllerComments{
+            Method: "CancelErasure",
+            Router: `/erasure`,
+            AllowHTTPMethods: []string{"delete"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AccountController"] = append(beego.GlobalControllerRouter["api/controllers:AccountController"],
+        beego.ControllerComments{
+            Method: "Export",
+            Router: `/export`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AccountController"] = append(beego.GlobalControllerRouter["api/controllers:AccountController"],
+        beego.ControllerComments{
+            Method: "Link",
+            Router: `/link`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AccountController"] = append(beego.GlobalControllerRouter["api/controllers:AccountController"],
+        beego.ControllerComments{
+            Method: "Login",
+            Router: `/login`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AccountController"] = append(beego.GlobalControllerRouter["api/controllers:AccountController"],
+        beego.ControllerComments{
+            Method: "Me",
+            Router: `/me`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "ListAudit",
+            Router: `/audit`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "ListCompanies",
+            Router: `/companies`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "BlockCompany",
+            Router: `/companies/:id/block`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "RetryGeocode",
+            Router: `/companies/:id/geocode/retry`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "UnblockCompany",
+            Router: `/companies/:id/unblock`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "ListGeocodeJobs",
+            Router: `/geocode/jobs`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "RetryFailedGeocodes",
+            Router: `/geocode/jobs/retry`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "ListOwners",
+            Router: `/owners`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "BlockOwner",
+            Router: `/owners/:id/block`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "ResetOwnerMFA",
+            Router: `/owners/:id/mfa/reset`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "UnblockOwner",
+            Router: `/owners/:id/unblock`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "ListUsers",
+            Router: `/users`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "BlockUser",
+            Router: `/users/:id/block`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:AdminController"] = append(beego.GlobalControllerRouter["api/controllers:AdminController"],
+        beego.ControllerComments{
+            Method: "UnblockUser",
+            Router: `/users/:id/unblock`,
             AllowHTTPMethods: []string{"post"},
             MethodParams: param.Make(),
             Filters: nil,
@@ -18,16 +189,16 @@ func init() {
 
     beego.GlobalControllerRouter["api/controllers:CompanyController"] = append(beego.GlobalControllerRouter["api/controllers:CompanyController"],
         beego.ControllerComments{
-            Method: "GetAll",
+            Method: "Post",
             Router: `/`,
-            AllowHTTPMethods: []string{"get"},
+            AllowHTTPMethods: []string{"post"},
             MethodParams: param.Make(),
             Filters: nil,
             Params: nil})
 
     beego.GlobalControllerRouter["api/controllers:CompanyController"] = append(beego.GlobalControllerRouter["api/controllers:CompanyController"],
         beego.ControllerComments{
-            Method: "GetOwnerCompanies",
+            Method: "GetAll",
             Router: `/`,
             AllowHTTPMethods: []string{"get"},
             MethodParams: param.Make(),
@@ -79,6 +250,24 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
+        beego.ControllerComments{
+            Method: "InBBox",
+            Router: `/geo/bbox`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
+        beego.ControllerComments{
+            Method: "Clusters",
+            Router: `/geo/clusters`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
         beego.ControllerComments{
             Method: "GetAllCompaniesCoordinates",
@@ -88,6 +277,24 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
+        beego.ControllerComments{
+            Method: "CompaniesGeoJSON",
+            Router: `/geo/companies.geojson`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
+        beego.ControllerComments{
+            Method: "CompaniesKML",
+            Router: `/geo/companies.kml`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
         beego.ControllerComments{
             Method: "GetCoordinatesByCompanyId",
@@ -97,6 +304,33 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
+        beego.ControllerComments{
+            Method: "Nearest",
+            Router: `/geo/nearest`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:GeoController"] = append(beego.GlobalControllerRouter["api/controllers:GeoController"],
+        beego.ControllerComments{
+            Method: "WithinRadius",
+            Router: `/geo/radius`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:JWKSController"] = append(beego.GlobalControllerRouter["api/controllers:JWKSController"],
+        beego.ControllerComments{
+            Method: "Get",
+            Router: `/.well-known/jwks.json`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
         beego.ControllerComments{
             Method: "Post",
@@ -142,6 +376,42 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "CreateAPIKey",
+            Router: `/api-keys`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "ListAPIKeys",
+            Router: `/api-keys`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "RevokeAPIKey",
+            Router: `/api-keys/:id`,
+            AllowHTTPMethods: []string{"delete"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "ForgotPassword",
+            Router: `/forgot-password`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
         beego.ControllerComments{
             Method: "Login",
@@ -151,6 +421,24 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "LoginMFA",
+            Router: `/login/mfa`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "RefreshToken",
+            Router: `/login/refresh`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
         beego.ControllerComments{
             Method: "Logout",
@@ -160,6 +448,105 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "ConfirmMFA",
+            Router: `/mfa/confirm`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "DisableMFA",
+            Router: `/mfa/disable`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "EnrollMFA",
+            Router: `/mfa/enroll`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "ResetPassword",
+            Router: `/reset-password`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "ListSessions",
+            Router: `/sessions`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "RevokeSession",
+            Router: `/sessions/:id`,
+            AllowHTTPMethods: []string{"delete"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "RevokeOtherSessions",
+            Router: `/sessions/revoke-others`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "VerifyEmail",
+            Router: `/verify-email`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:OwnerController"] = append(beego.GlobalControllerRouter["api/controllers:OwnerController"],
+        beego.ControllerComments{
+            Method: "ResendVerification",
+            Router: `/verify-email/resend`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:SearchController"] = append(beego.GlobalControllerRouter["api/controllers:SearchController"],
+        beego.ControllerComments{
+            Method: "Companies",
+            Router: `/companies`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:SearchController"] = append(beego.GlobalControllerRouter["api/controllers:SearchController"],
+        beego.ControllerComments{
+            Method: "Suggest",
+            Router: `/suggest`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
         beego.ControllerComments{
             Method: "Post",
@@ -205,6 +592,15 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "ForgotPassword",
+            Router: `/forgot-password`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
         beego.ControllerComments{
             Method: "Login",
@@ -214,6 +610,15 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "RefreshToken",
+            Router: `/login/refresh`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
         beego.ControllerComments{
             Method: "Logout",
@@ -223,6 +628,87 @@ func init() {
             Filters: nil,
             Params: nil})
 
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "OIDCCallback",
+            Router: `/oidc/:provider/callback`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "OIDCLogin",
+            Router: `/oidc/:provider/login`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "OIDCProviders",
+            Router: `/oidc/providers`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "ResetPassword",
+            Router: `/reset-password`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "ListSessions",
+            Router: `/sessions`,
+            AllowHTTPMethods: []string{"get"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "RevokeSession",
+            Router: `/sessions/:id`,
+            AllowHTTPMethods: []string{"delete"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "RevokeOtherSessions",
+            Router: `/sessions/revoke-others`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "VerifyEmail",
+            Router: `/verify-email`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
+    beego.GlobalControllerRouter["api/controllers:UserController"] = append(beego.GlobalControllerRouter["api/controllers:UserController"],
+        beego.ControllerComments{
+            Method: "ResendVerification",
+            Router: `/verify-email/resend`,
+            AllowHTTPMethods: []string{"post"},
+            MethodParams: param.Make(),
+            Filters: nil,
+            Params: nil})
+
     beego.GlobalControllerRouter["api/controllers:WebSocketController"] = append(beego.GlobalControllerRouter["api/controllers:WebSocketController"],
         beego.ControllerComments{
             Method: "Get",
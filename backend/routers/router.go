@@ -13,7 +13,11 @@ import (
 )
 
 func init() {
+	beego.InsertFilter("*", beego.BeforeRouter, controllers.RequestIDFilter)
+	beego.InsertFilter("/v1/*", beego.BeforeExec, controllers.AuthFilter)
 	beego.Router("/ws", &controllers.WebSocketController{}, "get:Get")
+	beego.Router("/.well-known/jwks.json", &controllers.JWKSController{}, "get:Get")
+	beego.Router("/tiles/:z/:x/:y.mvt", &controllers.TileController{}, "get:Get")
 	ns := beego.NewNamespace("/v1",
 		beego.NSNamespace("/visitor/user",
 			beego.NSInclude(&controllers.UserController{}),
@@ -27,6 +31,15 @@ func init() {
 		beego.NSNamespace("/geocoder/cords",
 			beego.NSInclude(&controllers.GeoController{}),
 		),
+		beego.NSNamespace("/search",
+			beego.NSInclude(&controllers.SearchController{}),
+		),
+		beego.NSNamespace("/account",
+			beego.NSInclude(&controllers.AccountController{}),
+		),
+		beego.NSNamespace("/admin",
+			beego.NSInclude(&controllers.AdminController{}),
+		),
 	)
 
 	beego.AddNamespace(ns)
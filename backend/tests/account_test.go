@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"api/models"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// profileQuery отдаёт строку в зависимости от поля первого фильтра:
+// так один мок различает поиск по account_id и по логину
+type profileQuery struct {
+	*mock.DoNothingQuerySetter
+	rows  map[string]interface{}
+	field string
+}
+
+func (q profileQuery) Filter(field string, _ ...interface{}) orm.QuerySeter {
+	if q.field == "" {
+		q.field = field
+	}
+	return q
+}
+
+func (q profileQuery) One(container interface{}, _ ...string) error {
+	row, ok := q.rows[q.field]
+	if !ok {
+		return orm.ErrNoRows
+	}
+	switch c := container.(type) {
+	case *models.User:
+		*c = row.(models.User)
+	case *models.Owner:
+		*c = row.(models.Owner)
+	}
+	return nil
+}
+
+func (q profileQuery) Update(orm.Params) (int64, error) { return 1, nil }
+
+func TestAccountLoginCarriesBothProfiles(t *testing.T) {
+	hash, err := models.HashPassword("correct-password")
+	assert.Nil(t, err)
+	user := models.User{Id: 61, Username: "anna", Email: "anna@example.com", Password: hash, EmailVerified: true, AccountId: 3}
+	owner := models.Owner{Id: 12, Email: "anna@example.com", Password: hash, EmailVerified: true, AccountId: 3}
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"username": user, "account_id": user}, ""}))
+	stub.Mock(mockQueryTable("owner", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"account_id": owner}, ""}))
+	stub.Mock(mock.MockRead("owner_mfa", nil, orm.ErrNoRows))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+
+	w := postJSON("/v1/account/login", `{"login":"anna","password":"wrong-password"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON("/v1/account/login", `{"login":"anna","password":"correct-password"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data models.TokenPair `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	token := resp.Data.AccessToken
+
+	principal, err := models.Authenticate(token)
+	assert.Nil(t, err)
+	assert.Equal(t, models.RoleVisitor, principal.Role)
+	assert.Equal(t, int64(3), principal.AccountID)
+	assert.Equal(t, int64(12), principal.Profiles[models.RoleOwner].ID)
+	assert.True(t, principal.HasRole(models.RoleOwner))
+
+	w = serveAdmin("GET", "/v1/account/me", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var me struct {
+		Data models.AccountInfo `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &me))
+	assert.Equal(t, models.ProfileClaim{ID: 12, EmailVerified: true}, me.Data.Profiles[models.RoleOwner])
+	assert.Equal(t, models.ProfileClaim{ID: 61, EmailVerified: true}, me.Data.Profiles[models.RoleVisitor])
+
+	// Тот же токен открывает действия владельца от имени профиля владельца
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		data.(*models.Company).Owner = &models.Owner{Id: 12}
+	}, nil))
+	stub.Mock(mock.MockDeleteWithCtx("company", 1, nil))
+	w = serveCompanyRoute(companyRoute{"DELETE", "/v1/owner/company/1", ""}, token)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Сессия входа видна и из профиля владельца
+	w = serveAdmin("GET", "/v1/owner/user/sessions", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions struct {
+		Data []models.SessionInfo `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	assert.Len(t, sessions.Data, 1)
+	assert.True(t, sessions.Data[0].Current)
+}
+
+func TestVisitorTokenDoesNotBypassOwnerMFA(t *testing.T) {
+	user := models.User{Id: 61, Username: "anna", EmailVerified: true, AccountId: 3}
+	owner := models.Owner{Id: 12, Email: "anna@example.com", EmailVerified: true, AccountId: 3}
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"account_id": user}, ""}))
+	stub.Mock(mockQueryTable("owner", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"account_id": owner}, ""}))
+	stub.Mock(mock.MockRead("owner_mfa", func(data interface{}) {
+		data.(*models.OwnerMFA).Enabled = true
+	}, nil))
+
+	// Так выдаются токены входа посетителя, OIDC и обновления токенов
+	token, err := models.CreateToken(user, "")
+	assert.Nil(t, err)
+	principal, err := models.Authenticate(token)
+	assert.Nil(t, err)
+	assert.True(t, principal.Profiles[models.RoleOwner].MFARequired)
+	assert.False(t, principal.HasRole(models.RoleOwner), "owner roles need the second factor")
+	_, ok := principal.As(models.RoleOwner)
+	assert.False(t, ok)
+
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		data.(*models.Company).Owner = &models.Owner{Id: 12}
+	}, nil))
+	w := serveCompanyRoute(companyRoute{"DELETE", "/v1/owner/company/1", ""}, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serveCompanyRoute(companyRoute{"POST", "/v1/owner/user/mfa/disable", `{"code":"123456"}`}, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Токен владельца после 2FA открывает только профиль владельца: пароль посетителя не проверялся
+	ownerTok, err := models.CreateOwnerToken(owner, "")
+	assert.Nil(t, err)
+	principal, err = models.Authenticate(ownerTok)
+	assert.Nil(t, err)
+	_, ok = principal.As(models.RoleOwner)
+	assert.True(t, ok)
+	assert.True(t, principal.Profiles[models.RoleVisitor].PasswordRequired)
+	_, ok = principal.As(models.RoleVisitor)
+	assert.False(t, ok)
+}
+
+// accountLogin выполняет единый вход и возвращает субъекта выданного токена
+func accountLogin(t *testing.T, body string) (string, *models.Principal) {
+	w := postJSON("/v1/account/login", body)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data models.TokenPair `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	principal, err := models.Authenticate(resp.Data.AccessToken)
+	assert.Nil(t, err)
+	return resp.Data.AccessToken, principal
+}
+
+func TestAccountLoginOpensOnlyProfilesWhosePasswordMatched(t *testing.T) {
+	visitorHash, err := models.HashPassword("visitor-password")
+	assert.Nil(t, err)
+	ownerHash, err := models.HashPassword("owner-password")
+	assert.Nil(t, err)
+	user := models.User{Id: 63, Username: "boris", Email: "boris@example.com", Password: visitorHash, AccountId: 4}
+	owner := models.Owner{Id: 14, Email: "boris@example.com", Password: ownerHash, AccountId: 4}
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"username": user, "account_id": user}, ""}))
+	stub.Mock(mockQueryTable("owner", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"account_id": owner}, ""}))
+	stub.Mock(mock.MockRead("owner_mfa", nil, orm.ErrNoRows))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+
+	// Пароль посетителя не открывает профиль владельца
+	token, principal := accountLogin(t, `{"login":"boris","password":"visitor-password"}`)
+	assert.Equal(t, models.RoleVisitor, principal.Role)
+	assert.True(t, principal.Profiles[models.RoleOwner].PasswordRequired)
+	assert.False(t, principal.HasRole(models.RoleOwner))
+	_, ok := principal.As(models.RoleOwner)
+	assert.False(t, ok)
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		data.(*models.Company).Owner = &models.Owner{Id: 14}
+	}, nil))
+	assert.Equal(t, http.StatusUnauthorized, serveCompanyRoute(companyRoute{"DELETE", "/v1/owner/company/1", ""}, token).Code)
+
+	// Пароль владельца выдаёт токен владельца, профиль посетителя остаётся закрытым
+	_, principal = accountLogin(t, `{"login":"boris","password":"owner-password"}`)
+	assert.Equal(t, models.RoleOwner, principal.Role)
+	assert.Equal(t, int64(14), principal.ID)
+	assert.True(t, principal.Profiles[models.RoleVisitor].PasswordRequired)
+	_, ok = principal.As(models.RoleVisitor)
+	assert.False(t, ok)
+}
+
+func TestRevokedOwnerProfileIsClosedInVisitorToken(t *testing.T) {
+	hash, err := models.HashPassword("correct-password")
+	assert.Nil(t, err)
+	user := models.User{Id: 64, Username: "vera", Email: "vera@example.com", Password: hash, AccountId: 5}
+	owner := models.Owner{Id: 15, Email: "vera@example.com", Password: hash, AccountId: 5}
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"username": user, "account_id": user}, ""}))
+	stub.Mock(mockQueryTable("owner", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"account_id": owner}, ""}))
+	stub.Mock(mock.MockRead("owner_mfa", nil, orm.ErrNoRows))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+
+	token, principal := accountLogin(t, `{"login":"vera","password":"correct-password"}`)
+	_, ok := principal.As(models.RoleOwner)
+	assert.True(t, ok)
+
+	// Блокировка и сброс пароля владельца отзывают его сессии (iat хранится с точностью до секунды)
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	assert.Nil(t, models.RevokeAllSessions(models.RoleOwner, 15))
+
+	_, err = models.Authenticate(token)
+	assert.Equal(t, models.ErrTokenRevoked, err, "the visitor token still carries the owner roles")
+
+	// Новый токен той же сессии посетителя (обновление) владельца уже не открывает
+	refreshed, err := models.CreateToken(user, principal.SessionID)
+	assert.Nil(t, err)
+	principal, err = models.Authenticate(refreshed)
+	assert.Nil(t, err)
+	assert.True(t, principal.Profiles[models.RoleOwner].PasswordRequired)
+	assert.False(t, principal.HasRole(models.RoleOwner))
+}
+
+func TestLinkOwnerProfileToAccount(t *testing.T) {
+	hash, err := models.HashPassword("owner-password")
+	assert.Nil(t, err)
+	user := models.User{Id: 62, Username: "anna", AccountId: 3}
+	owner := models.Owner{Id: 12, Email: "shop@example.com", Password: hash, AccountId: 8}
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"account_id": user}, ""}))
+	stub.Mock(mockQueryTable("owner", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{"contact_email": owner}, ""}))
+	stub.Mock(mockQueryTable("account", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockDeleteWithCtx("account", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	token, _ := models.CreateToken(user, "")
+	assert.Equal(t, http.StatusUnauthorized, postJSON("/v1/account/link", `{}`).Code)
+
+	w := serveCompanyRoute(companyRoute{"POST", "/v1/account/link", `{"login":"shop@example.com","password":"nope"}`}, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serveCompanyRoute(companyRoute{"POST", "/v1/account/link", `{"login":"shop@example.com","password":"owner-password"}`}, token)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Профиль без аккаунта присоединять некуда
+	loose, _ := models.CreateToken(models.User{Id: 40, Username: "solo"}, "")
+	w = serveCompanyRoute(companyRoute{"POST", "/v1/account/link", `{"login":"shop@example.com","password":"owner-password"}`}, loose)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"api/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+// accountRoles подставляет дополнительные роли из account_role
+type accountRoles struct {
+	*mock.DoNothingRawSetter
+	roles []string
+}
+
+func (r accountRoles) ValuesFlat(container *orm.ParamsList, cols ...string) (int64, error) {
+	for _, role := range r.roles {
+		*container = append(*container, role)
+	}
+	return int64(len(r.roles)), nil
+}
+
+// updatedRows имитирует UPDATE, затронувший rows строк
+type updatedRows struct {
+	*mock.DoNothingQuerySetter
+	rows int64
+}
+
+func (q updatedRows) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q updatedRows) Update(orm.Params) (int64, error)             { return q.rows, nil }
+
+// queryTableCondition совпадает с o.QueryTable("<table>"): для имени таблицы строкой
+// orm не заполняет модель, и mock.MockQueryTableWithCtx его не распознаёт
+type queryTableCondition string
+
+func (c queryTableCondition) Match(_ context.Context, inv *orm.Invocation) bool {
+	return inv.Method == "QueryTable" && len(inv.Args) == 1 && inv.Args[0] == string(c)
+}
+
+func mockQueryTable(table string, qs orm.QuerySeter) *mock.Mock {
+	return mock.NewMock(queryTableCondition(table), []interface{}{qs}, nil)
+}
+
+func visitorTokenWithRoles(id int64, roles ...string) string {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRawWithCtx(accountRoles{&mock.DoNothingRawSetter{}, roles}))
+
+	token, _ := models.CreateToken(models.User{Id: id, Username: "staff"}, "")
+	return token
+}
+
+func serveAdmin(method, path, token string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, path, http.NoBody)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminRoutesRequirePermissions(t *testing.T) {
+	visitor := visitorTokenWithRoles(1)
+	owner := ownerToken(1)
+
+	paths := []string{"/v1/admin/users", "/v1/admin/owners", "/v1/admin/companies"}
+	for _, path := range paths {
+		assert.Equal(t, http.StatusUnauthorized, serveAdmin("GET", path, "").Code, path)
+
+		for _, token := range []string{visitor, owner} {
+			w := serveAdmin("GET", path, token)
+			assert.Equal(t, http.StatusForbidden, w.Code, path)
+			assert.Contains(t, w.Header().Get("Content-Type"), "application/problem+json")
+		}
+	}
+}
+
+func TestAdminBlocksAccounts(t *testing.T) {
+	admin := visitorTokenWithRoles(1, models.RoleAdmin)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("owner", updatedRows{&mock.DoNothingQuerySetter{}, 0}))
+	stub.Mock(mockQueryTable("company", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 0}))
+
+	assert.Equal(t, http.StatusOK, serveAdmin("GET", "/v1/admin/users", admin).Code)
+	assert.Equal(t, http.StatusOK, serveAdmin("POST", "/v1/admin/users/5/block", admin).Code)
+	assert.Equal(t, http.StatusOK, serveAdmin("POST", "/v1/admin/users/5/unblock", admin).Code)
+	assert.Equal(t, http.StatusOK, serveAdmin("POST", "/v1/admin/companies/5/block", admin).Code)
+	assert.Equal(t, http.StatusNotFound, serveAdmin("POST", "/v1/admin/owners/404/block", admin).Code)
+	assert.Equal(t, http.StatusBadRequest, serveAdmin("POST", "/v1/admin/users/abc/block", admin).Code)
+}
+
+func TestModeratorCannotBlockOwners(t *testing.T) {
+	moderator := visitorTokenWithRoles(2, models.RoleModerator)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("company", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("owner", recordedTable{&mock.DoNothingQuerySetter{}, "owner", []models.Owner{}, new([]string)}))
+
+	assert.Equal(t, http.StatusOK, serveAdmin("POST", "/v1/admin/companies/5/block", moderator).Code)
+	assert.Equal(t, http.StatusForbidden, serveAdmin("POST", "/v1/admin/owners/5/block", moderator).Code)
+	assert.Equal(t, http.StatusOK, serveAdmin("GET", "/v1/admin/owners", moderator).Code, "owners:read is enough to list owners")
+}
+
+func TestPrincipalPermissions(t *testing.T) {
+	visitor := &models.Principal{Role: models.RoleVisitor, Roles: []string{models.RoleVisitor}}
+	owner := &models.Principal{Role: models.RoleOwner, Roles: []string{models.RoleOwner}}
+	admin := &models.Principal{Role: models.RoleVisitor, Roles: []string{models.RoleVisitor, models.RoleAdmin}}
+
+	assert.False(t, visitor.Can(models.PermUsersRead), "account lists are for moderators and admins")
+	assert.True(t, admin.Can(models.PermUsersRead))
+	assert.False(t, visitor.Can(models.PermUsersManage))
+	assert.True(t, owner.Can(models.PermCompaniesWrite))
+	assert.False(t, owner.Can(models.PermCompaniesManage))
+	assert.True(t, admin.Can(models.PermOwnersManage))
+	assert.True(t, admin.HasRole(models.RoleAdmin))
+}
+
+func TestAccountListsHidePasswords(t *testing.T) {
+	visitor := visitorTokenWithRoles(1)
+	moderator := visitorTokenWithRoles(2, models.RoleModerator)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", recordedTable{&mock.DoNothingQuerySetter{}, "user",
+		[]models.User{{Id: 3, Username: "anna", Password: "$argon2id$secret"}}, new([]string)}))
+
+	assert.Equal(t, http.StatusForbidden, serveAdmin("GET", "/v1/visitor/user", visitor).Code)
+	assert.Equal(t, http.StatusForbidden, serveAdmin("GET", "/v1/owner/user", visitor).Code)
+
+	w := serveAdmin("GET", "/v1/visitor/user", moderator)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "argon2id")
+	var res struct {
+		Data []models.AccountSummary `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, []models.AccountSummary{{Id: 3, Name: "anna"}}, res.Data)
+}
+
+func TestAccountUpdateRequiresSubjectOrManager(t *testing.T) {
+	visitor := visitorTokenWithRoles(5)
+	admin := visitorTokenWithRoles(1, models.RoleAdmin)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("user", nil, nil))
+	stub.Mock(mock.MockUpdateWithCtx("user", 1, nil))
+	stub.Mock(mock.MockRead("owner", nil, nil))
+	stub.Mock(mock.MockUpdateWithCtx("owner", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 0}))
+
+	body := `{"Id": 6, "Username": "mallory", "Password": "new-password"}`
+	assert.Equal(t, http.StatusUnauthorized, serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", body}, "").Code)
+	assert.Equal(t, http.StatusForbidden, serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", body}, visitor).Code)
+	assert.Equal(t, http.StatusForbidden, serveCompanyRoute(companyRoute{"PUT", "/v1/owner/user", `{"Id": 6}`}, ownerToken(5)).Code)
+	assert.Equal(t, http.StatusForbidden, serveCompanyRoute(companyRoute{"PUT", "/v1/owner/user", `{"Id": 5}`}, visitor).Code,
+		"a visitor token is not an owner profile with the same id")
+
+	// Свой профиль: id берётся из токена, хеш пароля в ответ не попадает
+	w := serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", `{"Username": "anna", "Password": "new-password"}`}, visitor)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res struct {
+		Err  bool                  `json:"err"`
+		Data models.AccountSummary `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.False(t, res.Err)
+	assert.Equal(t, models.AccountSummary{Id: 5, Name: "anna"}, res.Data)
+	assert.NotContains(t, w.Body.String(), "Password")
+
+	w = serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", body}, admin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, int64(6), res.Data.Id)
+}
+
+func TestAccountUpdateChangesPasswordOnlyWhenGiven(t *testing.T) {
+	for _, id := range []string{"laptop", "phone"} {
+		assert.Nil(t, models.Sessions.Create(models.AccountSession{Id: id, SubjectType: models.RoleVisitor, SubjectId: 41}))
+	}
+	laptop, _ := models.CreateToken(models.User{Id: 41, Username: "anna"}, "laptop")
+	phone, _ := models.CreateToken(models.User{Id: 41, Username: "anna"}, "phone")
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("user", nil, nil))
+	var columns [][]string
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("user", "UpdateWithCtx"), []interface{}{int64(1), nil}, func(inv *orm.Invocation) {
+		columns = append(columns, inv.Args[1].([]string))
+	}))
+	audit := captureAudit(stub)
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+
+	// Без пароля меняется только имя: пустой пароль не записывается и в аудит не попадает
+	w := serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", `{"Username": "anna"}`}, laptop)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, [][]string{{"username"}}, columns)
+	if assert.Len(t, *audit, 1) {
+		assert.NotContains(t, (*audit)[0].Changes, "Password")
+	}
+	assert.Equal(t, http.StatusOK, serveAdmin("GET", "/v1/visitor/user/sessions", phone).Code)
+
+	w = serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", `{"Username": "anna", "Password": "short"}`}, laptop)
+	assert.Contains(t, w.Body.String(), models.ErrWeakPassword.Error())
+	assert.Len(t, columns, 1, "a short password is rejected before the update")
+
+	// Новый пароль завершает остальные сессии, текущая остаётся
+	w = serveCompanyRoute(companyRoute{"PUT", "/v1/visitor/user", `{"Username": "anna", "Password": "new-password"}`}, laptop)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	if assert.Len(t, columns, 2) {
+		assert.Equal(t, []string{"username", "password_hash"}, columns[1])
+	}
+	assert.Equal(t, http.StatusUnauthorized, serveAdmin("GET", "/v1/visitor/user/sessions", phone).Code)
+	assert.Equal(t, http.StatusOK, serveAdmin("GET", "/v1/visitor/user/sessions", laptop).Code)
+}
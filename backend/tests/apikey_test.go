@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"api/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// apiKeyRow подставляет ключ, найденный по префиксу, и считает обновления last_used_at
+type apiKeyRow struct {
+	*mock.DoNothingQuerySetter
+	key     models.APIKey
+	touches *int
+}
+
+func (q apiKeyRow) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q apiKeyRow) One(container interface{}, _ ...string) error {
+	*container.(*models.APIKey) = q.key
+	return nil
+}
+func (q apiKeyRow) Update(values orm.Params) (int64, error) {
+	if _, ok := values["last_used_at"]; ok {
+		*q.touches++
+	}
+	return 1, nil
+}
+
+// issueAPIKey создаёт ключ владельца 7 и подставляет его строку для последующих запросов
+func issueAPIKey(t *testing.T, stub mock.Stub, scopes ...string) (string, *int) {
+	stub.Mock(mock.MockInsertWithCtx("api_key", 5, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	body, _ := json.Marshal(models.APIKeyRequest{Name: "Синхронизация 1С", Scopes: scopes})
+	w := serveCompanyRoute(companyRoute{"POST", "/v1/owner/user/api-keys", string(body)}, ownerToken(7))
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var resp struct {
+		Data models.CreatedAPIKey `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, strings.HasPrefix(resp.Data.Key, resp.Data.Prefix+"_"))
+	assert.Equal(t, scopes, resp.Data.Scopes)
+
+	sum := sha256.Sum256([]byte(resp.Data.Key))
+	touches := new(int)
+	stub.Mock(mockQueryTable("api_key", apiKeyRow{&mock.DoNothingQuerySetter{}, models.APIKey{
+		Id:      5,
+		OwnerId: 7,
+		Prefix:  resp.Data.Prefix,
+		KeyHash: hex.EncodeToString(sum[:]),
+		Scopes:  strings.Join(scopes, ","),
+	}, touches}))
+	stub.Mock(mock.MockRead("owner", func(data interface{}) {
+		owner := data.(*models.Owner)
+		owner.EmailVerified = true
+	}, nil))
+	return resp.Data.Key, touches
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	readKey, touches := issueAPIKey(t, stub, models.ScopeRead)
+
+	principal, err := models.AuthenticateAPIKey(readKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), principal.ID)
+	assert.Equal(t, models.RoleOwner, principal.Role)
+	assert.True(t, principal.HasScope(models.ScopeRead))
+	assert.False(t, principal.HasScope(models.ScopeCompaniesWrite))
+	assert.Equal(t, 1, *touches)
+
+	// Ключ только для чтения не изменяет компании
+	w := serveCompanyRoute(companyRoute{"DELETE", "/v1/owner/company/1", ""}, readKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "companies:write")
+
+	// Ключ для чтения видит ключи и сессии владельца, но не управляет ими
+	w = serveAdmin("GET", "/v1/owner/user/api-keys", readKey)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serveAdmin("GET", "/v1/owner/user/sessions", readKey)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serveAdmin("DELETE", "/v1/owner/user/api-keys/5", readKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveCompanyRoute(companyRoute{"POST", "/v1/owner/user/api-keys", `{"name":"ci","scopes":["read"]}`}, readKey)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Неверный секрет с существующим префиксом
+	_, err = models.AuthenticateAPIKey(readKey[:len(readKey)-1] + "x")
+	assert.ErrorIs(t, err, models.ErrInvalidAPIKey)
+}
+
+func TestAPIKeyWritesCompanies(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	writeKey, _ := issueAPIKey(t, stub, models.ScopeCompaniesWrite)
+
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		company := data.(*models.Company)
+		company.Owner = &models.Owner{Id: 7}
+	}, nil))
+	stub.Mock(mock.MockDeleteWithCtx("company", 1, nil))
+
+	w := serveCompanyRoute(companyRoute{"DELETE", "/v1/owner/company/1", ""}, writeKey)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestAPIKeyValidationAndRevocation(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("api_key", updatedRows{&mock.DoNothingQuerySetter{}, 0}))
+
+	w := serveCompanyRoute(companyRoute{"POST", "/v1/owner/user/api-keys", `{"name":"ci","scopes":["admin"]}`}, ownerToken(7))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveCompanyRoute(companyRoute{"POST", "/v1/owner/user/api-keys", `{"name":"","scopes":["read"]}`}, ownerToken(7))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Уже отозванный или чужой ключ
+	w = serveAdmin("DELETE", "/v1/owner/user/api-keys/5", ownerToken(7))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Отозванный ключ не аутентифицирует запрос
+	sum := sha256.Sum256([]byte("qt_0123abcd_secret"))
+	revoked := models.APIKey{Id: 5, OwnerId: 7, Prefix: "qt_0123abcd", KeyHash: hex.EncodeToString(sum[:]),
+		Scopes: models.ScopeCompaniesWrite, RevokedAt: time.Now()}
+	stub.Clear()
+	stub.Mock(mockQueryTable("api_key", apiKeyRow{&mock.DoNothingQuerySetter{}, revoked, new(int)}))
+	w = serveCompanyRoute(companyRoute{"DELETE", "/v1/owner/company/1", ""}, "qt_0123abcd_secret")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
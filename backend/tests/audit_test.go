@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"api/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureAudit перехватывает записи в audit_log
+func captureAudit(stub mock.Stub) *[]models.AuditLog {
+	entries := new([]models.AuditLog)
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("audit_log", "InsertWithCtx"), []interface{}{int64(1), nil},
+		func(inv *orm.Invocation) {
+			*entries = append(*entries, *inv.Args[0].(*models.AuditLog))
+		}))
+	return entries
+}
+
+func changesOf(t *testing.T, entry models.AuditLog) map[string]models.FieldChange {
+	var changes map[string]models.FieldChange
+	assert.Nil(t, json.Unmarshal([]byte(entry.Changes), &changes))
+	return changes
+}
+
+func TestCompanyUpdateIsAudited(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		company := data.(*models.Company)
+		company.Name = "Кофейня"
+		company.City = "Казань"
+		company.Description = "Лучший кофе"
+		company.Owner = &models.Owner{Id: 7, Password: "owner-hash"}
+	}, nil))
+	stub.Mock(mock.MockUpdateWithCtx("company", 1, nil))
+	entries := captureAudit(stub)
+
+	r, _ := http.NewRequest("PUT", "/v1/owner/company/1",
+		bytes.NewBufferString(`{"name":"Кофейня на Баумана","city":"Казань","address":"Баумана, 1"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+ownerToken(7))
+	r.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+
+	assert.Len(t, *entries, 1)
+	entry := (*entries)[0]
+	assert.Equal(t, "company.update", entry.Action)
+	assert.Equal(t, models.RoleOwner, entry.ActorType)
+	assert.Equal(t, int64(7), entry.ActorId)
+	assert.Equal(t, "company", entry.EntityType)
+	assert.Equal(t, "1", entry.EntityId)
+	assert.Equal(t, "req-42", entry.RequestId)
+
+	changes := changesOf(t, entry)
+	assert.Equal(t, models.FieldChange{From: "Кофейня", To: "Кофейня на Баумана"}, changes["Name"])
+	assert.Equal(t, models.FieldChange{From: "", To: "Баумана, 1"}, changes["Address"])
+	assert.NotContains(t, changes, "City")
+	assert.NotContains(t, changes, "Owner")
+	assert.NotContains(t, entry.Changes, "owner-hash")
+}
+
+func TestOwnerPasswordChangeIsRedacted(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("owner", func(data interface{}) {
+		owner := data.(*models.Owner)
+		owner.Fullname = "Иван Петров"
+		owner.Email = "ivan@example.com"
+		owner.Password = "old-hash"
+		owner.EmailVerified = true
+	}, nil))
+	stub.Mock(mock.MockUpdateWithCtx("owner", 1, nil))
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	entries := captureAudit(stub)
+
+	owner := models.Owner{Id: 5, Fullname: "Иван Петров", Email: "ivan@example.com", Phone: "+79990000000", Password: "n3w-secret"}
+	assert.Nil(t, models.UpdateOwner(&owner, models.Actor{Type: models.RoleOwner, ID: 5, IP: "10.0.0.1"}))
+
+	assert.Len(t, *entries, 1)
+	entry := (*entries)[0]
+	assert.Equal(t, "owner.update", entry.Action)
+	assert.Equal(t, "10.0.0.1", entry.IP)
+
+	changes := changesOf(t, entry)
+	assert.Equal(t, models.FieldChange{From: "[redacted]", To: "[redacted]"}, changes["Password"])
+	assert.Equal(t, models.FieldChange{From: "", To: "+79990000000"}, changes["Phone"])
+	assert.NotContains(t, changes, "Email")
+	assert.NotContains(t, entry.Changes, "old-hash")
+	assert.NotContains(t, entry.Changes, "n3w-secret")
+}
+
+func TestAdminListsAuditWithFilters(t *testing.T) {
+	w := serveAdmin("GET", "/v1/admin/audit", visitorTokenWithRoles(1, models.RoleModerator))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+
+	admin := visitorTokenWithRoles(1, models.RoleAdmin)
+	w = serveAdmin("GET", "/v1/admin/audit?from=yesterday", admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("audit_log", recordedTable{&mock.DoNothingQuerySetter{}, "audit_log", []models.AuditLog{{
+		Id:         3,
+		Action:     "company.update",
+		ActorType:  models.RoleOwner,
+		ActorId:    7,
+		EntityType: "company",
+		EntityId:   "1",
+		Changes:    `{"Name":{"from":"Кофейня","to":"Кофейня на Баумана"}}`,
+	}}, new([]string)}))
+
+	w = serveAdmin("GET", "/v1/admin/audit?entity_type=company&entity_id=1&from=2026-01-01T00:00:00Z", admin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data []models.AuditEntry `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Data, 1)
+	assert.Equal(t, "Кофейня на Баумана", resp.Data[0].Changes["Name"].To)
+}
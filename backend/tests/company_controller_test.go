@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"api/api/http/types"
+	"api/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+type companyRoute struct {
+	method string
+	path   string
+	body   string
+}
+
+var companyMutations = []companyRoute{
+	{"POST", "/v1/owner/company/", `{"name":"Кофейня","inn":"1234567890"}`},
+	{"PUT", "/v1/owner/company/1", `{"name":"Кофейня"}`},
+	{"DELETE", "/v1/owner/company/1", ""},
+	{"GET", "/v1/owner/company/1/generate-description", ""},
+	{"PUT", "/v1/owner/company/1/update-description", `{"description":"Лучший кофе"}`},
+}
+
+func serveCompanyRoute(route companyRoute, token string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(route.method, route.path, bytes.NewBufferString(route.body))
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+func ownerToken(id int64) string {
+	token, _ := models.CreateOwnerToken(models.Owner{Id: id, EmailVerified: true}, "")
+	return token
+}
+
+// mockCompany подставляет компанию id=1 владельца ownerID вместо чтения из БД
+func mockCompany(ownerID int64) mock.Stub {
+	stub := mock.StartMock()
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		company := data.(*models.Company)
+		company.Name = "Кофейня"
+		company.BusinessSphere = "Общепит"
+		company.Owner = &models.Owner{Id: ownerID}
+	}, nil))
+	return stub
+}
+
+func TestCompanyMutationsRequireOwnerToken(t *testing.T) {
+	visitor, _ := models.CreateToken(models.User{Id: 1, Username: "visitor"}, "")
+
+	for _, route := range companyMutations {
+		w := serveCompanyRoute(route, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, route.method+" "+route.path)
+
+		w = serveCompanyRoute(route, visitor)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "visitor token: "+route.method+" "+route.path)
+	}
+}
+
+func TestCompanyMutationsForbiddenForOtherOwner(t *testing.T) {
+	stub := mockCompany(1)
+	defer stub.Clear()
+
+	// Создание компании не проверяется: у новой компании владелец всегда из токена
+	for _, route := range companyMutations[1:] {
+		w := serveCompanyRoute(route, ownerToken(2))
+		assert.Equal(t, http.StatusForbidden, w.Code, route.method+" "+route.path)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/problem+json")
+
+		var problem types.Problem
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, http.StatusForbidden, problem.Status)
+		assert.Equal(t, route.path, problem.Instance)
+	}
+}
+
+func TestCompanyMutationsAllowedForOwner(t *testing.T) {
+	stub := mockCompany(1)
+	defer stub.Clear()
+	stub.Mock(mock.MockUpdateWithCtx("company", 1, nil))
+	stub.Mock(mock.MockDeleteWithCtx("company", 1, nil))
+
+	for _, route := range []companyRoute{companyMutations[1], companyMutations[2], companyMutations[4]} {
+		w := serveCompanyRoute(route, ownerToken(1))
+		assert.Equal(t, http.StatusOK, w.Code, route.method+" "+route.path)
+	}
+}
+
+func TestCompanyPostTakesOwnerFromToken(t *testing.T) {
+	var inserted *models.Company
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("company", "InsertWithCtx"), []interface{}{int64(10), nil}, func(inv *orm.Invocation) {
+		inserted = inv.Args[0].(*models.Company)
+	}))
+
+	route := companyRoute{"POST", "/v1/owner/company/", `{"owner_id":1,"name":"Кофейня","inn":"1234567890"}`}
+	w := serveCompanyRoute(route, ownerToken(7))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.NotNil(t, inserted) {
+		assert.Equal(t, int64(7), inserted.Owner.Id)
+	}
+}
+
+func TestCompanyReadRoutesArePublic(t *testing.T) {
+	stub := mockCompany(1)
+	defer stub.Clear()
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/1", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/", ""}, "")
+	assert.NotEqual(t, http.StatusUnauthorized, w.Code)
+	assert.NotEqual(t, http.StatusForbidden, w.Code)
+}
+
+func TestBlockedCompanyHiddenFromReaders(t *testing.T) {
+	moderator := visitorTokenWithRoles(2, models.RoleModerator)
+	owner := ownerToken(1)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		c := data.(*models.Company)
+		c.Name, c.City, c.Address, c.Blocked = "Кофейня", "Казань", "ул. Баумана, 1", true
+		c.Owner = &models.Owner{Id: 1}
+	}, nil))
+	var enqueued int
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"), []interface{}{&mock.DoNothingRawSetter{}}, func(inv *orm.Invocation) {
+		if strings.Contains(inv.Args[0].(string), "geocode_job") {
+			enqueued++
+		}
+	}))
+
+	for _, token := range []string{"", owner} {
+		assert.Equal(t, http.StatusNotFound, serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/1", ""}, token).Code)
+		assert.Equal(t, http.StatusNotFound, serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/company/1", ""}, token).Code)
+	}
+	assert.Zero(t, enqueued, "a hidden company must not be queued for geocoding")
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/1", ""}, moderator)
+	assert.Equal(t, http.StatusOK, w.Code, "companies:manage sees blocked companies")
+}
+
+func TestAuthorizeCompanyMutation(t *testing.T) {
+	company := &models.Company{Owner: &models.Owner{Id: 1}}
+
+	assert.Nil(t, models.AuthorizeCompanyMutation(&models.Principal{ID: 1, Role: models.RoleOwner}, company))
+	assert.Equal(t, models.ErrForbidden, models.AuthorizeCompanyMutation(&models.Principal{ID: 2, Role: models.RoleOwner}, company))
+	assert.Equal(t, models.ErrForbidden, models.AuthorizeCompanyMutation(&models.Principal{ID: 1, Role: models.RoleVisitor}, company))
+	assert.Equal(t, models.ErrForbidden, models.AuthorizeCompanyMutation(nil, company))
+}
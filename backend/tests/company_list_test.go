@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"api/models"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// companyTable отдаёт строки компаний и общее число, записывая сортировку и размер выборки
+type companyTable struct {
+	recordedTable
+	total  int64
+	orders *[][]string
+	limits *[]interface{}
+}
+
+func (q companyTable) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q companyTable) SetCond(*orm.Condition) orm.QuerySeter        { return q }
+func (q companyTable) OrderBy(order ...string) orm.QuerySeter {
+	*q.orders = append(*q.orders, order)
+	return q
+}
+func (q companyTable) Limit(limit interface{}, _ ...interface{}) orm.QuerySeter {
+	*q.limits = append(*q.limits, limit)
+	return q
+}
+func (q companyTable) Count() (int64, error) { return q.total, nil }
+
+func mockCompanyTable(stub mock.Stub, total int64, rows []models.Company) companyTable {
+	table := companyTable{
+		recordedTable: recordedTable{&mock.DoNothingQuerySetter{}, "company", rows, new([]string)},
+		total:         total,
+		orders:        new([][]string),
+		limits:        new([]interface{}),
+	}
+	stub.Mock(mockQueryTable("company", table))
+	return table
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>; rel="next"`)
+
+func TestCompanyListPaginatesWithCursor(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 7, []models.Company{
+		{Id: 4, Name: "Аптека", City: "Казань"},
+		{Id: 2, Name: "Булочная", City: "Казань"},
+		{Id: 9, Name: "Кофейня", City: "Казань"},
+	})
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/?city=Казань&sort=name&limit=2", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "7", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, []interface{}{3}, *table.limits, "one extra row shows whether a next page exists")
+	assert.Equal(t, [][]string{{"name", "id"}}, *table.orders)
+
+	var companies []models.Company
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &companies))
+	assert.Len(t, companies, 2)
+	assert.Equal(t, "Булочная", companies[1].Name)
+
+	link := w.Header().Get("Link")
+	assert.Contains(t, link, `rel="first"`)
+	next := nextLink.FindStringSubmatch(link)
+	if assert.Len(t, next, 2, link) {
+		assert.Contains(t, next[1], "city=")
+		assert.Contains(t, next[1], "cursor=")
+
+		w = serveCompanyRoute(companyRoute{"GET", next[1], ""}, "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		// Курсор привязан к сортировке, с которой он выдан
+		w = serveCompanyRoute(companyRoute{"GET", strings.Replace(next[1], "sort=name", "sort=-id", 1), ""}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCompanyListClampsLimit(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 0, nil)
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/?limit=1000", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/?limit=0", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []interface{}{models.CompanyPageMax + 1, models.CompanyPageDefault + 1}, *table.limits)
+}
+
+func TestCompanyListRejectsInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"sort=rating",
+		"has_coordinates=maybe",
+		"created_from=yesterday",
+		"owner=me",
+		"cursor=not-a-cursor",
+	} {
+		w := serveCompanyRoute(companyRoute{"GET", "/v1/owner/company/?" + query, ""}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGeoCompaniesUsesListParams(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 2, []models.Company{
+		{Id: 3, Name: "Кофейня", Lat: 55.79, Lon: 49.12},
+		{Id: 1, Name: "Булочная"},
+	})
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/companies?business_sphere=Кафе", ""}, "")
+	assert.Equal(t, http.StatusPartialContent, w.Code, w.Body.String())
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.NotContains(t, w.Header().Get("Link"), `rel="next"`)
+}
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/beego/beego/v2/client/orm"
+	_ "github.com/beego/beego/v2/client/orm/mock"
+)
+
+var errNoDatabase = errors.New("no database in tests")
+
+// nopDriver — драйвер database/sql без сервера. Он нужен только для регистрации
+// алиаса mydatabase: запросы моделей в тестах перехватываются через orm/mock.
+type nopDriver struct{}
+
+func (nopDriver) Open(string) (driver.Conn, error) { return nopConn{}, nil }
+
+type nopConn struct{}
+
+func (nopConn) Prepare(string) (driver.Stmt, error) { return nil, errNoDatabase }
+func (nopConn) Close() error                        { return nil }
+func (nopConn) Begin() (driver.Tx, error)           { return nil, errNoDatabase }
+
+func init() {
+	sql.Register("nopdb", nopDriver{})
+	_ = orm.RegisterDriver("nopdb", orm.DRPostgres)
+	if err := orm.RegisterDataBase("mydatabase", "nopdb", ""); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"api/models"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompaniesGeoJSON(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 0, clusterCompanies)
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/companies.geojson?business_sphere=Кафе", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/geo+json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, []interface{}{-1}, *table.limits, "export is not paginated")
+
+	var collection struct {
+		Type     string
+		Features []struct {
+			Type     string
+			ID       int64
+			Geometry struct {
+				Type        string
+				Coordinates []float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	if assert.Len(t, collection.Features, 4) {
+		feature := collection.Features[0]
+		assert.Equal(t, "Feature", feature.Type)
+		assert.Equal(t, int64(11), feature.ID)
+		assert.Equal(t, "Point", feature.Geometry.Type)
+		assert.Equal(t, []float64{49.1060, 55.7960}, feature.Geometry.Coordinates, "longitude first")
+		assert.Equal(t, "Кофейня", feature.Properties["name"])
+		assert.Equal(t, "Кафе", feature.Properties["business_sphere"])
+	}
+}
+
+func TestCompaniesGeoJSONEmpty(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 0, []models.Company{})
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/companies.geojson", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, w.Body.String())
+}
+
+func TestCompaniesKML(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 0, []models.Company{
+		{Id: 7, Name: "Кафе <Уют> & Co", City: "Казань", Lat: 55.796, Lon: 49.106},
+	})
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/companies.kml?city=Казань", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/vnd.google-earth.kml+xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var doc struct {
+		XMLName    xml.Name
+		Placemarks []struct {
+			ID          string `xml:"id,attr"`
+			Name        string `xml:"name"`
+			Coordinates string `xml:"Point>coordinates"`
+			Data        []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value"`
+			} `xml:"ExtendedData>Data"`
+		} `xml:"Document>Placemark"`
+	}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "http://www.opengis.net/kml/2.2", doc.XMLName.Space)
+	if assert.Len(t, doc.Placemarks, 1) {
+		placemark := doc.Placemarks[0]
+		assert.Equal(t, "company-7", placemark.ID)
+		assert.Equal(t, "Кафе <Уют> & Co", placemark.Name)
+		assert.Equal(t, "49.106,55.796", placemark.Coordinates)
+		assert.Contains(t, placemark.Data, struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		}{"city", "Казань"})
+	}
+}
+
+func TestCompaniesExportRejectsInvalidFilter(t *testing.T) {
+	for _, path := range []string{"companies.geojson", "companies.kml"} {
+		w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/" + path + "?created_from=yesterday", ""}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
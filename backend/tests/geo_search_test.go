@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/geohash"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+// Точки в Казани: Кремль и компании в 300 м, 1,2 км и 1,9 км от него
+var (
+	kazanKremlin = models.GeoPoint{Lat: 55.7987, Lon: 49.1055}
+	geoCompanies = []models.Company{
+		{Id: 1, Name: "Дальняя", Lat: 55.8157, Lon: 49.1055},
+		{Id: 2, Name: "Ближняя", Lat: 55.8014, Lon: 49.1055},
+		{Id: 3, Name: "Угловая", Lat: 55.8095, Lon: 49.1055},
+	}
+)
+
+func TestDistanceMeters(t *testing.T) {
+	moscow := models.GeoPoint{Lat: 55.7558, Lon: 37.6173}
+	assert.InDelta(t, 719000, models.DistanceMeters(moscow, kazanKremlin), 7000)
+	assert.InDelta(t, 300, models.DistanceMeters(kazanKremlin, models.GeoPoint{Lat: 55.8014, Lon: 49.1055}), 5)
+	assert.Zero(t, models.DistanceMeters(kazanKremlin, kazanKremlin))
+}
+
+func TestCompaniesWithinRadiusSortedByDistance(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 0, geoCompanies)
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/radius?lat=55.7987&lon=49.1055&radius=1500&business_sphere=Кафе", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, []interface{}{models.GeoCandidatesMax() + 1}, *table.limits, "one extra candidate shows the area is too dense")
+
+	var companies []models.GeoCompany
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &companies))
+	if assert.Len(t, companies, 2) {
+		assert.Equal(t, int64(2), companies[0].Id)
+		assert.Equal(t, int64(3), companies[1].Id)
+		assert.InDelta(t, 300, *companies[0].Distance, 5)
+		assert.Equal(t, 55.8014, companies[0].Lat)
+	}
+}
+
+func TestNearestCompaniesWidensRadius(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 0, geoCompanies)
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/nearest?lat=55.7987&lon=49.1055&n=3", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, *table.limits, 2, "1 km finds one company, 2 km finds all three")
+
+	var companies []models.GeoCompany
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &companies))
+	if assert.Len(t, companies, 3) {
+		assert.Equal(t, []int64{2, 3, 1}, []int64{companies[0].Id, companies[1].Id, companies[2].Id})
+	}
+}
+
+func TestGeoSearchRejectsTooDenseArea(t *testing.T) {
+	assert.Nil(t, beego.AppConfig.Set("geo_candidates_max", "2"))
+	defer func() { _ = beego.AppConfig.Set("geo_candidates_max", "5000") }()
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 0, geoCompanies)
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/radius?lat=55.7987&lon=49.1055&radius=1500", ""}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Equal(t, []interface{}{3}, *table.limits)
+
+	// Ближайшие ищутся в уменьшающемся радиусе, пока он не сойдётся к центру
+	*table.limits = nil
+	w = serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/nearest?lat=55.7987&lon=49.1055&n=3", ""}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Len(t, *table.limits, 11, "1 km is halved down to 1 m")
+}
+
+func TestGeohashEncode(t *testing.T) {
+	assert.Equal(t, "u4pruydqqvj", geohash.Encode(57.64911, 10.40744, 11))
+	assert.Equal(t, "ezs42", geohash.Encode(42.605, -5.603, 5))
+	assert.Len(t, geohash.Encode(kazanKremlin.Lat, kazanKremlin.Lon, 40), geohash.MaxPrecision)
+}
+
+func TestGeohashCoverContainsBoxPoints(t *testing.T) {
+	cells := geohash.Cover(55.79, 49.09, 55.82, 49.12, 16)
+	assert.NotEmpty(t, cells)
+	assert.LessOrEqual(t, len(cells), 16)
+	for _, c := range geoCompanies {
+		hash := geohash.Encode(c.Lat, c.Lon, geohash.MaxPrecision)
+		assert.True(t, hasAnyPrefix(hash, cells), "%s is not covered by %v", hash, cells)
+	}
+
+	// Прямоугольник через 180-й меридиан покрывается ячейками с обеих сторон
+	cells = geohash.Cover(64.5, 179.5, 65.5, -179.5, 16)
+	assert.True(t, hasAnyPrefix(geohash.Encode(65, 179.9, geohash.MaxPrecision), cells), "%v", cells)
+	assert.True(t, hasAnyPrefix(geohash.Encode(65, -179.9, geohash.MaxPrecision), cells), "%v", cells)
+	assert.False(t, hasAnyPrefix(geohash.Encode(65, 0, geohash.MaxPrecision), cells), "%v", cells)
+
+	assert.Nil(t, geohash.Cover(-90, -180, 90, 180, 16), "the whole world needs more than 16 cells")
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCompaniesInBBox(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 3, geoCompanies)
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/bbox?bbox=49.0,55.7,49.2,55.9", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+
+	var companies []models.GeoCompany
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &companies))
+	assert.Len(t, companies, 3)
+	assert.Nil(t, companies[0].Distance)
+}
+
+func TestGeoSearchClampsLimit(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	table := mockCompanyTable(stub, 3, geoCompanies)
+
+	for _, limit := range []string{"1000", "0"} {
+		w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/bbox?bbox=49.0,55.7,49.2,55.9&limit=" + limit, ""}, "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	assert.Equal(t, []interface{}{models.GeoLimitMax, models.GeoLimitDefault}, *table.limits)
+}
+
+func TestGeoSearchRejectsInvalidParams(t *testing.T) {
+	for _, path := range []string{
+		"/v1/geocoder/cords/geo/radius?lat=55.79&radius=500",
+		"/v1/geocoder/cords/geo/radius?lat=95&lon=49.1&radius=500",
+		"/v1/geocoder/cords/geo/radius?lat=55.79&lon=49.1&radius=1000000",
+		"/v1/geocoder/cords/geo/nearest?lat=north&lon=49.1",
+		"/v1/geocoder/cords/geo/bbox?bbox=49.0,55.9,49.2",
+		"/v1/geocoder/cords/geo/bbox?bbox=49.0,55.9,49.2,55.7",
+	} {
+		w := serveCompanyRoute(companyRoute{"GET", path, ""}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
@@ -0,0 +1,360 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/geocoder"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// claimedJob — ответ на захват задачи из очереди; err — например, orm.ErrNoRows
+type claimedJob struct {
+	*mock.DoNothingRawSetter
+	job models.GeocodeJob
+	err error
+}
+
+func (r claimedJob) QueryRow(containers ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	*containers[0].(*int64) = r.job.Id
+	*containers[1].(*int64) = r.job.CompanyId
+	*containers[2].(*int) = r.job.Attempts
+	return nil
+}
+
+// geocodeJobTable записывает изменения задач и условия, по которым они выбраны;
+// leaseLost — задачу уже перезапустили или взял другой обработчик
+type geocodeJobTable struct {
+	*mock.DoNothingQuerySetter
+	updates   *[]orm.Params
+	deletes   *int
+	filters   map[string]interface{}
+	leaseLost bool
+}
+
+func (q geocodeJobTable) Filter(field string, args ...interface{}) orm.QuerySeter {
+	if q.filters != nil {
+		q.filters[field] = args[0]
+	}
+	return q
+}
+func (q geocodeJobTable) Update(values orm.Params) (int64, error) {
+	if q.leaseLost {
+		return 0, nil
+	}
+	*q.updates = append(*q.updates, values)
+	return 1, nil
+}
+func (q geocodeJobTable) Delete() (int64, error) {
+	*q.deletes++
+	return 1, nil
+}
+
+// failingGeocoder всегда возвращает err
+type failingGeocoder struct{ err error }
+
+func (g failingGeocoder) Name() string { return "failing" }
+func (g failingGeocoder) Geocode(context.Context, string) (geocoder.Result, error) {
+	return geocoder.Result{}, g.err
+}
+
+// runGeocodeJob выполняет задачу job компании из Казани и возвращает изменения задачи
+func runGeocodeJob(t *testing.T, g geocoder.Geocoder, job models.GeocodeJob, companyErr error) (*[]orm.Params, int) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	models.Geocoder = g
+	defer func() { models.Geocoder = nil }()
+
+	stub.Mock(mock.MockRawWithCtx(claimedJob{&mock.DoNothingRawSetter{}, job, nil}))
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		c := data.(*models.Company)
+		c.City, c.Address = "Казань", "ул. Баумана, 1"
+	}, companyErr))
+	stub.Mock(mockQueryTable("company", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	updates, deletes := new([]orm.Params), new(int)
+	stub.Mock(mockQueryTable("geocode_job", geocodeJobTable{&mock.DoNothingQuerySetter{}, updates, deletes, nil, false}))
+
+	processed, err := models.ProcessGeocodeJob(context.Background())
+	assert.True(t, processed)
+	assert.Nil(t, err)
+	return updates, *deletes
+}
+
+func TestGeocodeBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, models.GeocodeBackoff(1))
+	assert.Equal(t, time.Minute, models.GeocodeBackoff(2))
+	assert.Equal(t, 4*time.Minute, models.GeocodeBackoff(4))
+	assert.Equal(t, time.Hour, models.GeocodeBackoff(20))
+}
+
+func TestGeocodeJobSucceeds(t *testing.T) {
+	static := geocoder.NewStatic(map[string]geocoder.Result{
+		"Казань, ул. Баумана, 1": {Lat: 55.796, Lon: 49.106},
+	})
+	updates, _ := runGeocodeJob(t, static, models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 1}, nil)
+
+	if assert.Len(t, *updates, 1) {
+		assert.Equal(t, models.GeocodeOK, (*updates)[0]["status"])
+		assert.Equal(t, "static", (*updates)[0]["provider"])
+		assert.Equal(t, "exact", (*updates)[0]["precision"])
+	}
+}
+
+func TestGeocodeJobRetriesTransientErrors(t *testing.T) {
+	down := failingGeocoder{errors.New("status 503")}
+
+	before := time.Now()
+	updates, _ := runGeocodeJob(t, down, models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 2}, nil)
+	if assert.Len(t, *updates, 1) {
+		assert.Equal(t, models.GeocodePending, (*updates)[0]["status"])
+		assert.Equal(t, "status 503", (*updates)[0]["last_error"])
+		assert.WithinDuration(t, before.Add(time.Minute), (*updates)[0]["next_run_at"].(time.Time), 5*time.Second)
+	}
+
+	// После geocode_max_attempts попыток задача остаётся в failed
+	updates, _ = runGeocodeJob(t, down, models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 5}, nil)
+	if assert.Len(t, *updates, 1) {
+		assert.Equal(t, models.GeocodeFailed, (*updates)[0]["status"])
+	}
+}
+
+func TestGeocodeJobFailsWhenAddressNotFound(t *testing.T) {
+	updates, _ := runGeocodeJob(t, geocoder.NewStatic(nil), models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 1}, nil)
+	if assert.Len(t, *updates, 1) {
+		assert.Equal(t, models.GeocodeFailed, (*updates)[0]["status"], "retrying will not find an unknown address")
+		assert.Equal(t, geocoder.ErrNotFound.Error(), (*updates)[0]["last_error"])
+	}
+}
+
+func TestGeocodeJobOfDeletedCompanyIsDropped(t *testing.T) {
+	updates, deletes := runGeocodeJob(t, geocoder.NewStatic(nil), models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 1}, orm.ErrNoRows)
+	assert.Empty(t, *updates)
+	assert.Equal(t, 1, deletes)
+}
+
+func TestGeocodeJobResultNeedsLease(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	models.Geocoder = geocoder.NewStatic(map[string]geocoder.Result{"Казань, ул. Баумана, 1": {Lat: 55.796, Lon: 49.106}})
+	defer func() { models.Geocoder = nil }()
+
+	stub.Mock(mock.MockRawWithCtx(claimedJob{&mock.DoNothingRawSetter{}, models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 1}, nil}))
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		c := data.(*models.Company)
+		c.City, c.Address = "Казань", "ул. Баумана, 1"
+	}, nil))
+	stub.Mock(mockQueryTable("company", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	updates, filters := new([]orm.Params), map[string]interface{}{}
+	stub.Mock(mockQueryTable("geocode_job", geocodeJobTable{&mock.DoNothingQuerySetter{}, updates, new(int), filters, true}))
+
+	processed, err := models.ProcessGeocodeJob(context.Background())
+	assert.True(t, processed)
+	assert.Nil(t, err, "a lost lease is not an error")
+	assert.Empty(t, *updates, "the new lease holder's result must not be overwritten")
+	assert.NotEmpty(t, filters["lease_id"])
+}
+
+// leasedJobTable принимает изменения задачи только от обработчика с текущей арендой
+type leasedJobTable struct {
+	*mock.DoNothingQuerySetter
+	lease   *string
+	leaseID interface{}
+	updates *[]orm.Params
+}
+
+func (q leasedJobTable) Filter(field string, args ...interface{}) orm.QuerySeter {
+	if field == "lease_id" {
+		q.leaseID = args[0]
+	}
+	return q
+}
+func (q leasedJobTable) Update(values orm.Params) (int64, error) {
+	if q.leaseID != *q.lease {
+		return 0, nil
+	}
+	*q.updates = append(*q.updates, values)
+	return 1, nil
+}
+
+// reclaimingGeocoder при первом вызове даёт задачу перезапустить и захватить другому обработчику
+type reclaimingGeocoder struct {
+	geocoder.Geocoder
+	reclaimed *bool
+}
+
+func (g reclaimingGeocoder) Geocode(ctx context.Context, address string) (geocoder.Result, error) {
+	if !*g.reclaimed {
+		*g.reclaimed = true
+		if _, err := models.ProcessGeocodeJob(ctx); err != nil {
+			return geocoder.Result{}, err
+		}
+		return geocoder.Result{}, errors.New("stale result")
+	}
+	return g.Geocoder.Geocode(ctx, address)
+}
+
+func TestGeocodeJobLeaseIsUniquePerClaim(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	models.Geocoder = reclaimingGeocoder{geocoder.NewStatic(map[string]geocoder.Result{
+		"Казань, ул. Баумана, 1": {Lat: 55.796, Lon: 49.106},
+	}), new(bool)}
+	defer func() { models.Geocoder = nil }()
+
+	lease := new(string)
+	var lockedUntil []time.Time
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"),
+		[]interface{}{claimedJob{&mock.DoNothingRawSetter{}, models.GeocodeJob{Id: 1, CompanyId: 5, Attempts: 1}, nil}},
+		func(inv *orm.Invocation) {
+			args := inv.Args[1].([]interface{})
+			lockedUntil = append(lockedUntil, args[0].(time.Time))
+			*lease = args[1].(string)
+		}))
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		c := data.(*models.Company)
+		c.City, c.Address = "Казань", "ул. Баумана, 1"
+	}, nil))
+	stub.Mock(mockQueryTable("company", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	updates := new([]orm.Params)
+	stub.Mock(mockQueryTable("geocode_job", leasedJobTable{&mock.DoNothingQuerySetter{}, lease, nil, updates}))
+
+	// Оба захвата — в начале одной секунды: locked_until у них совпадает
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	processed, err := models.ProcessGeocodeJob(context.Background())
+	assert.True(t, processed)
+	assert.Nil(t, err)
+
+	if assert.Len(t, lockedUntil, 2) {
+		assert.Equal(t, lockedUntil[0].Truncate(time.Second), lockedUntil[1].Truncate(time.Second))
+	}
+	if assert.Len(t, *updates, 1, "only the second claim may write its result") {
+		assert.Equal(t, models.GeocodeOK, (*updates)[0]["status"])
+	}
+}
+
+func TestCompanyAddressChangeRequeuesGeocoding(t *testing.T) {
+	owner := ownerToken(7)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		c := data.(*models.Company)
+		c.Name, c.City, c.Address = "Кофейня", "Казань", "ул. Баумана, 1"
+		c.Owner = &models.Owner{Id: 7}
+	}, nil))
+	stub.Mock(mock.MockUpdateWithCtx("company", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	var enqueued []string
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"), []interface{}{&mock.DoNothingRawSetter{}}, func(inv *orm.Invocation) {
+		// Тем же Raw обновляется поисковый индекс компании
+		if query := inv.Args[0].(string); strings.Contains(query, "geocode_job") {
+			enqueued = append(enqueued, query)
+		}
+	}))
+
+	w := serveCompanyRoute(companyRoute{"PUT", "/v1/owner/company/1", `{"name":"Кофейня на Баумана","city":"Казань","address":"ул. Баумана, 1"}`}, owner)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, enqueued, "the address did not change")
+
+	w = serveCompanyRoute(companyRoute{"PUT", "/v1/owner/company/1", `{"name":"Кофейня","city":"Казань","address":"ул. Пушкина, 5"}`}, owner)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	if assert.Len(t, enqueued, 1) {
+		assert.Contains(t, enqueued[0], "DO UPDATE", "a new address restarts the job")
+	}
+}
+
+func TestCompanyListRequestsMissingCoordinates(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 2, []models.Company{
+		{Id: 3, Name: "Кофейня", Lat: 55.79, Lon: 49.12},
+		{Id: 1, Name: "Булочная"},
+	})
+	var enqueued []interface{}
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"), []interface{}{&mock.DoNothingRawSetter{}}, func(inv *orm.Invocation) {
+		assert.Contains(t, inv.Args[0].(string), "DO NOTHING")
+		enqueued = append(enqueued, inv.Args[1].([]interface{})[0])
+	}))
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/companies", ""}, "")
+	assert.Equal(t, http.StatusPartialContent, w.Code, w.Body.String())
+	assert.Equal(t, []interface{}{int64(1)}, enqueued)
+}
+
+func TestProcessGeocodeJobWithEmptyQueue(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRawWithCtx(claimedJob{&mock.DoNothingRawSetter{}, models.GeocodeJob{}, orm.ErrNoRows}))
+
+	processed, err := models.ProcessGeocodeJob(context.Background())
+	assert.False(t, processed)
+	assert.Nil(t, err)
+}
+
+func TestCompanyCoordinatesReportGeocodeStatus(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRead("company", func(data interface{}) {
+		c := data.(*models.Company)
+		c.City, c.Address = "Казань", "ул. Баумана, 1"
+	}, nil))
+	stub.Mock(mockQueryTable("geocode_job", recordedTable{&mock.DoNothingQuerySetter{}, "geocode_job",
+		[]models.GeocodeJob{{Status: models.GeocodeRunning}}, new([]string)}))
+
+	var enqueued []string
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"), []interface{}{&mock.DoNothingRawSetter{}}, func(inv *orm.Invocation) {
+		enqueued = append(enqueued, inv.Args[0].(string))
+	}))
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/company/5", ""}, "")
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var res map[string]string
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, models.GeocodePending, res["geocode_status"])
+	if assert.Len(t, enqueued, 1) {
+		assert.Contains(t, enqueued[0], "DO NOTHING", "public requests must not reset the retry backoff")
+	}
+}
+
+func TestAdminRetriesGeocoding(t *testing.T) {
+	admin := visitorTokenWithRoles(1, models.RoleAdmin)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	audit := captureAudit(stub)
+	stub.Mock(mockQueryTable("company", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("geocode_job", updatedRows{&mock.DoNothingQuerySetter{}, 3}))
+	stub.Mock(mock.MockRawWithCtx(&mock.DoNothingRawSetter{}))
+
+	w := serveAdmin("POST", "/v1/admin/companies/5/geocode/retry", admin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	if assert.Len(t, *audit, 1) {
+		assert.Equal(t, "company.geocode_retry", (*audit)[0].Action)
+	}
+
+	w = serveAdmin("POST", "/v1/admin/geocode/jobs/retry", admin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res struct {
+		Data map[string]int64 `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, int64(3), res.Data["retried"])
+
+	assert.Equal(t, http.StatusOK, serveAdmin("GET", "/v1/admin/geocode/jobs?status=failed", admin).Code)
+	assert.Equal(t, http.StatusBadRequest, serveAdmin("GET", "/v1/admin/geocode/jobs?status=lost", admin).Code)
+	assert.Equal(t, http.StatusForbidden, serveAdmin("GET", "/v1/admin/geocode/jobs", visitorTokenWithRoles(2)).Code)
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/geocoder"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+const yandexFound = `{"response":{"GeoObjectCollection":{"featureMember":[{"GeoObject":{
+	"metaDataProperty":{"GeocoderMetaData":{"precision":"exact","kind":"house","text":"Россия, Казань, улица Баумана, 1"}},
+	"Point":{"pos":"49.106 55.796"}}}]}}}`
+
+const yandexEmpty = `{"response":{"GeoObjectCollection":{"featureMember":[]}}}`
+
+func TestYandexGeocoder(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if r.URL.Query().Get("geocode") == "Нигде" {
+			_, _ = w.Write([]byte(yandexEmpty))
+			return
+		}
+		_, _ = w.Write([]byte(yandexFound))
+	}))
+	defer server.Close()
+
+	yandex := geocoder.NewYandex("secret", time.Second)
+	yandex.BaseURL = server.URL
+
+	result, err := yandex.Geocode(context.Background(), "Казань, Баумана, 1")
+	assert.Nil(t, err)
+	assert.Equal(t, geocoder.Result{
+		Lat:       55.796,
+		Lon:       49.106,
+		Precision: geocoder.PrecisionExact,
+		Address:   "Россия, Казань, улица Баумана, 1",
+		Provider:  "yandex",
+	}, result)
+	assert.Equal(t, []string{"secret"}, query["apikey"])
+	assert.Equal(t, []string{"Казань, Баумана, 1"}, query["geocode"])
+
+	_, err = yandex.Geocode(context.Background(), "Нигде")
+	assert.ErrorIs(t, err, geocoder.ErrNotFound)
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		assert.Equal(t, "/search", r.URL.Path)
+		assert.Equal(t, "Казань, Баумана", r.URL.Query().Get("q"))
+		_, _ = w.Write([]byte(`[{"lat":"55.7903","lon":"49.1147","display_name":"улица Баумана, Казань","place_rank":26}]`))
+	}))
+	defer server.Close()
+
+	result, err := geocoder.NewNominatim(server.URL+"/", "ops@qwerty.town", time.Second).Geocode(context.Background(), "Казань, Баумана")
+	assert.Nil(t, err)
+	assert.Equal(t, 55.7903, result.Lat)
+	assert.Equal(t, 49.1147, result.Lon)
+	assert.Equal(t, geocoder.PrecisionStreet, result.Precision)
+	assert.Equal(t, "улица Баумана, Казань", result.Address)
+	assert.Equal(t, "nominatim", result.Provider)
+	assert.NotEmpty(t, userAgent, "Nominatim usage policy requires a User-Agent")
+}
+
+func TestNominatimIsThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	nominatim := geocoder.NewNominatim(server.URL, "", time.Second)
+	assert.Equal(t, time.Second, nominatim.Interval, "the public server allows one request per second")
+	nominatim.Interval = 100 * time.Millisecond
+
+	// Обработчики очереди делят один геокодер: запросы идут не чаще Interval
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := nominatim.Geocode(context.Background(), "Нигде")
+			assert.ErrorIs(t, err, geocoder.ErrNotFound)
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	// Ожидание прерывается вместе с запросом
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := nominatim.Geocode(ctx, "Нигде")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGeocoderChainFallsBack(t *testing.T) {
+	static := geocoder.NewStatic(map[string]geocoder.Result{
+		"Казань, ул. Баумана, 1": {Lat: 55.796, Lon: 49.106},
+	})
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer empty.Close()
+
+	// Адрес сравнивается без учёта регистра и пробелов
+	chain := geocoder.Chain{geocoder.NewNominatim(empty.URL, "", time.Second), static}
+	result, err := chain.Geocode(context.Background(), "казань,  ул. Баумана , 1")
+	assert.Nil(t, err)
+	assert.Equal(t, "static", result.Provider)
+	assert.Equal(t, geocoder.PrecisionExact, result.Precision)
+
+	_, err = chain.Geocode(context.Background(), "Москва, Тверская, 1")
+	assert.ErrorIs(t, err, geocoder.ErrNotFound)
+
+	// Недоступный провайдер — временная ошибка, а не «адрес не найден»
+	chain = geocoder.Chain{geocoder.NewNominatim(down.URL, "", time.Second), static}
+	_, err = chain.Geocode(context.Background(), "Москва, Тверская, 1")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, geocoder.ErrNotFound))
+	assert.Contains(t, err.Error(), "status 503")
+}
+
+func TestLoadGeocoder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geocoder.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"Казань, Баумана, 1": {"lat": 55.796, "lon": 49.106, "precision": "street"}}`), 0o600))
+	defer func() {
+		_ = beego.AppConfig.Set("geocoder_providers", "")
+		models.Geocoder = nil
+	}()
+
+	assert.Nil(t, beego.AppConfig.Set("geocoder_providers", "yandex, static"))
+	assert.Nil(t, beego.AppConfig.Set("geocoder_yandex_api_key", ""))
+	assert.Nil(t, beego.AppConfig.Set("geocoder_static_file", path))
+	assert.Nil(t, models.LoadGeocoder())
+	if assert.NotNil(t, models.Geocoder) {
+		assert.Equal(t, "static", models.Geocoder.Name(), "yandex without a key is skipped")
+		result, err := models.Geocoder.Geocode(context.Background(), "Казань, Баумана, 1")
+		assert.Nil(t, err)
+		assert.Equal(t, geocoder.PrecisionStreet, result.Precision)
+	}
+
+	assert.Nil(t, beego.AppConfig.Set("geocoder_providers", "google"))
+	assert.NotNil(t, models.LoadGeocoder())
+
+	assert.Nil(t, os.WriteFile(path, []byte(`{"Полюс": {"lat": 91, "lon": 0}}`), 0o600))
+	assert.Nil(t, beego.AppConfig.Set("geocoder_providers", "static"))
+	assert.NotNil(t, models.LoadGeocoder())
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"api/pkg/jwtkeys"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestKeyringRotation(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	rsaPath := writePEM(t, "old.pem", "PRIVATE KEY", rsaDER)
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPath := writePEM(t, "new.pem", "PRIVATE KEY", edDER)
+
+	old, err := jwtkeys.Parse("old:RS256:file:"+rsaPath, "")
+	assert.Nil(t, err)
+	oldToken, err := old.Sign(jwt.MapClaims{"sub": "1"})
+	assert.Nil(t, err)
+
+	rotated, err := jwtkeys.Parse("old:RS256:file:"+rsaPath+",new:EdDSA:file:"+edPath, "new")
+	assert.Nil(t, err)
+	assert.Equal(t, "new", rotated.SigningKey().ID)
+
+	newToken, err := rotated.Sign(jwt.MapClaims{"sub": "1"})
+	assert.Nil(t, err)
+
+	for _, raw := range []string{oldToken, newToken} {
+		token, err := jwt.Parse(raw, rotated.Keyfunc, jwt.WithValidMethods(rotated.Algorithms()))
+		assert.Nil(t, err)
+		assert.True(t, token.Valid)
+	}
+
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, jwtkeys.EdDSA, parsed.Method.Alg())
+
+	jwks := rotated.PublicKeys()
+	assert.Len(t, jwks, 2)
+	assert.Equal(t, "RSA", jwks[0].Kty)
+	assert.Equal(t, "AQAB", jwks[0].E)
+	assert.Equal(t, "OKP", jwks[1].Kty)
+	assert.Equal(t, "Ed25519", jwks[1].Crv)
+}
+
+func TestKeyringRejectsUnknownKid(t *testing.T) {
+	a, _ := jwtkeys.Parse("a:HS256:secret:first-secret-0123456789", "")
+	b, _ := jwtkeys.Parse("b:HS256:secret:other-secret-0123456789", "")
+
+	raw, _ := b.Sign(jwt.MapClaims{"sub": "1"})
+	_, err := jwt.Parse(raw, a.Keyfunc)
+	assert.NotNil(t, err)
+}
+
+func TestKeyringConfigErrors(t *testing.T) {
+	_, err := jwtkeys.Parse("", "")
+	assert.Equal(t, jwtkeys.ErrNoSigningKey, err)
+
+	_, err = jwtkeys.Parse("k:HS256:secret:short", "")
+	assert.NotNil(t, err)
+
+	_, err = jwtkeys.Parse("k:HS512:secret:long-enough-secret-value", "")
+	assert.NotNil(t, err)
+
+	_, err = jwtkeys.Parse("k:HS256:secret:long-enough-secret-value", "missing")
+	assert.NotNil(t, err)
+}
+
+func TestJWKSEndpoint(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var set jwtkeys.JWKSet
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &set))
+	// В конфигурации для разработки только HS256: секреты не публикуются
+	assert.Empty(t, set.Keys)
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"api/models"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	models.LoginAttempts = models.NewMemoryLoginAttemptStore()
+}
+
+// noRows имитирует выборку без результатов
+type noRows struct {
+	*mock.DoNothingQuerySetter
+}
+
+func (q noRows) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q noRows) One(interface{}, ...string) error             { return orm.ErrNoRows }
+
+func ownerLogin(email, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "/v1/owner/user/login",
+		bytes.NewBufferString(`{"email":"`+email+`","password":"wrong"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+func TestLockoutPolicyIsExponential(t *testing.T) {
+	policy := models.LockoutPolicy{Base: 30 * time.Second, Max: 5 * time.Minute}
+
+	assert.Equal(t, time.Duration(0), policy.Lockout(4, 5))
+	assert.Equal(t, 30*time.Second, policy.Lockout(5, 5))
+	assert.Equal(t, time.Minute, policy.Lockout(6, 5))
+	assert.Equal(t, 2*time.Minute, policy.Lockout(7, 5))
+	assert.Equal(t, 5*time.Minute, policy.Lockout(50, 5))
+	assert.Equal(t, time.Duration(0), policy.Lockout(50, 0))
+}
+
+func TestLockoutOutlivesFailureWindow(t *testing.T) {
+	store := models.NewMemoryLoginAttemptStore()
+	window := 50 * time.Millisecond
+
+	failures, _ := store.Fail("account:owner:a@b.c", window)
+	assert.Equal(t, 1, failures)
+	assert.Nil(t, store.Lock("account:owner:a@b.c", time.Now().Add(100*time.Millisecond)))
+
+	// Блокировка дольше окна не обнуляет счётчик: срок продолжает удваиваться
+	time.Sleep(80 * time.Millisecond)
+	failures, _ = store.Fail("account:owner:a@b.c", window)
+	assert.Equal(t, 2, failures)
+
+	// Окно после конца блокировки истекло — счёт заново
+	time.Sleep(200 * time.Millisecond)
+	failures, _ = store.Fail("account:owner:a@b.c", window)
+	assert.Equal(t, 1, failures)
+}
+
+func TestOwnerLoginLockedAfterRepeatedFailures(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("owner", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	for i := 0; i < 4; i++ {
+		w := ownerLogin("target@example.com", "198.51.100.1:4000", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	w := ownerLogin("target@example.com", "198.51.100.1:4000", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Блокировка по аккаунту действует с любого адреса, подмена X-Forwarded-For не помогает
+	w = ownerLogin("TARGET@example.com", "198.51.100.2:4000", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Другой аккаунт с того же адреса не заблокирован
+	w = ownerLogin("other@example.com", "198.51.100.1:4000", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAccountLoginSharesProfileCounters(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	stub.Mock(mockQueryTable("user", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{
+		"username": models.User{Id: 70, Username: "boris"},
+	}, ""}))
+	stub.Mock(mockQueryTable("owner", profileQuery{&mock.DoNothingQuerySetter{}, map[string]interface{}{
+		"contact_email": models.Owner{Id: 71, Email: "shop@boris.example"},
+	}, ""}))
+	stub.Mock(mockQueryTable("account", noRows{&mock.DoNothingQuerySetter{}}))
+
+	failed := func() (*models.TokenPair, error) { return nil, models.ErrInvalidCredentials }
+	var cooldown *models.CooldownError
+
+	// Неудачи единого входа расходуют попытки профиля посетителя...
+	for i := 0; i < 4; i++ {
+		_, err := models.GuardLogin(models.RoleVisitor, "boris", "192.0.2.30", failed)
+		assert.ErrorIs(t, err, models.ErrInvalidCredentials)
+	}
+	_, err := models.GuardAccountLogin("boris", "192.0.2.31", failed)
+	assert.True(t, errors.As(err, &cooldown))
+	_, err = models.GuardLogin(models.RoleVisitor, "Boris", "192.0.2.32", failed)
+	assert.True(t, errors.As(err, &cooldown), "the visitor endpoint shares the counter")
+
+	// ...и владельца, найденного по email
+	for i := 0; i < 5; i++ {
+		_, err = models.GuardAccountLogin("shop@boris.example", "192.0.2.33", failed)
+	}
+	assert.True(t, errors.As(err, &cooldown))
+	_, err = models.GuardLogin(models.RoleOwner, "shop@boris.example", "192.0.2.34", failed)
+	assert.True(t, errors.As(err, &cooldown), "the owner endpoint shares the counter")
+}
+
+func TestLoginLockedPerIP(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	calls := 0
+	failed := func() (*models.TokenPair, error) {
+		calls++
+		return nil, models.ErrInvalidCredentials
+	}
+
+	var err error
+	for i := 0; i < 20; i++ {
+		_, err = models.GuardLogin(models.RoleVisitor, "user"+string(rune('a'+i)), "192.0.2.7", failed)
+	}
+	var cooldown *models.CooldownError
+	assert.True(t, errors.As(err, &cooldown))
+
+	_, err = models.GuardLogin(models.RoleVisitor, "fresh-user", "192.0.2.7", failed)
+	assert.True(t, errors.As(err, &cooldown))
+	assert.Equal(t, 20, calls, "login must not run while the IP is locked")
+
+	// Ошибки, не связанные с паролем, не считаются попытками подбора
+	_, err = models.GuardLogin(models.RoleVisitor, "blocked", "192.0.2.8", func() (*models.TokenPair, error) {
+		return nil, models.ErrAccountBlocked
+	})
+	assert.Equal(t, models.ErrAccountBlocked, err)
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"api/models"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Три компании у Кремля в Казани и одна в Москве
+var clusterCompanies = []models.Company{
+	{Id: 11, Name: "Кофейня", BusinessSphere: "Кафе", Lat: 55.7960, Lon: 49.1060},
+	{Id: 12, Name: "Чайная", BusinessSphere: "Кафе", Lat: 55.7965, Lon: 49.1070},
+	{Id: 13, Name: "Булочная", BusinessSphere: "Пекарня", Lat: 55.7970, Lon: 49.1080},
+	{Id: 14, Name: "Столовая", BusinessSphere: "Кафе", Lat: 55.7558, Lon: 37.6173},
+}
+
+func serveClusters(t *testing.T, query string) models.MapClusters {
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/clusters?" + query, ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var clusters models.MapClusters
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &clusters))
+	return clusters
+}
+
+func TestMapClustersByZoom(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 0, clusterCompanies)
+	// Блокировка компании сбрасывает кеш, оставшийся от других тестов
+	assert.Nil(t, models.SetCompanyBlocked(99, false, models.SystemActor))
+
+	clusters := serveClusters(t, "bbox=30,50,60,60&zoom=10")
+	if assert.Len(t, clusters.Clusters, 1) && assert.Len(t, clusters.Points, 1) {
+		cluster := clusters.Clusters[0]
+		assert.Equal(t, 3, cluster.Count)
+		assert.InDelta(t, 55.7965, cluster.Lat, 1e-9)
+		assert.Equal(t, [4]float64{49.1060, 55.7960, 49.1080, 55.7970}, cluster.BBox)
+		assert.Equal(t, []models.CategoryCount{{Name: "Кафе", Count: 2}, {Name: "Пекарня", Count: 1}}, cluster.TopCategories)
+		assert.Equal(t, int64(14), clusters.Points[0].Id)
+	}
+
+	clusters = serveClusters(t, "bbox=49,55,50,56&zoom=17")
+	assert.Empty(t, clusters.Clusters)
+	assert.Len(t, clusters.Points, 3)
+}
+
+func TestMapClustersCacheInvalidatedOnChange(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 0, clusterCompanies)
+	assert.Nil(t, models.SetCompanyBlocked(99, false, models.SystemActor))
+	assert.Len(t, serveClusters(t, "bbox=30,50,60,60&zoom=17").Points, 4)
+
+	// Пока ничего не менялось через API, кластеры берутся из кеша
+	stub.Clear()
+	mockCompanyTable(stub, 0, clusterCompanies[:1])
+	assert.Len(t, serveClusters(t, "bbox=30,50,60,60&zoom=17").Points, 4)
+
+	assert.Nil(t, models.SetCompanyBlocked(12, true, models.SystemActor))
+	assert.Len(t, serveClusters(t, "bbox=30,50,60,60&zoom=17").Points, 1)
+}
+
+func TestMapClustersRejectInvalidParams(t *testing.T) {
+	for _, query := range []string{"bbox=30,50,60,60", "bbox=30,50,60,60&zoom=23", "zoom=10"} {
+		w := serveCompanyRoute(companyRoute{"GET", "/v1/geocoder/cords/geo/clusters?" + query, ""}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
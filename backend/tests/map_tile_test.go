@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"api/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func serveTile(path, etag string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", path, http.NoBody)
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+// decodedLayer — имя слоя, число точек и ключи свойств из тайла
+type decodedLayer struct {
+	name     string
+	features int
+	keys     []string
+}
+
+// decodeTile разбирает верхний уровень тайла MVT
+func decodeTile(t *testing.T, tile []byte) []decodedLayer {
+	var layers []decodedLayer
+	for len(tile) > 0 {
+		num, typ, n := protowire.ConsumeTag(tile)
+		assert.Equal(t, protowire.Number(3), num)
+		assert.Equal(t, protowire.BytesType, typ)
+		tile = tile[n:]
+		raw, n := protowire.ConsumeBytes(tile)
+		tile = tile[n:]
+
+		var layer decodedLayer
+		for len(raw) > 0 {
+			num, typ, n := protowire.ConsumeTag(raw)
+			raw = raw[n:]
+			if typ != protowire.BytesType {
+				_, n = protowire.ConsumeVarint(raw)
+				raw = raw[n:]
+				continue
+			}
+			value, n := protowire.ConsumeBytes(raw)
+			raw = raw[n:]
+			switch num {
+			case 1:
+				layer.name = string(value)
+			case 2:
+				layer.features++
+			case 3:
+				layer.keys = append(layer.keys, string(value))
+			}
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+func TestCompanyTile(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockCompanyTable(stub, 0, clusterCompanies)
+	assert.Nil(t, models.SetCompanyBlocked(99, false, models.SystemActor))
+
+	// Тайл масштаба 10 с центром Казани
+	w := serveTile("/tiles/10/651/319.mvt", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/vnd.mapbox-vector-tile", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	layers := decodeTile(t, w.Body.Bytes())
+	if assert.Len(t, layers, 1) {
+		assert.Equal(t, "companies", layers[0].name)
+		assert.Equal(t, 3, layers[0].features)
+		assert.ElementsMatch(t, []string{"id", "name", "business_sphere"}, layers[0].keys)
+	}
+
+	w = serveTile("/tiles/10/651/319.mvt", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+
+	// После блокировки компании тайл строится заново и получает новый ETag
+	assert.Nil(t, models.SetCompanyBlocked(12, true, models.SystemActor))
+	stub.Clear()
+	mockCompanyTable(stub, 0, clusterCompanies[:1])
+	w = serveTile("/tiles/10/651/319.mvt", etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, 1, decodeTile(t, w.Body.Bytes())[0].features)
+
+	w = serveTile("/tiles/10/0/0.mvt", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestCompanyTileRejectsInvalidCoordinates(t *testing.T) {
+	for _, path := range []string{"/tiles/23/0/0.mvt", "/tiles/2/4/0.mvt", "/tiles/2/0/-1.mvt", "/tiles/z/0/0.mvt"} {
+		w := serveTile(path, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/totp"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238, приложение B: секрет "12345678901234567890", SHA1
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// ownerRow подставляет владельца, найденного по email
+type ownerRow struct {
+	*mock.DoNothingQuerySetter
+	owner models.Owner
+}
+
+func (q ownerRow) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q ownerRow) One(container interface{}, _ ...string) error {
+	*container.(*models.Owner) = q.owner
+	return nil
+}
+
+func TestTOTPMatchesRFCVectors(t *testing.T) {
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924"} {
+		code, err := totp.Code(rfcSecret, time.Unix(unix, 0))
+		assert.Nil(t, err)
+		assert.Equal(t, want, code)
+	}
+
+	now := time.Unix(1234567890, 0)
+	counter, ok := totp.Validate("005924", rfcSecret, now, 1, 0)
+	assert.True(t, ok)
+
+	// Тот же код повторно не принимается
+	_, ok = totp.Validate("005924", rfcSecret, now, 1, counter)
+	assert.False(t, ok)
+
+	uri := totp.ProvisioningURI("QWERTY.TOWN", "owner@example.com", rfcSecret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/QWERTY.TOWN:owner@example.com?"))
+	assert.Contains(t, uri, "secret="+rfcSecret)
+}
+
+func TestOwnerLoginWithMFA(t *testing.T) {
+	hash, err := models.HashPassword("correct-password")
+	assert.Nil(t, err)
+	owner := models.Owner{Id: 21, Email: "mfa@example.com", Password: hash, EmailVerified: true}
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("owner", ownerRow{&mock.DoNothingQuerySetter{}, owner}))
+	stub.Mock(mock.MockRead("owner_mfa", func(data interface{}) {
+		mfa := data.(*models.OwnerMFA)
+		mfa.Secret = rfcSecret
+		mfa.Enabled = true
+	}, nil))
+	stub.Mock(mock.MockRead("owner", func(data interface{}) {
+		*data.(*models.Owner) = owner
+	}, nil))
+	stub.Mock(mockQueryTable("owner_mfa", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("mfa_recovery_code", updatedRows{&mock.DoNothingQuerySetter{}, 0}))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	w := postJSON("/v1/owner/user/login", `{"email":"mfa@example.com","password":"correct-password"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var challenge struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.Equal(t, true, challenge.Data["mfa_required"])
+	assert.NotContains(t, challenge.Data, "access_token")
+	mfaToken, _ := challenge.Data["mfa_token"].(string)
+
+	// mfa_token не заменяет access-токен
+	_, err = models.Authenticate(mfaToken)
+	assert.NotNil(t, err)
+
+	w = postJSON("/v1/owner/user/login/mfa", `{"mfa_token":"`+mfaToken+`","code":"000000"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON("/v1/owner/user/login/mfa", `{"mfa_token":"`+mfaToken+`","code":"bad-recovery"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	code, _ := totp.Code(rfcSecret, time.Now())
+	w = postJSON("/v1/owner/user/login/mfa", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "access_token")
+
+	// mfa_token одноразовый
+	w = postJSON("/v1/owner/user/login/mfa", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMFAEndpointsRequireOwner(t *testing.T) {
+	visitor := visitorTokenWithRoles(1)
+	for _, path := range []string{"/v1/owner/user/mfa/enroll", "/v1/owner/user/mfa/confirm", "/v1/owner/user/mfa/disable"} {
+		assert.Equal(t, http.StatusUnauthorized, serveAdmin("POST", path, "").Code, path)
+		assert.Equal(t, http.StatusUnauthorized, serveAdmin("POST", path, visitor).Code, path)
+	}
+
+	// Сброс 2FA доступен только с owners:manage
+	w := serveAdmin("POST", "/v1/admin/owners/21/mfa/reset", ownerToken(21))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/oidc"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	models.OIDCStates = models.NewMemoryOIDCStateStore()
+}
+
+// mockIdP — локальный провайдер OIDC: discovery, JWKS и token endpoint с проверкой PKCE
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]url.Values // code -> параметры запроса авторизации
+	claims jwt.MapClaims         // что провайдер знает о пользователе
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	idp := &mockIdP{key: key, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "idp-1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		id, secret, _ := r.BasicAuth()
+
+		idp.mu.Lock()
+		auth, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		claims := jwt.MapClaims{}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || id != "qwerty" || secret != "s3cret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") ||
+			r.PostForm.Get("redirect_uri") != auth.Get("redirect_uri") {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		now := time.Now()
+		claims["iss"] = idp.URL
+		claims["aud"] = "qwerty"
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(time.Minute).Unix()
+		if _, set := claims["nonce"]; !set {
+			claims["nonce"] = auth.Get("nonce")
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "idp-1"
+		signed, _ := token.SignedString(key)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	models.RegisterOIDCProvider(oidc.NewClient(oidc.Config{
+		Name:         "mock",
+		Issuer:       idp.URL,
+		ClientID:     "qwerty",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:5173/oidc/mock/callback",
+	}))
+	return idp
+}
+
+// authorize проходит вход через API до редиректа обратно и возвращает code и state
+func (idp *mockIdP) authorize(t *testing.T, claims jwt.MapClaims) (string, string) {
+	w := serveAdmin("GET", "/v1/visitor/user/oidc/mock/login", "")
+	assert.Equal(t, http.StatusFound, w.Code, w.Body.String())
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.Nil(t, err)
+	params := location.Query()
+	assert.Equal(t, "S256", params.Get("code_challenge_method"))
+	assert.NotEmpty(t, params.Get("nonce"))
+
+	// state привязан к браузеру cookie, недоступной скриптам
+	cookie := (&http.Response{Header: w.Header()}).Cookies()
+	if assert.Len(t, cookie, 1) {
+		assert.Equal(t, params.Get("state"), cookie[0].Value)
+		assert.True(t, cookie[0].HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie[0].SameSite)
+	}
+
+	code := oidc.RandomString(16)
+	idp.mu.Lock()
+	idp.codes[code] = params
+	idp.claims = claims
+	idp.mu.Unlock()
+	return code, params.Get("state")
+}
+
+// userRow подставляет посетителя, найденного по email
+type userRow struct {
+	*mock.DoNothingQuerySetter
+	user models.User
+}
+
+func (q userRow) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q userRow) One(container interface{}, _ ...string) error {
+	*container.(*models.User) = q.user
+	return nil
+}
+
+// oidcCallback завершает вход из браузера, который его начал
+func oidcCallback(code, state string) *httptest.ResponseRecorder {
+	return oidcCallbackWithCookie(code, state, state)
+}
+
+// oidcCallbackWithCookie завершает вход из браузера с cookie oidc_state = cookie ("" — без cookie)
+func oidcCallbackWithCookie(code, state, cookie string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "/v1/visitor/user/oidc/mock/callback",
+		bytes.NewBufferString(`{"code":"`+code+`","state":"`+state+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: "oidc_state", Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	idp := newMockIdP(t)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user_identity", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mockQueryTable("user", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockInsertWithCtx("user", 77, nil))
+	stub.Mock(mock.MockInsertWithCtx("user_identity", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	code, state := idp.authorize(t, jwt.MapClaims{"sub": "idp-user-1", "email": "new@example.com", "email_verified": true})
+	w := oidcCallback(code, state)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data models.TokenPair `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	principal, err := models.Authenticate(resp.Data.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(77), principal.ID)
+	assert.True(t, principal.EmailVerified)
+
+	// state одноразовый
+	w = oidcCallback(code, state)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOIDCLinksByVerifiedEmailOnly(t *testing.T) {
+	idp := newMockIdP(t)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user_identity", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockInsertWithCtx("user_identity", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	existing := models.User{Id: 5, Username: "anna", Email: "anna@example.com", EmailVerified: true}
+	stub.Mock(mockQueryTable("user", userRow{&mock.DoNothingQuerySetter{}, existing}))
+
+	// Провайдер не подтвердил адрес — привязки нет
+	code, state := idp.authorize(t, jwt.MapClaims{"sub": "idp-anna", "email": "anna@example.com", "email_verified": false})
+	assert.Equal(t, http.StatusConflict, oidcCallback(code, state).Code)
+
+	// Адрес подтверждён у провайдера и у нас — вход в существующий аккаунт
+	code, state = idp.authorize(t, jwt.MapClaims{"sub": "idp-anna", "email": "anna@example.com", "email_verified": "true"})
+	w := oidcCallback(code, state)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data models.TokenPair `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	principal, err := models.Authenticate(resp.Data.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), principal.ID)
+}
+
+func TestOIDCCallbackRequiresBrowserThatStartedLogin(t *testing.T) {
+	idp := newMockIdP(t)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user_identity", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mockQueryTable("user", noRows{&mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockInsertWithCtx("user", 77, nil))
+	stub.Mock(mock.MockInsertWithCtx("user_identity", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	// Атакующий начал вход сам и подсовывает свои code и state браузеру жертвы
+	_, victimState := idp.authorize(t, jwt.MapClaims{"sub": "victim"})
+	code, state := idp.authorize(t, jwt.MapClaims{"sub": "attacker", "email": "attacker@example.com", "email_verified": true})
+	assert.Equal(t, http.StatusBadRequest, oidcCallbackWithCookie(code, state, "").Code)
+	assert.Equal(t, http.StatusBadRequest, oidcCallbackWithCookie(code, state, victimState).Code)
+
+	// Отвергнутые попытки не расходуют state: браузер атакующего по-прежнему может войти
+	assert.Equal(t, http.StatusOK, oidcCallback(code, state).Code)
+}
+
+func TestOIDCRejectsForeignNonceAndUnknownProvider(t *testing.T) {
+	idp := newMockIdP(t)
+
+	code, state := idp.authorize(t, jwt.MapClaims{"sub": "idp-user-2", "nonce": "replayed-nonce"})
+	assert.Equal(t, http.StatusUnauthorized, oidcCallback(code, state).Code)
+
+	// Неверный code (или code_verifier) отвергается провайдером
+	_, state = idp.authorize(t, jwt.MapClaims{"sub": "idp-user-2"})
+	assert.Equal(t, http.StatusUnauthorized, oidcCallback("wrong-code", state).Code)
+
+	w := serveAdmin("GET", "/v1/visitor/user/oidc/unknown/login", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/mailer"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+// accountByEmail имитирует поиск аккаунта по почте; id == 0 — аккаунта нет
+type accountByEmail struct {
+	*mock.DoNothingRawSetter
+	id int64
+}
+
+func (r accountByEmail) QueryRow(containers ...interface{}) error {
+	if r.id == 0 {
+		return orm.ErrNoRows
+	}
+	reflect.ValueOf(containers[0]).Elem().FieldByName("Id").SetInt(r.id)
+	return nil
+}
+
+// issuedReset подставляет выданный токен сброса и результат его погашения
+type issuedReset struct {
+	*mock.DoNothingQuerySetter
+	subjectID int64
+	consumed  int64
+}
+
+func (q issuedReset) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q issuedReset) Update(orm.Params) (int64, error)             { return q.consumed, nil }
+func (q issuedReset) One(container interface{}, _ ...string) error {
+	reset := container.(*models.PasswordReset)
+	reset.Id = 1
+	reset.SubjectType = models.RoleOwner
+	reset.SubjectId = q.subjectID
+	reset.ExpiresAt = time.Now().Add(time.Hour)
+	return nil
+}
+
+func postJSON(path, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	return w
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	outbox := mailer.NewFileOutbox(t.TempDir(), "no-reply@qwerty.town")
+	models.Mailer = outbox
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+
+	stub.Mock(mock.MockRawWithCtx(accountByEmail{&mock.DoNothingRawSetter{}, 0}))
+	unknown := postJSON("/v1/owner/user/forgot-password", `{"email":"nobody@example.com"}`)
+
+	stub.Clear()
+	stub.Mock(mock.MockRawWithCtx(accountByEmail{&mock.DoNothingRawSetter{}, 9}))
+	stub.Mock(mockQueryTable("password_reset", lastVerification{DoNothingQuerySetter: &mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockInsertWithCtx("password_reset", 1, nil))
+	known := postJSON("/v1/owner/user/forgot-password", `{"email":"owner@example.com"}`)
+
+	assert.Equal(t, http.StatusOK, unknown.Code)
+	assert.Equal(t, unknown.Code, known.Code)
+	assert.Equal(t, unknown.Body.String(), known.Body.String())
+
+	// Письмо уходит в фоне, уже после ответа
+	var msg mailer.Message
+	assert.Eventually(t, func() bool {
+		var sent bool
+		msg, sent = outbox.Last("owner@example.com")
+		return sent
+	}, time.Second, 10*time.Millisecond)
+	assert.NotEmpty(t, verificationToken(t, msg))
+	_, sent := outbox.Last("nobody@example.com")
+	assert.False(t, sent)
+}
+
+func TestResetPasswordEndsSessions(t *testing.T) {
+	token, _ := models.CreateOwnerToken(models.Owner{Id: 9, EmailVerified: true}, "family")
+	_, err := models.VerifyOwnerToken(token)
+	assert.Nil(t, err)
+
+	// iat хранится в секундах: ждём следующую секунду, чтобы токен был выдан строго до сброса
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("password_reset", issuedReset{&mock.DoNothingQuerySetter{}, 9, 1}))
+	stub.Mock(mockQueryTable("owner", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+
+	w := postJSON("/v1/owner/user/reset-password", `{"token":"raw-token","password":"short"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON("/v1/owner/user/reset-password", `{"token":"raw-token","password":"new-password-123"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	_, err = models.VerifyOwnerToken(token)
+	assert.Equal(t, models.ErrTokenRevoked, err)
+
+	// Новый вход после сброса работает
+	fresh, _ := models.CreateOwnerToken(models.Owner{Id: 9, EmailVerified: true}, "")
+	_, err = models.VerifyOwnerToken(fresh)
+	assert.Nil(t, err)
+
+	// Токен одноразовый
+	stub.Clear()
+	stub.Mock(mockQueryTable("password_reset", issuedReset{&mock.DoNothingQuerySetter{}, 9, 0}))
+	w = postJSON("/v1/owner/user/reset-password", `{"token":"raw-token","password":"new-password-123"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"api/pkg/password"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fastParams(algorithm string) password.Params {
+	p := password.DefaultParams()
+	p.Algorithm = algorithm
+	p.Memory = 1024
+	p.Iterations = 1
+	p.BcryptCost = 4
+	return p
+}
+
+func TestPasswordHashVerify(t *testing.T) {
+	for _, algorithm := range []string{password.Argon2id, password.Bcrypt} {
+		p := fastParams(algorithm)
+
+		hash, err := password.Hash("secret", p)
+		assert.Nil(t, err)
+		assert.True(t, password.IsHashed(hash))
+		assert.NotContains(t, hash, "secret")
+
+		ok, err := password.Verify("secret", hash)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		ok, err = password.Verify("wrong", hash)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		assert.False(t, password.NeedsRehash(hash, p))
+	}
+}
+
+func TestPasswordArgon2idStoresParams(t *testing.T) {
+	hash, err := password.Hash("secret", fastParams(password.Argon2id))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=2$"))
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	weak := fastParams(password.Argon2id)
+	hash, _ := password.Hash("secret", weak)
+
+	stronger := weak
+	stronger.Iterations = 2
+	assert.True(t, password.NeedsRehash(hash, stronger))
+	assert.True(t, password.NeedsRehash(hash, fastParams(password.Bcrypt)))
+	assert.True(t, password.NeedsRehash("plaintext", weak))
+}
+
+func TestPasswordLegacyPlaintext(t *testing.T) {
+	assert.False(t, password.IsHashed("qwerty123"))
+	assert.True(t, password.VerifyLegacy("qwerty123", "qwerty123"))
+	assert.False(t, password.VerifyLegacy("qwerty", "qwerty123"))
+
+	_, err := password.Verify("qwerty123", "qwerty123")
+	assert.Equal(t, password.ErrMalformedHash, err)
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"api/models"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedTable подставляет строки rows (срез моделей) и записывает удаления и обновления таблицы
+type recordedTable struct {
+	*mock.DoNothingQuerySetter
+	table string
+	rows  interface{}
+	ops   *[]string
+}
+
+func (q recordedTable) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q recordedTable) SetCond(*orm.Condition) orm.QuerySeter        { return q }
+func (q recordedTable) OrderBy(...string) orm.QuerySeter             { return q }
+func (q recordedTable) Limit(interface{}, ...interface{}) orm.QuerySeter {
+	return q
+}
+func (q recordedTable) All(container interface{}, _ ...string) (int64, error) {
+	if q.rows == nil {
+		return 0, nil
+	}
+	rows := reflect.ValueOf(q.rows)
+	reflect.ValueOf(container).Elem().Set(rows)
+	return int64(rows.Len()), nil
+}
+func (q recordedTable) One(container interface{}, _ ...string) error {
+	if q.rows == nil || reflect.ValueOf(q.rows).Len() == 0 {
+		return orm.ErrNoRows
+	}
+	reflect.ValueOf(container).Elem().Set(reflect.ValueOf(q.rows).Index(0))
+	return nil
+}
+func (q recordedTable) Delete() (int64, error) {
+	*q.ops = append(*q.ops, "delete "+q.table)
+	return 1, nil
+}
+func (q recordedTable) Update(values orm.Params) (int64, error) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	*q.ops = append(*q.ops, "update "+q.table+" "+strings.Join(keys, ","))
+	return 1, nil
+}
+
+// mockProfileTables подставляет таблицы с данными профилей; rows — строки для отдельных таблиц
+func mockProfileTables(stub mock.Stub, rows map[string]interface{}) *[]string {
+	ops := new([]string)
+	for _, table := range []string{"user", "owner", "account", "company", "api_key", "mfa_recovery_code", "owner_mfa",
+		"user_identity", "account_session", "refresh_token", "account_role", "email_verification", "password_reset",
+		"audit_log", "erasure_request"} {
+		stub.Mock(mockQueryTable(table, recordedTable{&mock.DoNothingQuerySetter{}, table, rows[table], ops}))
+	}
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+	return ops
+}
+
+func TestAccountExport(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockProfileTables(stub, map[string]interface{}{
+		"company":   []models.Company{{Id: 4, Name: "Кофейня", City: "Казань", Owner: &models.Owner{Id: 71, Password: "hash"}}},
+		"audit_log": []models.AuditLog{{Id: 9, Action: "api_key.create", ActorType: models.RoleOwner, ActorId: 71}},
+	})
+	stub.Mock(mock.MockRead("owner", func(data interface{}) {
+		owner := data.(*models.Owner)
+		owner.Fullname = "Иван Петров"
+		owner.Email = "ivan@example.com"
+		owner.Password = "$argon2id$secret-hash"
+		owner.Phone = "+79990000000"
+	}, nil))
+	stub.Mock(mock.MockRead("owner_mfa", nil, orm.ErrNoRows))
+
+	w := serveAdmin("GET", "/v1/account/export", ownerToken(71))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.NotContains(t, w.Body.String(), "secret-hash")
+	assert.NotContains(t, w.Body.String(), `"hash"`)
+
+	var export models.AccountExport
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Nil(t, export.Visitor)
+	assert.Equal(t, "+79990000000", export.Owner.Phone)
+	assert.Len(t, export.Owner.Companies, 1)
+	assert.Equal(t, "Кофейня", export.Owner.Companies[0].Name)
+	assert.Len(t, export.AuditLog, 1)
+	assert.Nil(t, export.Erasure)
+}
+
+func TestAccountErasureScheduledAndCancelled(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	mockProfileTables(stub, nil)
+	stub.Mock(mock.MockRead("owner", nil, nil))
+	stub.Mock(mock.MockInsertWithCtx("erasure_request", 3, nil))
+
+	w := serveAdmin("POST", "/v1/account/erasure", ownerToken(71))
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var resp struct {
+		Data models.ErasureInfo `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.WithinDuration(t, time.Now().Add(models.ErasureGrace()), resp.Data.EraseAfter, 5*time.Second)
+
+	// Нет запланированного удаления — отменять нечего
+	w = serveAdmin("DELETE", "/v1/account/erasure", ownerToken(71))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	stub.Clear()
+	pending := []models.ErasureRequest{{Id: 3, OwnerId: 71, EraseAfter: resp.Data.EraseAfter}}
+	ops := mockProfileTables(stub, map[string]interface{}{"erasure_request": pending})
+	stub.Mock(mock.MockRead("owner", nil, nil))
+
+	w = serveAdmin("POST", "/v1/account/erasure", ownerToken(71))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = serveAdmin("DELETE", "/v1/account/erasure", ownerToken(71))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"update erasure_request cancelled_at"}, *ops)
+}
+
+func TestProcessErasuresRemovesOwnerData(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	due := []models.ErasureRequest{{Id: 3, OwnerId: 73, EraseAfter: time.Now().Add(-time.Minute)}}
+	ops := mockProfileTables(stub, map[string]interface{}{"erasure_request": due})
+
+	n, err := models.ProcessErasures(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	for _, op := range []string{
+		"delete company",
+		"delete api_key",
+		"delete owner_mfa",
+		"delete refresh_token",
+		"update audit_log changes,details,ip",
+		"delete owner",
+		"update erasure_request completed_at,ip",
+	} {
+		assert.Contains(t, *ops, op)
+	}
+	assert.NotContains(t, *ops, "delete user")
+}
+
+func TestAdminDeleteOwnerErasesCompanies(t *testing.T) {
+	w := serveAdmin("DELETE", "/v1/owner/user/74", ownerToken(74))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	ops := mockProfileTables(stub, nil)
+	stub.Mock(mock.MockRead("owner", nil, nil))
+	stub.Mock(mock.MockRawWithCtx(accountRoles{&mock.DoNothingRawSetter{}, []string{"admin"}}))
+
+	admin, _ := models.CreateToken(models.User{Id: 1, Username: "staff"}, "")
+	w = serveAdmin("DELETE", "/v1/owner/user/74", admin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, *ops, "delete company")
+	assert.Contains(t, *ops, "delete owner")
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"api/models"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// searchResults подставляет число найденных и строки результатов поиска
+type searchResults struct {
+	*mock.DoNothingRawSetter
+	total int64
+	hits  []models.CompanySearchHit
+}
+
+func (r searchResults) QueryRow(containers ...interface{}) error {
+	*containers[0].(*int64) = r.total
+	return nil
+}
+
+func (r searchResults) QueryRows(containers ...interface{}) (int64, error) {
+	*containers[0].(*[]models.CompanySearchHit) = r.hits
+	return int64(len(r.hits)), nil
+}
+
+func TestSearchCompaniesHighlightsMatches(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockRawWithCtx(searchResults{&mock.DoNothingRawSetter{}, 3, []models.CompanySearchHit{{
+		Id:            4,
+		Name:          "<b>Кофейня</b>",
+		Rank:          0.6,
+		NameHighlight: "<b>\uE000Кофейня\uE001</b>",
+		Snippet:       "Свежий \uE000кофе\uE001 & выпечка",
+	}}}))
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/search/companies?q=" + url.QueryEscape("кофейни"), ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+
+	var hits []models.CompanySearchHit
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &hits))
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, "<b>Кофейня</b>", hits[0].Name)
+		assert.Equal(t, "&lt;b&gt;<mark>Кофейня</mark>&lt;/b&gt;", hits[0].NameHighlight)
+		assert.Equal(t, "Свежий <mark>кофе</mark> &amp; выпечка", hits[0].Snippet)
+	}
+}
+
+func TestSearchCompaniesClampsLimit(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	var limits []interface{}
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"),
+		[]interface{}{searchResults{&mock.DoNothingRawSetter{}, 0, nil}},
+		func(inv *orm.Invocation) {
+			// Размер страницы — предпоследний аргумент запроса результатов
+			if args := inv.Args[1].([]interface{}); len(args) == 5 {
+				limits = append(limits, args[3])
+			}
+		}))
+
+	for _, limit := range []string{"1000", "0"} {
+		w := serveCompanyRoute(companyRoute{"GET", "/v1/search/companies?q=" + url.QueryEscape("кофе") + "&limit=" + limit, ""}, "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	assert.Equal(t, []interface{}{models.SearchPageMax, models.SearchPageDefault}, limits)
+}
+
+func TestSearchCompaniesRequiresQuery(t *testing.T) {
+	for _, path := range []string{"/v1/search/companies", "/v1/search/companies?q=%20%20", "/v1/search/companies?q=кофе&limit=ten"} {
+		w := serveCompanyRoute(companyRoute{"GET", path, ""}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"api/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm/mock"
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func visitorLogin(t *testing.T, userAgent string) string {
+	r, _ := http.NewRequest("POST", "/v1/visitor/user/login",
+		bytes.NewBufferString(`{"username":"anna","password":"correct-password"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", userAgent)
+	r.RemoteAddr = "203.0.113.7:51000"
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data models.TokenPair `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data.AccessToken
+}
+
+func listSessions(t *testing.T, token string) []models.SessionInfo {
+	w := serveAdmin("GET", "/v1/visitor/user/sessions", token)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data []models.SessionInfo `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data
+}
+
+func TestSessionsListedAndRevoked(t *testing.T) {
+	hash, err := models.HashPassword("correct-password")
+	assert.Nil(t, err)
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("user", userRow{&mock.DoNothingQuerySetter{}, models.User{Id: 31, Username: "anna", Password: hash}}))
+	stub.Mock(mockQueryTable("refresh_token", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+	stub.Mock(mock.MockInsertWithCtx("audit_log", 1, nil))
+
+	laptop := visitorLogin(t, "Firefox/130.0")
+	phone := visitorLogin(t, "Safari/17.0 Mobile")
+
+	sessions := listSessions(t, laptop)
+	assert.Len(t, sessions, 2)
+	var laptopSession, phoneSession models.SessionInfo
+	for _, s := range sessions {
+		assert.Equal(t, "203.0.113.7", s.IP)
+		if s.Current {
+			laptopSession = s
+		} else {
+			phoneSession = s
+		}
+	}
+	assert.Equal(t, "Firefox/130.0", laptopSession.UserAgent)
+	assert.Equal(t, "Safari/17.0 Mobile", phoneSession.UserAgent)
+
+	// Завершение остальных сессий сразу отключает токены телефона
+	w := serveAdmin("POST", "/v1/visitor/user/sessions/revoke-others", laptop)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"err":false,"data":{"revoked":1}}`, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, serveAdmin("GET", "/v1/visitor/user/sessions", phone).Code)
+	assert.Len(t, listSessions(t, laptop), 1)
+
+	w = serveAdmin("DELETE", "/v1/visitor/user/sessions/"+phoneSession.Id, laptop)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serveAdmin("DELETE", "/v1/visitor/user/sessions/"+laptopSession.Id, laptop)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, serveAdmin("GET", "/v1/visitor/user/sessions", laptop).Code)
+}
+
+func TestSessionOfAnotherAccountCannotBeRevoked(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mock.MockInsertWithCtx("refresh_token", 1, nil))
+
+	assert.Nil(t, models.Sessions.Create(models.AccountSession{Id: "foreign", SubjectType: models.RoleOwner, SubjectId: 5}))
+	w := serveAdmin("DELETE", "/v1/visitor/user/sessions/foreign", visitorTokenWithRoles(5))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Токен с sid несуществующей сессии не принимается
+	token, _ := models.CreateToken(models.User{Id: 5, Username: "anna"}, "missing")
+	assert.Equal(t, http.StatusUnauthorized, serveAdmin("GET", "/v1/visitor/user/sessions", token).Code)
+}
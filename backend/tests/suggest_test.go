@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/keyboard"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// suggestRows подставляет строки подсказок
+type suggestRows struct {
+	*mock.DoNothingRawSetter
+	rows []models.Suggestion
+}
+
+func (r suggestRows) QueryRows(containers ...interface{}) (int64, error) {
+	*containers[0].(*[]models.Suggestion) = r.rows
+	return int64(len(r.rows)), nil
+}
+
+func TestKeyboardToCyrillic(t *testing.T) {
+	for input, want := range map[string]string{
+		"rjatqyz":   "кофейня",
+		"Rfpfym":    "Казань",
+		"gbwwf":     "пицца",
+		"[kt,":      "хлеб",
+		"ghfxtxyfz": "прачечная",
+	} {
+		got, ok := keyboard.ToCyrillic(input)
+		assert.True(t, ok, input)
+		assert.Equal(t, want, got)
+	}
+
+	for _, input := range []string{"кофейня", "Кофе Like", "24/7", ""} {
+		got, ok := keyboard.ToCyrillic(input)
+		assert.False(t, ok, input)
+		assert.Equal(t, input, got)
+	}
+}
+
+func TestSuggestSearchesWrongLayout(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	var (
+		query string
+		args  []interface{}
+	)
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"),
+		[]interface{}{suggestRows{&mock.DoNothingRawSetter{}, []models.Suggestion{
+			{Kind: models.SuggestCompany, Text: "Кофейня на Баумана", Score: 1.8, Popularity: 3},
+			{Kind: models.SuggestBusinessSphere, Text: "Кофейни", Score: 0.7, Popularity: 12},
+		}}},
+		func(inv *orm.Invocation) { query, args = inv.Args[0].(string), inv.Args[1].([]interface{}) }))
+
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/search/suggest?q=rjatq_&limit=5", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var suggestions []models.Suggestion
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &suggestions))
+	assert.Len(t, suggestions, 2)
+	assert.Equal(t, models.SuggestCompany, suggestions[0].Kind)
+
+	if assert.Len(t, args, 6) {
+		assert.Equal(t, "rjatq_", args[0])
+		assert.Equal(t, "кофей_", args[1], "the Latin input is also searched as Cyrillic")
+		assert.Equal(t, `rjatq\_%`, args[2], "LIKE wildcards in the input are escaped")
+		assert.Equal(t, 5, args[5])
+	}
+	// Отбор операторами, которые поддерживают триграммные индексы, а не вычисленной близостью
+	assert.Contains(t, query, "c.name %> i.q")
+	assert.Contains(t, query, "pg_trgm.word_similarity_threshold")
+	assert.NotContains(t, query, ">= i.threshold")
+}
+
+func TestSuggestClampsLimit(t *testing.T) {
+	stub := mock.StartMock()
+	defer stub.Clear()
+	var limits []interface{}
+	stub.Mock(mock.NewMock(mock.NewSimpleCondition("", "RawWithCtx"),
+		[]interface{}{suggestRows{&mock.DoNothingRawSetter{}, nil}},
+		func(inv *orm.Invocation) { limits = append(limits, inv.Args[1].([]interface{})[5]) }))
+
+	for _, limit := range []string{"1000", "0"} {
+		w := serveCompanyRoute(companyRoute{"GET", "/v1/search/suggest?q=kofe&limit=" + limit, ""}, "")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	assert.Equal(t, []interface{}{models.SuggestLimitMax, models.SuggestLimitDefault}, limits)
+}
+
+func TestSuggestEmptyQuery(t *testing.T) {
+	w := serveCompanyRoute(companyRoute{"GET", "/v1/search/suggest?q=", ""}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
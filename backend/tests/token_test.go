@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"api/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	beego "github.com/beego/beego/v2/server/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	models.AccessTokenRevocations = models.NewMemoryRevocationStore()
+	models.Sessions = models.NewMemorySessionStore()
+}
+
+func TestAccessTokenHasExpiry(t *testing.T) {
+	token, err := models.CreateToken(models.User{Id: 7, Username: "visitor"}, "family")
+	assert.Nil(t, err)
+
+	claims, err := models.VerifyToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "family", claims.SessionID)
+	assert.NotEmpty(t, claims.ID)
+	assert.WithinDuration(t, time.Now().Add(models.AccessTokenTTL()), claims.ExpiresAt.Time, 5*time.Second)
+}
+
+func TestRevokedAccessTokenRejected(t *testing.T) {
+	token, _ := models.CreateOwnerToken(models.Owner{Id: 3, Email: "owner@example.com"}, "family")
+	claims, err := models.VerifyOwnerToken(token)
+	assert.Nil(t, err)
+
+	assert.Nil(t, models.AccessTokenRevocations.Revoke(claims.ID, claims.ExpiresAt.Time))
+
+	_, err = models.VerifyOwnerToken(token)
+	assert.Equal(t, models.ErrTokenRevoked, err)
+}
+
+func TestLogoutRequiresToken(t *testing.T) {
+	for _, path := range []string{"/v1/visitor/user/logout", "/v1/owner/user/logout"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		beego.BeeApp.Handlers.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+	}
+}
+
+func TestTokenAudienceSeparation(t *testing.T) {
+	visitor, _ := models.CreateToken(models.User{Id: 1, Username: "visitor"}, "")
+	owner, _ := models.CreateOwnerToken(models.Owner{Id: 1, Email: "owner@example.com"}, "")
+
+	_, err := models.VerifyOwnerToken(visitor)
+	assert.NotNil(t, err)
+	_, err = models.VerifyToken(owner)
+	assert.NotNil(t, err)
+
+	claims, err := models.VerifyOwnerToken(owner)
+	assert.Nil(t, err)
+	assert.Equal(t, models.RoleOwner, claims.Role)
+	assert.Equal(t, models.TokenIssuer, claims.Issuer)
+	assert.Equal(t, "1", claims.Subject)
+	assert.Contains(t, claims.Audience, models.Audience(models.RoleOwner))
+}
+
+func TestAuthenticatePrincipal(t *testing.T) {
+	token, _ := models.CreateOwnerToken(models.Owner{Id: 42}, "family")
+
+	principal, err := models.Authenticate(token)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), principal.ID)
+	assert.Equal(t, models.RoleOwner, principal.Role)
+	assert.Equal(t, "family", principal.SessionID)
+
+	_, err = models.Authenticate("not-a-token")
+	assert.NotNil(t, err)
+}
+
+func TestVisitorTokenRejectedByOwnerLogout(t *testing.T) {
+	token, _ := models.CreateToken(models.User{Id: 1, Username: "visitor"}, "")
+
+	r, _ := http.NewRequest("GET", "/v1/owner/user/logout", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	beego.BeeApp.Handlers.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
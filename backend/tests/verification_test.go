@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"api/models"
+	"api/pkg/mailer"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/client/orm/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// lastVerification подставляет последнюю выданную запись email_verification
+type lastVerification struct {
+	*mock.DoNothingQuerySetter
+	createdAt time.Time
+}
+
+func (q lastVerification) Filter(string, ...interface{}) orm.QuerySeter { return q }
+func (q lastVerification) OrderBy(...string) orm.QuerySeter            { return q }
+func (q lastVerification) One(container interface{}, _ ...string) error {
+	if q.createdAt.IsZero() {
+		return orm.ErrNoRows
+	}
+	container.(*models.EmailVerification).CreatedAt = q.createdAt
+	return nil
+}
+
+// verificationToken достаёт токен из ссылки в письме
+func verificationToken(t *testing.T, msg mailer.Message) string {
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if u, err := url.Parse(line); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatal("no verification link in message")
+	return ""
+}
+
+func TestFileOutboxWritesMessages(t *testing.T) {
+	outbox := mailer.NewFileOutbox(t.TempDir(), "QWERTY.TOWN <no-reply@qwerty.town>")
+
+	assert.Nil(t, outbox.Send(mailer.Message{To: "owner@example.com", Subject: "Привет", Body: "Текст"}))
+	assert.Equal(t, mailer.ErrNoRecipient, outbox.Send(mailer.Message{Subject: "Без адреса"}))
+	assert.NotNil(t, outbox.Send(mailer.Message{To: "a@example.com\r\nBcc: b@example.com"}))
+
+	files, err := outbox.Files()
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	raw, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(raw), "To: owner@example.com\r\n")
+	assert.Contains(t, string(raw), "Content-Type: text/plain; charset=utf-8")
+
+	msg, ok := outbox.Last("owner@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "Текст", msg.Body)
+}
+
+func TestEmailVerificationSingleUse(t *testing.T) {
+	outbox := mailer.NewFileOutbox(t.TempDir(), "no-reply@qwerty.town")
+	models.Mailer = outbox
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("email_verification", lastVerification{DoNothingQuerySetter: &mock.DoNothingQuerySetter{}}))
+	stub.Mock(mock.MockInsertWithCtx("email_verification", 1, nil))
+
+	assert.Nil(t, models.SendEmailVerification(models.RoleOwner, 5, "owner@example.com"))
+	msg, ok := outbox.Last("owner@example.com")
+	assert.True(t, ok)
+	token := verificationToken(t, msg)
+
+	// Токен не годится как access-токен и для другой роли
+	_, err := models.Authenticate(token)
+	assert.NotNil(t, err)
+	assert.Equal(t, models.ErrInvalidVerificationToken, models.ConfirmEmail(token, models.RoleVisitor))
+
+	stub.Clear()
+	stub.Mock(mockQueryTable("email_verification", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	stub.Mock(mockQueryTable("owner", updatedRows{&mock.DoNothingQuerySetter{}, 1}))
+	assert.Nil(t, models.ConfirmEmail(token, models.RoleOwner))
+
+	// Повторное использование: условное обновление не находит непогашенный токен
+	stub.Clear()
+	stub.Mock(mockQueryTable("email_verification", updatedRows{&mock.DoNothingQuerySetter{}, 0}))
+	assert.Equal(t, models.ErrInvalidVerificationToken, models.ConfirmEmail(token, models.RoleOwner))
+
+	assert.Equal(t, models.ErrInvalidVerificationToken, models.ConfirmEmail(token+"x", models.RoleOwner))
+}
+
+func TestEmailVerificationResendCooldown(t *testing.T) {
+	models.Mailer = mailer.NewFileOutbox(t.TempDir(), "no-reply@qwerty.town")
+
+	stub := mock.StartMock()
+	defer stub.Clear()
+	stub.Mock(mockQueryTable("email_verification", lastVerification{
+		DoNothingQuerySetter: &mock.DoNothingQuerySetter{},
+		createdAt:            time.Now().Add(-10 * time.Second),
+	}))
+
+	err := models.SendEmailVerification(models.RoleVisitor, 7, "visitor@example.com")
+	var cooldown *models.CooldownError
+	assert.True(t, errors.As(err, &cooldown))
+	assert.InDelta(t, 50, cooldown.RetrySeconds(), 2)
+}
+
+func TestUnverifiedOwnerCannotMutateCompanies(t *testing.T) {
+	unverified, _ := models.CreateOwnerToken(models.Owner{Id: 1}, "")
+
+	for _, route := range companyMutations {
+		w := serveCompanyRoute(route, unverified)
+		assert.Equal(t, http.StatusForbidden, w.Code, route.method+" "+route.path)
+		assert.Contains(t, w.Body.String(), "not verified")
+	}
+}
+
+func TestResendVerificationRequiresToken(t *testing.T) {
+	for _, path := range []string{"/v1/visitor/user/verify-email/resend", "/v1/owner/user/verify-email/resend"} {
+		assert.Equal(t, http.StatusUnauthorized, serveAdmin("POST", path, "").Code, path)
+	}
+}